@@ -0,0 +1,60 @@
+package main
+
+import (
+	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	awsv1beta2 "github.com/upbound/provider-aws/apis/ec2/v1beta2"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// composesV1Beta2 returns true if the Function input pins ec2.aws.upbound.io
+// v1beta2, so kinds that exist at v1beta2 should be composed at it.
+func (c Config) composesV1Beta2() bool {
+	return c.AWSAPIVersion == awsv1beta2.CRDGroupVersion.Version
+}
+
+// routeAtVersion returns the supplied Route at the API version the config
+// composes Routes at. Only the fields the Function sets are carried over.
+func routeAtVersion(cfg Config, r *awsv1beta1.Route) runtime.Object {
+	if !cfg.composesV1Beta2() {
+		return r
+	}
+	fp := r.Spec.ForProvider
+	return &awsv1beta2.Route{
+		ObjectMeta: r.ObjectMeta,
+		Spec: awsv1beta2.RouteSpec{
+			ForProvider: awsv1beta2.RouteParameters{
+				Region:                   fp.Region,
+				RouteTableIDRef:          fp.RouteTableIDRef,
+				GatewayIDRef:             fp.GatewayIDRef,
+				NATGatewayIDRef:          fp.NATGatewayIDRef,
+				DestinationCidrBlock:     fp.DestinationCidrBlock,
+				DestinationIPv6CidrBlock: fp.DestinationIPv6CidrBlock,
+			},
+			ResourceSpec: r.Spec.ResourceSpec,
+		},
+	}
+}
+
+// vpcEndpointAtVersion returns the supplied VPCEndpoint at the API version the
+// config composes VPCEndpoints at. Only the fields the Function sets are
+// carried over.
+func vpcEndpointAtVersion(cfg Config, ep *awsv1beta1.VPCEndpoint) runtime.Object {
+	if !cfg.composesV1Beta2() {
+		return ep
+	}
+	fp := ep.Spec.ForProvider
+	return &awsv1beta2.VPCEndpoint{
+		ObjectMeta: ep.ObjectMeta,
+		Spec: awsv1beta2.VPCEndpointSpec{
+			ForProvider: awsv1beta2.VPCEndpointParameters{
+				Region:          fp.Region,
+				ServiceName:     fp.ServiceName,
+				VPCEndpointType: fp.VPCEndpointType,
+				Tags:            fp.Tags,
+				VPCIDRef:        fp.VPCIDRef,
+				VPCIDSelector:   fp.VPCIDSelector,
+			},
+			ResourceSpec: ep.Spec.ResourceSpec,
+		},
+	}
+}
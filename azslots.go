@@ -0,0 +1,132 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/names"
+)
+
+// subnetTierSlots are the subnet tiers in the order their subnets take the
+// CIDR blocks of an availability zone's slot, when spec.stableResourceKeys is
+// set. Every tier has a block reserved whether or not it's requested, so
+// adding a tier later doesn't move the subnets of the others.
+var subnetTierSlots = []string{tierPublic, tierPrivate, tierFirewall}
+
+// azSlot returns the slot of the j'th availability zone, which numbers the
+// resources composed for it. It's the zone's index in spec.availabilityZones
+// unless spec.stableResourceKeys resolved it from the observed subnets.
+func (c Config) azSlot(j int) int {
+	if s, ok := c.AZSlots[c.AvailabilityZones[j]]; ok {
+		return s
+	}
+	return j
+}
+
+// subnetBlock returns which block of a VPC's CIDR block the subnet of the
+// supplied tier in the j'th availability zone is carved from, given the number
+// of subnets planned before it. Subnets are packed tier by tier, so adding an
+// availability zone moves the subnets of every later tier. With
+// spec.stableResourceKeys each availability zone's slot instead reserves a
+// block for every tier.
+func (c Config) subnetBlock(tier string, j, planned int) int {
+	if !c.StableResourceKeys {
+		return planned
+	}
+	return c.azSlot(j)*len(subnetTierSlots) + slices.Index(subnetTierSlots, tier)
+}
+
+// subnetBlocks returns how many blocks of a VPC's CIDR block its subnets span.
+func (c Config) subnetBlocks() int {
+	azs, _ := uniqueAZs(c.AvailabilityZones)
+	tiers := len(c.subnetTiers())
+	if !c.StableResourceKeys || tiers == 0 || len(azs) == 0 {
+		return tiers * len(azs)
+	}
+	slots := len(azs)
+	for _, s := range c.AZSlots {
+		slots = max(slots, s+1)
+	}
+	return slots * len(subnetTierSlots)
+}
+
+// filledAZSlots returns the slot of each of the config's availability zones,
+// reusing those of the supplied observed subnets so that existing subnets keep
+// their names and CIDR blocks. Availability zones without subnets yet fill the
+// lowest slots that are free, in order. An availability zone inserted into the
+// middle of spec.availabilityZones therefore doesn't renumber those after it.
+func filledAZSlots(cfg Config, observed map[resource.Name]resource.ObservedComposed) map[string]int {
+	listed := map[string]bool{}
+	for _, az := range cfg.AvailabilityZones {
+		listed[az] = true
+	}
+
+	// visit subnets in a stable order, so a conflict always resolves the
+	// same way
+	keys := make([]string, 0, len(observed))
+	for name := range observed {
+		keys = append(keys, string(name))
+	}
+	sort.Strings(keys)
+
+	slots := map[string]int{}
+	taken := map[int]string{}
+	for _, key := range keys {
+		oc := observed[resource.Name(key)]
+		name := strings.TrimSuffix(oc.Resource.GetGenerateName(), "-")
+		if name == "" {
+			name = oc.Resource.GetName()
+		}
+		slot, ok := subnetSlot(cfg.ID, name)
+		if !ok {
+			continue
+		}
+		az, _ := oc.Resource.GetString("spec.forProvider.availabilityZone")
+		if !listed[az] {
+			continue
+		}
+		if other, ok := taken[slot]; ok && other != az {
+			continue
+		}
+		if s, ok := slots[az]; ok && s <= slot {
+			continue
+		}
+		slots[az], taken[slot] = slot, az
+	}
+
+	next := 0
+	for _, az := range cfg.AvailabilityZones {
+		if _, ok := slots[az]; ok {
+			continue
+		}
+		for taken[next] != "" {
+			next++
+		}
+		slots[az], taken[next] = next, az
+	}
+	return slots
+}
+
+// subnetSlot returns the availability zone slot numbering the named subnet of
+// the supplied network, and whether the name is that of one of its subnets at
+// all.
+func subnetSlot(id, name string) (int, bool) {
+	parts := strings.Split(name, "-")
+	if len(parts) < 5 {
+		return 0, false
+	}
+	n := len(parts)
+	i, err := strconv.ParseInt(parts[n-3], 10, 64)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	j, err := strconv.Atoi(parts[n-1])
+	if err != nil || j < 0 || names.SubnetName(id, i, parts[n-2], j) != name {
+		return 0, false
+	}
+	return j, true
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+
+	"github.com/jbw976/demo-xfn-network/config"
+)
+
+func TestFilledAZSlots(t *testing.T) {
+	// subnet returns an observed subnet with the supplied name and
+	// generateName in the supplied AZ.
+	subnet := func(name, generateName, az string) resource.ObservedComposed {
+		r := composed.New()
+		r.SetName(name)
+		r.SetGenerateName(generateName)
+		_ = r.SetValue("spec.forProvider.availabilityZone", az)
+		return resource.ObservedComposed{Resource: r}
+	}
+
+	cases := map[string]struct {
+		reason   string
+		azs      []string
+		observed map[resource.Name]resource.ObservedComposed
+		want     map[string]int
+	}{
+		"New": {
+			reason: "Without observed subnets each AZ should take the slot of its index",
+			azs:    []string{"us-west-2a", "us-west-2b"},
+			want:   map[string]int{"us-west-2a": 0, "us-west-2b": 1},
+		},
+		"Inserted": {
+			reason: "An AZ inserted into the middle of the list should take the lowest free slot, leaving existing AZs where they are",
+			azs:    []string{"us-west-2a", "us-west-2b", "us-west-2c"},
+			observed: map[resource.Name]resource.ObservedComposed{
+				"subnet-code-0-public-us-west-2a":  subnet("subnet-code-0-public-0", "", "us-west-2a"),
+				"subnet-code-0-public-us-west-2c":  subnet("subnet-code-0-public-1", "", "us-west-2c"),
+				"subnet-code-0-private-us-west-2c": subnet("subnet-code-0-private-1", "", "us-west-2c"),
+			},
+			want: map[string]int{"us-west-2a": 0, "us-west-2b": 2, "us-west-2c": 1},
+		},
+		"Removed": {
+			reason: "The slot of a removed AZ should be free for the next AZ added",
+			azs:    []string{"us-west-2c", "us-west-2d"},
+			observed: map[resource.Name]resource.ObservedComposed{
+				"subnet-code-0-public-us-west-2a": subnet("subnet-code-0-public-0", "", "us-west-2a"),
+				"subnet-code-0-public-us-west-2c": subnet("subnet-code-0-public-1", "", "us-west-2c"),
+			},
+			want: map[string]int{"us-west-2c": 1, "us-west-2d": 0},
+		},
+		"GenerateName": {
+			reason: "A subnet's slot should be read from its generateName prefix when it has one",
+			azs:    []string{"us-west-2a", "us-west-2b"},
+			observed: map[resource.Name]resource.ObservedComposed{
+				"resource-0123456789abcdef": subnet("subnet-code-0-public-1-x7k2p", "subnet-code-0-public-1-", "us-west-2b"),
+			},
+			want: map[string]int{"us-west-2a": 0, "us-west-2b": 1},
+		},
+		"OtherNetwork": {
+			reason: "Subnets of other networks should be ignored",
+			azs:    []string{"us-west-2a"},
+			observed: map[resource.Name]resource.ObservedComposed{
+				"subnet-other-0-public-0": subnet("subnet-other-0-public-3", "", "us-west-2a"),
+			},
+			want: map[string]int{"us-west-2a": 0},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := Config{Config: config.Config{ID: "code", AvailabilityZones: tc.azs}}
+			got := filledAZSlots(cfg, tc.observed)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nfilledAZSlots(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
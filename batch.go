@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/names"
+)
+
+// vpcBatch returns which of the network's VPCs to compose when creating at
+// most limit VPCs at once, keyed by index. Observed VPCs are always composed,
+// since no longer desiring them would delete them. Those AWS hasn't created
+// yet count against the limit, and new VPCs fill what's left of it in index
+// order.
+func vpcBatch(cfg Config, observed map[resource.Name]resource.ObservedComposed, limit int64) map[int64]bool {
+	batch := map[int64]bool{}
+	pending := int64(0)
+	indexes := cfg.vpcIndexes()
+	for _, i := range indexes {
+		oc, ok := observed[resource.Name(names.VPCName(cfg.ID, i))]
+		if !ok {
+			continue
+		}
+		batch[i] = true
+		if id, _ := oc.Resource.GetString("status.atProvider.id"); id == "" {
+			pending++
+		}
+	}
+	for _, i := range indexes {
+		if pending >= limit {
+			break
+		}
+		if !batch[i] {
+			batch[i] = true
+			pending++
+		}
+	}
+	return batch
+}
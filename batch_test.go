@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionBatches(t *testing.T) {
+	input := resource.MustStructJSON(`{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"maxVpcsPerRun": 2
+	}`)
+	xr := resource.MustStructJSON(`{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 5, "includeGateway": true}
+	}`)
+
+	// vpc returns an observed VPC, which AWS has created if it has an id.
+	vpc := func(name, id string) *fnv1.Resource {
+		return &fnv1.Resource{Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "VPC",
+			"metadata": {"name": "` + name + `"},
+			"status": {"atProvider": {"id": "` + id + `"}}
+		}`)}
+	}
+
+	type want struct {
+		desired []string
+		results []string
+	}
+
+	// The cases simulate successive reconciles of the same XR.
+	cases := map[string]struct {
+		reason   string
+		observed map[string]*fnv1.Resource
+		want     want
+	}{
+		"FirstBatch": {
+			reason: "Only the first batch of VPCs and their gateways should be composed before any exist",
+			want: want{
+				desired: []string{"gateway-code-0", "gateway-code-1", "vpc-code-0", "vpc-code-1"},
+				results: []string{"Creating VPCs in batches of 2; 3 of 5 VPCs are deferred until earlier VPCs are created"},
+			},
+		},
+		"FirstBatchInProgress": {
+			reason: "A VPC that's observed but not yet created should hold its place in the batch",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": vpc("vpc-code-0", "vpc-0000"),
+				"vpc-code-1": vpc("vpc-code-1", ""),
+			},
+			want: want{
+				desired: []string{"gateway-code-0", "gateway-code-1", "gateway-code-2", "vpc-code-0", "vpc-code-1", "vpc-code-2"},
+				results: []string{"Creating VPCs in batches of 2; 2 of 5 VPCs are deferred until earlier VPCs are created"},
+			},
+		},
+		"FinalBatch": {
+			reason: "The remaining VPCs should be composed once earlier VPCs are created",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": vpc("vpc-code-0", "vpc-0000"),
+				"vpc-code-1": vpc("vpc-code-1", "vpc-0001"),
+				"vpc-code-2": vpc("vpc-code-2", "vpc-0002"),
+			},
+			want: want{
+				desired: []string{
+					"gateway-code-0", "gateway-code-1", "gateway-code-2", "gateway-code-3", "gateway-code-4",
+					"vpc-code-0", "vpc-code-1", "vpc-code-2", "vpc-code-3", "vpc-code-4",
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input: input,
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: xr},
+					Resources: tc.observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			got := []string{}
+			for _, r := range DesiredResourcesSorted(rsp) {
+				got = append(got, r.Name)
+			}
+			if diff := cmp.Diff(tc.want.desired, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want desired, +got desired:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/binary"
+	mathbits "math/bits"
+	"net/netip"
+
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/config"
+)
+
+// validateIPv4CIDR returns an error if the supplied string isn't an IPv4 CIDR
+// block.
+func validateIPv4CIDR(block string) error {
+	p, err := netip.ParsePrefix(block)
+	if err != nil {
+		return errors.Wrapf(err, "cannot parse CIDR block %q", block)
+	}
+	if !p.Addr().Is4() {
+		return errors.Errorf("CIDR block %q is not an IPv4 block", block)
+	}
+	return nil
+}
+
+// validateVPCCIDR returns an error if the supplied string isn't an IPv4 CIDR
+// block between /16 and /28, the sizes AWS allows for a VPC.
+func validateVPCCIDR(block string) error {
+	if err := validateIPv4CIDR(block); err != nil {
+		return err
+	}
+	if bits := netip.MustParsePrefix(block).Bits(); bits < config.MinVPCPrefixLength || bits > config.MaxVPCPrefixLength {
+		return errors.Errorf("CIDR block %q must be between /%d and /%d", block, config.MinVPCPrefixLength, config.MaxVPCPrefixLength)
+	}
+	return nil
+}
+
+// checkSubnetsFit returns an error if n subnets with prefix length subnetBits
+// can't be carved from a block with prefix length bits.
+func checkSubnetsFit(bits, subnetBits, n int) error {
+	if n == 0 {
+		return nil
+	}
+	if subnetBits < bits {
+		return errors.Errorf("cannot carve /%d subnets from a /%d block", subnetBits, bits)
+	}
+	if room := uint64(1) << (subnetBits - bits); uint64(n) > room {
+		return errors.Errorf("a /%d block has room for %d /%d subnets, not %d", bits, room, subnetBits, n)
+	}
+	return nil
+}
+
+// awsReservedIPs is how many addresses AWS reserves in every subnet: the
+// network address, the VPC router, DNS, one for future use, and the broadcast
+// address.
+const awsReservedIPs = 5
+
+// availableIPs returns how many addresses of the supplied IPv4 subnet CIDR
+// block instances can use, which is all of them less those AWS reserves.
+func availableIPs(block string) (int64, error) {
+	p, err := netip.ParsePrefix(block)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot parse CIDR block %q", block)
+	}
+	if !p.Addr().Is4() {
+		return 0, errors.Errorf("CIDR block %q is not an IPv4 CIDR block", block)
+	}
+	return max(int64(1)<<(32-p.Bits())-awsReservedIPs, 0), nil
+}
+
+// subnetCIDR returns the num'th subnet of the supplied IPv4 CIDR block that has
+// the supplied prefix length. For example the 2nd /24 of 192.168.0.0/16 is
+// 192.168.2.0/24.
+func subnetCIDR(block string, bits, num int) (string, error) {
+	p, err := netip.ParsePrefix(block)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot parse CIDR block %q", block)
+	}
+	if !p.Addr().Is4() {
+		return "", errors.Errorf("CIDR block %q is not an IPv4 block", block)
+	}
+	p = p.Masked()
+	if bits < p.Bits() || bits > 32 {
+		return "", errors.Errorf("cannot carve /%d subnets from CIDR block %q", bits, block)
+	}
+	if num < 0 || uint64(num) >= uint64(1)<<(bits-p.Bits()) {
+		return "", errors.Errorf("CIDR block %q has no room for /%d subnet %d", block, bits, num)
+	}
+
+	base := binary.BigEndian.Uint32(p.Addr().AsSlice())
+	var a [4]byte
+	binary.BigEndian.PutUint32(a[:], base+uint32(num)<<(32-bits))
+	return netip.PrefixFrom(netip.AddrFrom4(a), bits).String(), nil
+}
+
+// vpcPrefixLength returns the prefix length of the CIDR blocks that evenly
+// divide the supplied IPv4 block among count VPCs. For example a /16 divided
+// among 4 VPCs gives /18s. Blocks are never larger than /16, the largest AWS
+// allows for a VPC.
+func vpcPrefixLength(block string, count int64) (int, error) {
+	p, err := netip.ParsePrefix(block)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot parse CIDR block %q", block)
+	}
+	if count < 1 {
+		return 0, errors.Errorf("cannot divide CIDR block %q among %d VPCs", block, count)
+	}
+	bits := p.Bits() + mathbits.Len64(uint64(count-1))
+	if bits < config.MinVPCPrefixLength {
+		bits = config.MinVPCPrefixLength
+	}
+	if bits > config.MaxVPCPrefixLength {
+		return 0, errors.Errorf("CIDR block %q is too small to divide among %d VPCs", block, count)
+	}
+	return bits, nil
+}
+
+// ipv6SubnetCIDR returns the num'th subnet of the supplied IPv6 CIDR block that
+// has the supplied prefix length. For example the 2nd /64 of 2001:db8::/56 is
+// 2001:db8:0:2::/64.
+func ipv6SubnetCIDR(block string, bits, num int) (string, error) {
+	p, err := netip.ParsePrefix(block)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot parse CIDR block %q", block)
+	}
+	if !p.Addr().Is6() || p.Addr().Is4In6() {
+		return "", errors.Errorf("CIDR block %q is not an IPv6 block", block)
+	}
+	p = p.Masked()
+	if bits < p.Bits() || bits > 128 {
+		return "", errors.Errorf("cannot carve /%d subnets from CIDR block %q", bits, block)
+	}
+	if num < 0 || (bits-p.Bits() < 63 && uint64(num) >= uint64(1)<<(bits-p.Bits())) {
+		return "", errors.Errorf("CIDR block %q has no room for /%d subnet %d", block, bits, num)
+	}
+
+	// add num, shifted into place, to the block's 128 bit address
+	a := p.Addr().As16()
+	hi, lo := binary.BigEndian.Uint64(a[:8]), binary.BigEndian.Uint64(a[8:])
+	shift := uint(128 - bits)
+	var addHi, addLo uint64
+	if shift >= 64 {
+		addHi = uint64(num) << (shift - 64)
+	} else {
+		addHi, addLo = uint64(num)>>(64-shift), uint64(num)<<shift
+	}
+	lo, carry := mathbits.Add64(lo, addLo, 0)
+	hi, _ = mathbits.Add64(hi, addHi, carry)
+	binary.BigEndian.PutUint64(a[:8], hi)
+	binary.BigEndian.PutUint64(a[8:], lo)
+	return netip.PrefixFrom(netip.AddrFrom16(a), bits).String(), nil
+}
+
+// freeCIDRs returns the fewest CIDR blocks that together cover the parts of
+// the supplied IPv4 block that none of the used blocks cover, in address
+// order. It also returns the percentage of the block they cover.
+func freeCIDRs(block string, used []string) ([]string, float64, error) {
+	p, err := netip.ParsePrefix(block)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot parse CIDR block %q", block)
+	}
+	if !p.Addr().Is4() {
+		return nil, 0, errors.Errorf("CIDR block %q is not an IPv4 block", block)
+	}
+	p = p.Masked()
+	usedPrefixes := make([]netip.Prefix, len(used))
+	for i, u := range used {
+		up, err := netip.ParsePrefix(u)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "cannot parse CIDR block %q", u)
+		}
+		usedPrefixes[i] = up.Masked()
+	}
+
+	free := unusedPrefixes(p, usedPrefixes)
+	out := make([]string, len(free))
+	size := uint64(0)
+	for i, f := range free {
+		out[i] = f.String()
+		size += uint64(1) << (32 - f.Bits())
+	}
+	return out, float64(size) / float64(uint64(1)<<(32-p.Bits())) * 100, nil
+}
+
+// unusedPrefixes returns the parts of the supplied prefix that none of the
+// used prefixes cover. It halves the prefix until each half is either
+// entirely covered, or not covered at all.
+func unusedPrefixes(p netip.Prefix, used []netip.Prefix) []netip.Prefix {
+	overlaps := false
+	for _, u := range used {
+		if u.Bits() <= p.Bits() && u.Contains(p.Addr()) {
+			return nil
+		}
+		if u.Overlaps(p) {
+			overlaps = true
+		}
+	}
+	if !overlaps {
+		return []netip.Prefix{p}
+	}
+
+	// a /32 is either covered or not, so only larger prefixes get here
+	lo := netip.PrefixFrom(p.Addr(), p.Bits()+1)
+	base := binary.BigEndian.Uint32(p.Addr().AsSlice())
+	var a [4]byte
+	binary.BigEndian.PutUint32(a[:], base+uint32(1)<<(31-p.Bits()))
+	hi := netip.PrefixFrom(netip.AddrFrom4(a), p.Bits()+1)
+	return append(unusedPrefixes(lo, used), unusedPrefixes(hi, used)...)
+}
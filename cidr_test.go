@@ -0,0 +1,317 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSubnetCIDR(t *testing.T) {
+	type args struct {
+		block string
+		bits  int
+		num   int
+	}
+	type want struct {
+		cidr string
+		err  bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"FirstSubnet": {
+			reason: "The first subnet should start at the beginning of the block",
+			args:   args{block: "192.168.0.0/16", bits: 24, num: 0},
+			want:   want{cidr: "192.168.0.0/24"},
+		},
+		"LaterSubnet": {
+			reason: "Later subnets should be packed contiguously after the first",
+			args:   args{block: "192.168.0.0/16", bits: 24, num: 3},
+			want:   want{cidr: "192.168.3.0/24"},
+		},
+		"UnmaskedBlock": {
+			reason: "Host bits set in the block should be ignored",
+			args:   args{block: "10.1.2.3/16", bits: 20, num: 1},
+			want:   want{cidr: "10.1.16.0/20"},
+		},
+		"OutOfRoom": {
+			reason: "Asking for a subnet beyond the end of the block should return an error",
+			args:   args{block: "192.168.0.0/16", bits: 24, num: 256},
+			want:   want{err: true},
+		},
+		"SubnetLargerThanBlock": {
+			reason: "Asking for subnets larger than the block should return an error",
+			args:   args{block: "192.168.0.0/24", bits: 16, num: 0},
+			want:   want{err: true},
+		},
+		"NotACIDR": {
+			reason: "A malformed block should return an error",
+			args:   args{block: "192.168.0.0", bits: 24, num: 0},
+			want:   want{err: true},
+		},
+		"IPv6": {
+			reason: "An IPv6 block should return an error",
+			args:   args{block: "2001:db8::/56", bits: 64, num: 0},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := subnetCIDR(tc.args.block, tc.args.bits, tc.args.num)
+
+			if diff := cmp.Diff(tc.want.cidr, got); diff != "" {
+				t.Errorf("%s\nsubnetCIDR(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != (err != nil) {
+				t.Errorf("%s\nsubnetCIDR(...): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+		})
+	}
+}
+
+func TestIPv6SubnetCIDR(t *testing.T) {
+	type args struct {
+		block string
+		bits  int
+		num   int
+	}
+	type want struct {
+		cidr string
+		err  bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"FirstSubnet": {
+			reason: "The first /64 should start at the beginning of the /56",
+			args:   args{block: "2600:1f18:abcd:1200::/56", bits: 64, num: 0},
+			want:   want{cidr: "2600:1f18:abcd:1200::/64"},
+		},
+		"LaterSubnet": {
+			reason: "Later /64s should follow the first by index",
+			args:   args{block: "2600:1f18:abcd:1200::/56", bits: 64, num: 10},
+			want:   want{cidr: "2600:1f18:abcd:120a::/64"},
+		},
+		"AcrossHalves": {
+			reason: "Subnets smaller than /64 should carry into the upper half of the address",
+			args:   args{block: "2001:db8::/56", bits: 72, num: 256},
+			want:   want{cidr: "2001:db8:0:1::/72"},
+		},
+		"OutOfRoom": {
+			reason: "A /56 only has room for 256 /64s",
+			args:   args{block: "2600:1f18:abcd:1200::/56", bits: 64, num: 256},
+			want:   want{err: true},
+		},
+		"IPv4": {
+			reason: "An IPv4 block should return an error",
+			args:   args{block: "192.168.0.0/16", bits: 24, num: 0},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ipv6SubnetCIDR(tc.args.block, tc.args.bits, tc.args.num)
+
+			if diff := cmp.Diff(tc.want.cidr, got); diff != "" {
+				t.Errorf("%s\nipv6SubnetCIDR(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != (err != nil) {
+				t.Errorf("%s\nipv6SubnetCIDR(...): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+		})
+	}
+}
+
+func TestVPCPrefixLength(t *testing.T) {
+	type args struct {
+		block string
+		count int64
+	}
+	type want struct {
+		bits int
+		err  bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"EvenlyDivided": {
+			reason: "A /16 divided among 4 VPCs should give /18s",
+			args:   args{block: "10.0.0.0/16", count: 4},
+			want:   want{bits: 18},
+		},
+		"RoundedUp": {
+			reason: "A /16 divided among 3 VPCs should give /18s, leaving one unused",
+			args:   args{block: "10.0.0.0/16", count: 3},
+			want:   want{bits: 18},
+		},
+		"OneVPC": {
+			reason: "A single VPC should get the whole block",
+			args:   args{block: "10.0.0.0/20", count: 1},
+			want:   want{bits: 20},
+		},
+		"LargeBase": {
+			reason: "VPCs should be no larger than the /16 AWS allows",
+			args:   args{block: "10.0.0.0/8", count: 4},
+			want:   want{bits: 16},
+		},
+		"TooSmall": {
+			reason: "A block that can't be divided into VPCs of at least /28 should return an error",
+			args:   args{block: "10.0.0.0/24", count: 17},
+			want:   want{err: true},
+		},
+		"NoVPCs": {
+			reason: "A block can't be divided among zero VPCs",
+			args:   args{block: "10.0.0.0/16", count: 0},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := vpcPrefixLength(tc.args.block, tc.args.count)
+
+			if diff := cmp.Diff(tc.want.bits, got); diff != "" {
+				t.Errorf("%s\nvpcPrefixLength(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != (err != nil) {
+				t.Errorf("%s\nvpcPrefixLength(...): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+		})
+	}
+}
+
+func TestFreeCIDRs(t *testing.T) {
+	type args struct {
+		block string
+		used  []string
+	}
+	type want struct {
+		cidrs   []string
+		percent float64
+		err     bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Unused": {
+			reason: "A block without subnets should be entirely free",
+			args:   args{block: "10.0.0.0/16"},
+			want:   want{cidrs: []string{"10.0.0.0/16"}, percent: 100},
+		},
+		"PartiallyCarved": {
+			reason: "The space after the first subnets should be covered by the fewest blocks",
+			args:   args{block: "10.0.0.0/16", used: []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"}},
+			want: want{
+				cidrs:   []string{"10.0.4.0/22", "10.0.8.0/21", "10.0.16.0/20", "10.0.32.0/19", "10.0.64.0/18", "10.0.128.0/17"},
+				percent: 98.4375,
+			},
+		},
+		"Gap": {
+			reason: "Space between subnets should be reported in address order",
+			args:   args{block: "10.0.0.0/22", used: []string{"10.0.0.0/24", "10.0.3.0/24"}},
+			want:   want{cidrs: []string{"10.0.1.0/24", "10.0.2.0/24"}, percent: 50},
+		},
+		"FullyCarved": {
+			reason: "A block covered by a subnet should have no free space",
+			args:   args{block: "10.0.0.0/24", used: []string{"10.0.0.0/24"}},
+			want:   want{cidrs: []string{}},
+		},
+		"NotACIDR": {
+			reason: "A malformed subnet should return an error",
+			args:   args{block: "10.0.0.0/16", used: []string{"10.0.0.0"}},
+			want:   want{err: true},
+		},
+		"IPv6": {
+			reason: "An IPv6 block should return an error",
+			args:   args{block: "2001:db8::/56"},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cidrs, percent, err := freeCIDRs(tc.args.block, tc.args.used)
+
+			if diff := cmp.Diff(tc.want.cidrs, cidrs); diff != "" {
+				t.Errorf("%s\nfreeCIDRs(...): -want CIDRs, +got CIDRs:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.percent, percent); diff != "" {
+				t.Errorf("%s\nfreeCIDRs(...): -want percent, +got percent:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != (err != nil) {
+				t.Errorf("%s\nfreeCIDRs(...): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+		})
+	}
+}
+
+func TestAvailableIPs(t *testing.T) {
+	type want struct {
+		n   int64
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		block  string
+		want   want
+	}{
+		"Slash24": {
+			reason: "A /24 should have 251 usable addresses once AWS reserves 5",
+			block:  "192.168.0.0/24",
+			want:   want{n: 251},
+		},
+		"Slash28": {
+			reason: "The smallest subnet AWS allows should have 11 usable addresses",
+			block:  "10.0.0.16/28",
+			want:   want{n: 11},
+		},
+		"Slash16": {
+			reason: "A /16 should have 65531 usable addresses",
+			block:  "10.0.0.0/16",
+			want:   want{n: 65531},
+		},
+		"Slash30": {
+			reason: "A block smaller than AWS reserves should have none",
+			block:  "10.0.0.0/30",
+			want:   want{n: 0},
+		},
+		"NotACIDR": {
+			reason: "A malformed block should return an error",
+			block:  "192.168.0.0",
+			want:   want{err: true},
+		},
+		"IPv6": {
+			reason: "An IPv6 block should return an error",
+			block:  "2001:db8::/64",
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := availableIPs(tc.block)
+
+			if diff := cmp.Diff(tc.want.n, got); diff != "" {
+				t.Errorf("%s\navailableIPs(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != (err != nil) {
+				t.Errorf("%s\navailableIPs(...): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+		})
+	}
+}
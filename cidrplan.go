@@ -0,0 +1,33 @@
+package main
+
+import (
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/input/v1beta1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// extraResourceCIDRPlan is the key of the CIDR allocation plan among the extra
+// resources the function requires.
+const extraResourceCIDRPlan = "cidr-plan"
+
+// requireCIDRPlan asks Crossplane to supply the ConfigMap holding the CIDR
+// allocation plan as an extra resource.
+func requireCIDRPlan(rsp *fnv1.RunFunctionResponse, p v1beta1.CIDRPlan) {
+	requireResource(rsp, extraResourceCIDRPlan, "v1", "ConfigMap", p.ConfigMapName)
+}
+
+// plannedCIDR returns the CIDR block the supplied extra resources' allocation
+// plan assigns to the network with the supplied ID. It returns false if
+// Crossplane hasn't supplied the plan, or the plan has no entry for the
+// network.
+func plannedCIDR(extra map[string][]resource.Extra, id string) (string, bool) {
+	items := extra[extraResourceCIDRPlan]
+	if len(items) == 0 {
+		return "", false
+	}
+	cidr, _, _ := unstructured.NestedString(items[0].Resource.Object, "data", id)
+	return cidr, cidr != ""
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/names"
+)
+
+func TestRunFunctionCIDRPlan(t *testing.T) {
+	input := `{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"cidrPlan": {"configMapName": "network-cidrs"}
+	}`
+	xr := `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {
+			"id": "code",
+			"count": 1,
+			"region": "eu-central-1",
+			"cidrBlock": "192.168.0.0/16",
+			"providerConfigName": "default"
+		}
+	}`
+	plan := func(data string) *fnv1.Resources {
+		return &fnv1.Resources{Items: []*fnv1.Resource{{Resource: resource.MustStructJSON(`{
+			"apiVersion": "v1",
+			"kind": "ConfigMap",
+			"metadata": {"name": "network-cidrs"},
+			"data": ` + data + `
+		}`)}}}
+	}
+
+	cases := map[string]struct {
+		reason string
+		extra  map[string]*fnv1.Resources
+		want   string
+	}{
+		"NotYetSupplied": {
+			reason: "The XR's CIDR block should be used until Crossplane supplies the plan",
+			want:   "192.168.0.0/16",
+		},
+		"Missing": {
+			reason: "The XR's CIDR block should be used when the plan doesn't exist",
+			extra:  map[string]*fnv1.Resources{extraResourceCIDRPlan: {}},
+			want:   "192.168.0.0/16",
+		},
+		"NotPlanned": {
+			reason: "The XR's CIDR block should be used when the plan has no entry for the network",
+			extra:  map[string]*fnv1.Resources{extraResourceCIDRPlan: plan(`{"other": "10.2.0.0/16"}`)},
+			want:   "192.168.0.0/16",
+		},
+		"Planned": {
+			reason: "The plan's CIDR block should take precedence over the XR's",
+			extra:  map[string]*fnv1.Resources{extraResourceCIDRPlan: plan(`{"code": "10.1.0.0/16"}`)},
+			want:   "10.1.0.0/16",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input:          resource.MustStructJSON(input),
+				Observed:       &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)}},
+				ExtraResources: tc.extra,
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			wantReq := &fnv1.Requirements{ExtraResources: map[string]*fnv1.ResourceSelector{
+				extraResourceCIDRPlan: {
+					ApiVersion: "v1",
+					Kind:       "ConfigMap",
+					Match:      &fnv1.ResourceSelector_MatchName{MatchName: "network-cidrs"},
+				},
+			}}
+			if diff := cmp.Diff(wantReq, rsp.GetRequirements(), protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want requirements, +got requirements:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff([]string(nil), resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+
+			vpc, ok := rsp.GetDesired().GetResources()[names.VPCName("code", 0)]
+			if !ok {
+				t.Fatalf("%s\nf.RunFunction(...): no desired VPC", tc.reason)
+			}
+			got, err := fieldpath.Pave(vpc.GetResource().AsMap()).GetString("spec.forProvider.cidrBlock")
+			if err != nil {
+				t.Fatalf("%s\nGetString(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want cidrBlock, +got cidrBlock:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
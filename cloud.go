@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jbw976/demo-xfn-network/config"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// A CloudResource is a managed resource of a cloud provider, such as an AWS
+// VPC.
+type CloudResource interface {
+	metav1.Object
+	runtime.Object
+}
+
+// A CloudProvider builds the resources of a network that map onto each cloud,
+// like a network and the gateway that connects it to the internet.
+type CloudProvider interface {
+	// Network returns the named network, such as an AWS VPC or a GCP
+	// Network, with the supplied role.
+	Network(cfg Config, name, role string) CloudResource
+
+	// Gateway returns the named internet gateway, such as an AWS
+	// InternetGateway or a GCP Router, of the named network.
+	Gateway(cfg Config, name, networkName string) CloudResource
+}
+
+// awsProvider builds networks of AWS resources.
+type awsProvider struct{}
+
+// Network returns the named VPC.
+func (awsProvider) Network(cfg Config, name, role string) CloudResource {
+	return newVPC(cfg, name, role)
+}
+
+// Gateway returns the named InternetGateway, attached to the named VPC.
+func (awsProvider) Gateway(cfg Config, name, networkName string) CloudResource {
+	return newGateway(cfg, name, networkName)
+}
+
+// cloudProvider returns the provider of the supplied spec.cloud. It returns a
+// ValidationError if the function has none.
+func (f *Function) cloudProvider(cloud string) (CloudProvider, error) {
+	clouds := f.clouds
+	if clouds == nil {
+		clouds = map[string]CloudProvider{config.CloudAWS: awsProvider{}}
+	}
+	if p, ok := clouds[cloud]; ok {
+		return p, nil
+	}
+	supported := make([]string, 0, len(clouds))
+	for name := range clouds {
+		supported = append(supported, name)
+	}
+	sort.Strings(supported)
+	return nil, &ValidationError{Field: "spec.cloud", Reason: fmt.Sprintf("unsupported cloud %q; must be one of %s", cloud, strings.Join(supported, ", "))}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/jbw976/demo-xfn-network/config"
+)
+
+// stubProvider builds bare AWS resources, annotated so they can be told apart
+// from those of the AWS provider.
+type stubProvider struct{}
+
+func (stubProvider) Network(_ Config, name, _ string) CloudResource {
+	return &awsv1beta1.VPC{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{"cloud": "stub"}}}
+}
+
+func (stubProvider) Gateway(_ Config, name, _ string) CloudResource {
+	return &awsv1beta1.InternetGateway{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{"cloud": "stub"}}}
+}
+
+func TestRunFunctionCloud(t *testing.T) {
+	xr := func(cloud string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "code", "count": 1, "includeGateway": true, "cloud": "` + cloud + `"}
+		}`
+	}
+	run := func(t *testing.T, f *Function, xr string) *fnv1.RunFunctionResponse {
+		t.Helper()
+		req := &fnv1.RunFunctionRequest{
+			Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)}},
+		}
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("f.RunFunction(...): unexpected error: %v", err)
+		}
+		return rsp
+	}
+
+	t.Run("AWSByDefault", func(t *testing.T) {
+		f := &Function{log: logging.NewNopLogger()}
+		want := run(t, f, xr(""))
+		got := run(t, f, xr("aws"))
+		if diff := cmp.Diff(want.GetDesired(), got.GetDesired(), protocmp.Transform()); diff != "" {
+			t.Errorf("The AWS provider should compose exactly what an XR without spec.cloud does\nf.RunFunction(...): -want desired, +got desired:\n%s", diff)
+		}
+	})
+
+	clouds := map[string]CloudProvider{config.CloudAWS: awsProvider{}, "stub": stubProvider{}}
+
+	cases := map[string]struct {
+		reason      string
+		cloud       string
+		annotations map[string]string
+		results     []string
+	}{
+		"AWS": {
+			reason:      "The AWS provider should build the network and gateway when selected",
+			cloud:       "aws",
+			annotations: map[string]string{},
+		},
+		"Stub": {
+			reason: "The selected provider should build the network and gateway",
+			cloud:  "stub",
+			annotations: map[string]string{
+				"vpc-code-0":     "stub",
+				"gateway-code-0": "stub",
+			},
+		},
+		"Unsupported": {
+			reason:      "A cloud the function has no provider for should return a fatal result",
+			cloud:       "gcp",
+			annotations: map[string]string{},
+			results:     []string{`invalid network config: spec.cloud: unsupported cloud "gcp"; must be one of aws, stub`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := run(t, &Function{log: logging.NewNopLogger(), clouds: clouds}, xr(tc.cloud))
+
+			if diff := cmp.Diff(tc.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.annotations, desiredStrings(t, rsp, "metadata.annotations.cloud")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want annotations, +got annotations:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
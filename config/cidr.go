@@ -0,0 +1,34 @@
+package config
+
+import (
+	"net/netip"
+
+	"github.com/pkg/errors"
+)
+
+// validateIPv4CIDR returns an error if the supplied string isn't an IPv4 CIDR
+// block.
+func validateIPv4CIDR(block string) error {
+	p, err := netip.ParsePrefix(block)
+	if err != nil {
+		return errors.Wrapf(err, "cannot parse CIDR block %q", block)
+	}
+	if !p.Addr().Is4() {
+		return errors.Errorf("CIDR block %q is not an IPv4 block", block)
+	}
+	return nil
+}
+
+// cidrWithin returns true if the supplied IPv4 CIDR block lies entirely within
+// the supplied pool.
+func cidrWithin(block, pool string) (bool, error) {
+	b, err := netip.ParsePrefix(block)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot parse CIDR block %q", block)
+	}
+	p, err := netip.ParsePrefix(pool)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot parse CIDR block %q", pool)
+	}
+	return p.Bits() <= b.Bits() && p.Masked().Contains(b.Addr()), nil
+}
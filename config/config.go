@@ -0,0 +1,485 @@
+// Package config reads the network configuration of an XNetwork, applying the
+// same parsing and defaults as the function. Other functions in a pipeline can
+// use it to interpret an XR exactly as the function does. It doesn't validate
+// the configuration beyond what parsing requires.
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/input/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// Defaults of optional XR fields.
+const (
+	DefaultRegion             = "eu-central-1"
+	DefaultProviderConfigName = "default"
+	DefaultCIDRBlock          = "192.168.0.0/16"
+)
+
+// MinVPCPrefixLength and MaxVPCPrefixLength bound the size of a VPC's CIDR
+// block, per AWS.
+const (
+	MinVPCPrefixLength = 16
+	MaxVPCPrefixLength = 28
+)
+
+// The modes of spec.mode. In compose mode the function composes the network's
+// resources. In report mode it composes nothing, and only reports on the
+// observed composed resources of the XR, wherever they came from.
+const (
+	ModeCompose = "compose"
+	ModeReport  = "report"
+)
+
+// CloudAWS is the spec.cloud of networks composed of AWS resources, which is
+// the default.
+const CloudAWS = "aws"
+
+// The NAT gateway strategies of spec.natGatewayStrategy.
+const (
+	// NATStrategySingle places one NAT gateway in each VPC, shared by all of
+	// its AZs. It's cheaper, but an outage of its AZ cuts off the others.
+	NATStrategySingle = "single"
+
+	// NATStrategyPerAZ places a NAT gateway in each AZ of each VPC, used only
+	// by the private subnets of that AZ.
+	NATStrategyPerAZ = "per-az"
+)
+
+// Labels read from the XR as a fallback for unset spec fields, for
+// compositions that configure networks by label.
+const (
+	labelCount  = "networks.meta.fn.crossplane.io/count"
+	labelRegion = "networks.meta.fn.crossplane.io/region"
+)
+
+// Config is the network configuration read from the observed XR, with all
+// defaults applied.
+type Config struct {
+	ID                        string
+	Count                     int64
+	IncludeGateway            bool
+	Region                    string
+	RegionOverrides           map[string]string
+	ProviderConfigName        string
+	CIDRBlock                 string
+	AvailabilityZones         []string
+	PublicSubnets             bool
+	PrivateSubnets            bool
+	CreateDBSubnetGroup       bool
+	Tags                      map[string]string
+	GatewayRefByName          bool
+	WriteConnectionSecrets    bool
+	ConnectionSecretNamespace string
+	GatewayVPCSelector        map[string]string
+	GatewayProviderConfigName string
+	ProviderConfigs           []string
+	PublicSubnetTags          map[string]string
+	PrivateSubnetTags         map[string]string
+	IPv4IPAMPoolID            string
+	IPv4NetmaskLength         int64
+	EnableIPv6                bool
+	PrimaryVPCIndex           int64
+	Strict                    bool
+	PrefixList                *PrefixList
+	DivideCIDRBlock           bool
+	IGWRouteCIDRs             []string
+	DisableManagedLabels      bool
+	LockdownDefaultSG         bool
+	EmitGraph                 bool
+	VPCIDLabels               map[int64]string
+	UseGenerateName           bool
+	ReadyTimeout              time.Duration
+	ExpiresAfter              time.Duration
+	ReportFreeAddressSpace    bool
+	ReportEffectiveConfig     bool
+	ReportSubnets             bool
+	ResourceNameOverrides     map[string]string
+	StableResourceKeys        bool
+	HashResourceKeys          bool
+	Mode                      string
+	Cloud                     string
+	Topology                  string
+	ClusterName               string
+	Environment               string
+	MaxAZs                    int64
+	MaxSubnetsPerAZ           int64
+	SubnetAlignment           int64
+	DeleteResources           []string
+	PrivateVPCIndexes         []int64
+	GatewayVPCIndexes         []int64
+	EmitSpecHash              bool
+	OwnerReference            *metav1.OwnerReference
+	DefaultEgressCIDR         string
+	S3GatewayEndpoint         bool
+	PredictableVPCNames       bool
+	MinCIDRPrefixLength       int64
+	PrivateRouteTablePerAZ    bool
+	NATGatewayStrategy        string
+	DeletionOrdering          bool
+	EmitDiff                  bool
+	EmitStatusPatch           bool
+	FillIndexGaps             bool
+	PublicSubnetAutoAssignIP  bool
+	FirewallSubnets           bool
+	EnableNetworkFirewall     bool
+
+	// Defaulted lists the spec fields that were unset, so took a default.
+	Defaulted []DefaultedField
+
+	// TopologyConflicts lists the spec fields that were set, but ignored
+	// because spec.topology overrides them.
+	TopologyConflicts []string
+}
+
+// A DefaultedField is a spec field that was unset, and the default it took.
+type DefaultedField struct {
+	Field string
+	Value string
+}
+
+// Defaults are deployment-wide values used for optional XR fields that are
+// unset. Any zero fields fall back to this package's built in defaults.
+type Defaults struct {
+	Region             string
+	ProviderConfigName string
+	CIDRBlock          string
+}
+
+// Parse reads the network configuration from the supplied XR, applying the
+// same parsing and defaults as the Function with an empty input and no
+// deployment-wide defaults. It doesn't validate the configuration.
+func Parse(oxr *resource.Composite) (Config, error) {
+	return ParseWithInput(oxr, &v1beta1.Input{}, Defaults{})
+}
+
+// ParseWithInput reads the network configuration from the supplied XR and
+// Function input, defaulting any optional fields that are unset. The count and
+// region fall back to the XR's labels when they're unset in its spec. If the XR
+// sets no region at all the input may infer one from the provider config's
+// name. The input may also map region aliases to regions, and default the CIDR
+// block by region or select it from the pool of the XR's environment.
+func ParseWithInput(oxr *resource.Composite, in *v1beta1.Input, d Defaults) (Config, error) {
+	cfg := Config{
+		Region:              DefaultRegion,
+		ProviderConfigName:  DefaultProviderConfigName,
+		CIDRBlock:           DefaultCIDRBlock,
+		MinCIDRPrefixLength: MinVPCPrefixLength,
+		Mode:                ModeCompose,
+		Cloud:               CloudAWS,
+	}
+	if in.MinCIDRPrefixLength != nil {
+		cfg.MinCIDRPrefixLength = *in.MinCIDRPrefixLength
+	}
+	if d.Region != "" {
+		cfg.Region = d.Region
+	}
+	if d.ProviderConfigName != "" {
+		cfg.ProviderConfigName = d.ProviderConfigName
+	}
+	if d.CIDRBlock != "" {
+		cfg.CIDRBlock = d.CIDRBlock
+	}
+
+	labels := oxr.Resource.GetLabels()
+	regionSet := false
+	if region := labels[labelRegion]; region != "" {
+		cfg.Region, regionSet = region, true
+	}
+	if count, ok := labels[labelCount]; ok {
+		n, err := strconv.ParseInt(count, 10, 64)
+		if err != nil {
+			return Config{}, &ValidationError{Field: fmt.Sprintf("metadata.labels[%s]", labelCount), Reason: err.Error()}
+		}
+		cfg.Count = n
+	}
+
+	cfg.ID, _ = oxr.Resource.GetString("spec.id")
+	if cfg.ID == "" {
+		// unlike a missing XR, an XR without an ID is a mistake
+		return Config{}, &ValidationError{Field: "spec.id", Reason: "must be set"}
+	}
+	if _, err := oxr.Resource.GetValue("spec.count"); err == nil {
+		cfg.Count, _ = oxr.Resource.GetInteger("spec.count")
+	}
+	cfg.IncludeGateway, _ = oxr.Resource.GetBool("spec.includeGateway")
+	if region, _ := oxr.Resource.GetString("spec.region"); region != "" {
+		cfg.Region, regionSet = region, true
+	}
+	if pc, _ := oxr.Resource.GetString("spec.providerConfigName"); pc != "" {
+		cfg.ProviderConfigName = pc
+	}
+	if !regionSet && in.ProviderConfigRegion != nil {
+		region, err := inferRegion(*in.ProviderConfigRegion, cfg.ProviderConfigName)
+		if err != nil {
+			return Config{}, errors.Wrap(err, "cannot infer region from provider config")
+		}
+		if region != "" {
+			cfg.Region = region
+		}
+	}
+	if len(in.RegionAliases) > 0 {
+		region, err := resolveRegionAlias(in.RegionAliases, cfg.Region)
+		if err != nil {
+			return Config{}, &ValidationError{Field: "spec.region", Reason: err.Error()}
+		}
+		cfg.Region = region
+	}
+	cfg.RegionOverrides, _ = oxr.Resource.GetStringObject("spec.regionOverrides")
+	if len(in.RegionAliases) > 0 && len(cfg.RegionOverrides) > 0 {
+		overrides := make(map[string]string, len(cfg.RegionOverrides))
+		for kind, region := range cfg.RegionOverrides {
+			r, err := resolveRegionAlias(in.RegionAliases, region)
+			if err != nil {
+				return Config{}, &ValidationError{Field: fmt.Sprintf("spec.regionOverrides[%s]", kind), Reason: err.Error()}
+			}
+			overrides[kind] = r
+		}
+		cfg.RegionOverrides = overrides
+	}
+	if cidr, ok := in.RegionCIDRDefaults[cfg.Region]; ok {
+		cfg.CIDRBlock = cidr
+	}
+	cfg.Environment, _ = oxr.Resource.GetString("spec.environment")
+	pool := ""
+	if cfg.Environment != "" {
+		p, ok := in.EnvironmentCIDRPools[cfg.Environment]
+		if !ok {
+			return Config{}, &ValidationError{Field: "spec.environment", Reason: fmt.Sprintf("the Function input has no CIDR pool for environment %q", cfg.Environment)}
+		}
+		if err := validateIPv4CIDR(p); err != nil {
+			return Config{}, errors.Wrapf(err, "invalid CIDR pool for environment %q", cfg.Environment)
+		}
+		cfg.CIDRBlock, pool = p, p
+	}
+	cidrSet := false
+	if cidr, _ := oxr.Resource.GetString("spec.cidrBlock"); cidr != "" {
+		cfg.CIDRBlock, cidrSet = cidr, true
+	}
+	if pool != "" && cidrSet {
+		// environments' pools don't overlap, so neither may their networks
+		// an unparseable block is left for validate to reject
+		if ok, err := cidrWithin(cfg.CIDRBlock, pool); err == nil && !ok {
+			return Config{}, &ValidationError{Field: "spec.cidrBlock", Reason: fmt.Sprintf("CIDR block %q is outside %s, the CIDR pool of environment %q", cfg.CIDRBlock, pool, cfg.Environment)}
+		}
+	}
+	cfg.IPv4IPAMPoolID, _ = oxr.Resource.GetString("spec.ipv4IpamPoolId")
+	cfg.IPv4NetmaskLength, _ = oxr.Resource.GetInteger("spec.ipv4NetmaskLength")
+	if cfg.UsesIPAM() {
+		// IPAM allocates the VPC's CIDR block, so no default applies. Only a
+		// block set explicitly in the spec remains, for validate to reject.
+		cfg.CIDRBlock, _ = oxr.Resource.GetString("spec.cidrBlock")
+	}
+	if !regionSet {
+		cfg.Defaulted = append(cfg.Defaulted, DefaultedField{Field: "spec.region", Value: cfg.Region})
+	}
+	if !cidrSet && !cfg.UsesIPAM() {
+		cfg.Defaulted = append(cfg.Defaulted, DefaultedField{Field: "spec.cidrBlock", Value: cfg.CIDRBlock})
+	}
+	if pc, _ := oxr.Resource.GetString("spec.providerConfigName"); pc == "" {
+		cfg.Defaulted = append(cfg.Defaulted, DefaultedField{Field: "spec.providerConfigName", Value: cfg.ProviderConfigName})
+	}
+	cfg.DivideCIDRBlock, _ = oxr.Resource.GetBool("spec.divideCidrBlock")
+	cfg.EnableIPv6, _ = oxr.Resource.GetBool("spec.enableIpv6")
+	cfg.PrimaryVPCIndex, _ = oxr.Resource.GetInteger("spec.primaryVpcIndex")
+	if _, err := oxr.Resource.GetValue("spec.privateVpcIndexes"); err == nil {
+		if err := oxr.Resource.GetValueInto("spec.privateVpcIndexes", &cfg.PrivateVPCIndexes); err != nil {
+			return Config{}, &ValidationError{Field: "spec.privateVpcIndexes", Reason: err.Error()}
+		}
+	}
+	if _, err := oxr.Resource.GetValue("spec.gatewayVpcIndexes"); err == nil {
+		if err := oxr.Resource.GetValueInto("spec.gatewayVpcIndexes", &cfg.GatewayVPCIndexes); err != nil {
+			return Config{}, &ValidationError{Field: "spec.gatewayVpcIndexes", Reason: err.Error()}
+		}
+	}
+	cfg.Strict, _ = oxr.Resource.GetBool("spec.strict")
+	if _, err := oxr.Resource.GetValue("spec.prefixList"); err == nil {
+		cfg.PrefixList = &PrefixList{}
+		if err := oxr.Resource.GetValueInto("spec.prefixList", cfg.PrefixList); err != nil {
+			return Config{}, &ValidationError{Field: "spec.prefixList", Reason: err.Error()}
+		}
+	}
+	cfg.AvailabilityZones, _ = oxr.Resource.GetStringArray("spec.availabilityZones")
+	cfg.SubnetAlignment, _ = oxr.Resource.GetInteger("spec.subnetAlignment")
+	if _, err := oxr.Resource.GetValue("spec.maxAzs"); err == nil {
+		cfg.MaxAZs, _ = oxr.Resource.GetInteger("spec.maxAzs")
+		if cfg.MaxAZs < 1 {
+			return Config{}, &ValidationError{Field: "spec.maxAzs", Reason: fmt.Sprintf("must be at least 1, got %d", cfg.MaxAZs)}
+		}
+		cfg.AvailabilityZones = firstAZs(cfg.AvailabilityZones, cfg.MaxAZs)
+	}
+	if _, err := oxr.Resource.GetValue("spec.maxSubnetsPerAz"); err == nil {
+		cfg.MaxSubnetsPerAZ, _ = oxr.Resource.GetInteger("spec.maxSubnetsPerAz")
+		if cfg.MaxSubnetsPerAZ < 1 {
+			return Config{}, &ValidationError{Field: "spec.maxSubnetsPerAz", Reason: fmt.Sprintf("must be at least 1, got %d", cfg.MaxSubnetsPerAZ)}
+		}
+	}
+	cfg.PublicSubnets, _ = oxr.Resource.GetBool("spec.publicSubnets")
+	cfg.PrivateSubnets, _ = oxr.Resource.GetBool("spec.privateSubnets")
+	cfg.CreateDBSubnetGroup, _ = oxr.Resource.GetBool("spec.createDbSubnetGroup")
+	cfg.Tags, _ = oxr.Resource.GetStringObject("spec.tags")
+	cfg.PublicSubnetTags, _ = oxr.Resource.GetStringObject("spec.publicSubnetTags")
+	cfg.PrivateSubnetTags, _ = oxr.Resource.GetStringObject("spec.privateSubnetTags")
+	cfg.ResourceNameOverrides, _ = oxr.Resource.GetStringObject("spec.resourceNameOverrides")
+	cfg.StableResourceKeys, _ = oxr.Resource.GetBool("spec.stableResourceKeys")
+	cfg.HashResourceKeys, _ = oxr.Resource.GetBool("spec.hashResourceKeys")
+	cfg.ClusterName, _ = oxr.Resource.GetString("spec.clusterName")
+	cfg.DeleteResources, _ = oxr.Resource.GetStringArray("spec.deleteResources")
+	if cloud, _ := oxr.Resource.GetString("spec.cloud"); cloud != "" {
+		cfg.Cloud = cloud
+	}
+	if mode, _ := oxr.Resource.GetString("spec.mode"); mode != "" {
+		if mode != ModeCompose && mode != ModeReport {
+			return Config{}, &ValidationError{Field: "spec.mode", Reason: fmt.Sprintf("must be %s or %s, got %q", ModeCompose, ModeReport, mode)}
+		}
+		cfg.Mode = mode
+	}
+	cfg.GatewayRefByName, _ = oxr.Resource.GetBool("spec.gatewayRefByName")
+	cfg.WriteConnectionSecrets, _ = oxr.Resource.GetBool("spec.writeConnectionSecrets")
+	cfg.ConnectionSecretNamespace, _ = oxr.Resource.GetString("spec.writeConnectionSecretNamespace")
+	if _, err := oxr.Resource.GetValue("spec.gatewayVpcSelector"); err == nil {
+		// an empty selector is kept, rather than left nil, so validate can
+		// reject it
+		sel, _ := oxr.Resource.GetStringObject("spec.gatewayVpcSelector")
+		cfg.GatewayVPCSelector = map[string]string{}
+		for k, v := range sel {
+			cfg.GatewayVPCSelector[k] = v
+		}
+	}
+	cfg.GatewayProviderConfigName, _ = oxr.Resource.GetString("spec.gatewayProviderConfigName")
+	cfg.LockdownDefaultSG, _ = oxr.Resource.GetBool("spec.lockdownDefaultSg")
+	cfg.DefaultEgressCIDR, _ = oxr.Resource.GetString("spec.defaultEgressCidr")
+	cfg.S3GatewayEndpoint, _ = oxr.Resource.GetBool("spec.s3GatewayEndpoint")
+	cfg.PredictableVPCNames, _ = oxr.Resource.GetBool("spec.predictableVpcNames")
+	cfg.PrivateRouteTablePerAZ, _ = oxr.Resource.GetBool("spec.privateRouteTablePerAz")
+	cfg.NATGatewayStrategy, _ = oxr.Resource.GetString("spec.natGatewayStrategy")
+	cfg.DeletionOrdering, _ = oxr.Resource.GetBool("spec.deletionOrdering")
+	cfg.EmitDiff, _ = oxr.Resource.GetBool("spec.emitDiff")
+	cfg.EmitStatusPatch, _ = oxr.Resource.GetBool("spec.emitStatusPatch")
+	cfg.FillIndexGaps, _ = oxr.Resource.GetBool("spec.fillIndexGaps")
+	cfg.FirewallSubnets, _ = oxr.Resource.GetBool("spec.firewallSubnets")
+	cfg.EnableNetworkFirewall, _ = oxr.Resource.GetBool("spec.enableNetworkFirewall")
+	cfg.PublicSubnetAutoAssignIP = true
+	if _, err := oxr.Resource.GetValue("spec.publicSubnetAutoAssignIp"); err == nil {
+		cfg.PublicSubnetAutoAssignIP, _ = oxr.Resource.GetBool("spec.publicSubnetAutoAssignIp")
+	}
+	cfg.EmitGraph, _ = oxr.Resource.GetBool("spec.emitGraph")
+	cfg.ReportFreeAddressSpace, _ = oxr.Resource.GetBool("spec.reportFreeAddressSpace")
+	cfg.ReportEffectiveConfig, _ = oxr.Resource.GetBool("spec.reportEffectiveConfig")
+	cfg.ReportSubnets, _ = oxr.Resource.GetBool("spec.reportSubnets")
+	cfg.UseGenerateName, _ = oxr.Resource.GetBool("spec.useGenerateName")
+	cfg.EmitSpecHash, _ = oxr.Resource.GetBool("spec.emitSpecHash")
+	if set, _ := oxr.Resource.GetBool("spec.setOwnerReferences"); set {
+		// an owner reference without a UID would never resolve
+		if oxr.Resource.GetUID() == "" {
+			return Config{}, &ValidationError{Field: "metadata.uid", Reason: "must be set when spec.setOwnerReferences is true"}
+		}
+		cfg.OwnerReference = &metav1.OwnerReference{
+			APIVersion:         oxr.Resource.GetAPIVersion(),
+			Kind:               oxr.Resource.GetKind(),
+			Name:               oxr.Resource.GetName(),
+			UID:                oxr.Resource.GetUID(),
+			BlockOwnerDeletion: ptr.To(true),
+		}
+	}
+	if _, err := oxr.Resource.GetValue("spec.readyTimeoutSeconds"); err == nil {
+		secs, _ := oxr.Resource.GetInteger("spec.readyTimeoutSeconds")
+		if secs < 1 {
+			return Config{}, &ValidationError{Field: "spec.readyTimeoutSeconds", Reason: fmt.Sprintf("must be at least 1, got %d", secs)}
+		}
+		cfg.ReadyTimeout = time.Duration(secs) * time.Second
+	}
+	if v, _ := oxr.Resource.GetString("spec.expiresAfter"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, &ValidationError{Field: "spec.expiresAfter", Reason: fmt.Sprintf("%q is not a duration", v)}
+		}
+		if d <= 0 {
+			return Config{}, &ValidationError{Field: "spec.expiresAfter", Reason: fmt.Sprintf("must be positive, got %s", v)}
+		}
+		cfg.ExpiresAfter = d
+	}
+	if labels, _ := oxr.Resource.GetStringObject("spec.vpcIdLabels"); len(labels) > 0 {
+		cfg.VPCIDLabels = make(map[int64]string, len(labels))
+		for k, v := range labels {
+			i, err := strconv.ParseInt(k, 10, 64)
+			if err != nil {
+				return Config{}, &ValidationError{Field: fmt.Sprintf("spec.vpcIdLabels[%s]", k), Reason: "keys must be VPC indexes"}
+			}
+			cfg.VPCIDLabels[i] = v
+		}
+	}
+	cfg.DisableManagedLabels, _ = oxr.Resource.GetBool("spec.disableManagedLabels")
+	if cfg.DisableManagedLabels {
+		// without the labels the gateway can't select its VPC, so it must
+		// reference it by name
+		if _, err := oxr.Resource.GetValue("spec.gatewayRefByName"); err == nil && !cfg.GatewayRefByName {
+			return Config{}, &ValidationError{Field: "spec.gatewayRefByName", Reason: "must be true when spec.disableManagedLabels is set"}
+		}
+		cfg.GatewayRefByName = true
+	}
+	if _, err := oxr.Resource.GetValue("spec.igwRouteCidrs"); err == nil {
+		cidrs, _ := oxr.Resource.GetStringArray("spec.igwRouteCidrs")
+		cfg.IGWRouteCIDRs = append([]string{}, cidrs...)
+	}
+	if _, err := oxr.Resource.GetValue("spec.providerConfigs"); err == nil {
+		// keep an explicitly empty list distinct from an absent one, so that
+		// validate can reject it
+		pcs, _ := oxr.Resource.GetStringArray("spec.providerConfigs")
+		cfg.ProviderConfigs = append([]string{}, pcs...)
+	}
+
+	return withTopology(oxr, cfg)
+}
+
+// UsesIPAM returns true if the VPC's CIDR block should be allocated from an
+// AWS IPAM pool.
+func (c Config) UsesIPAM() bool {
+	return c.IPv4IPAMPoolID != "" || c.IPv4NetmaskLength != 0
+}
+
+// inferRegion returns the region implied by the supplied provider config name,
+// or an empty string if the name doesn't match the supplied convention.
+func inferRegion(pcr v1beta1.ProviderConfigRegion, providerConfig string) (string, error) {
+	re, err := regexp.Compile(pcr.Pattern)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot compile pattern %q", pcr.Pattern)
+	}
+	if re.NumSubexp() < 1 {
+		return "", errors.Errorf("pattern %q has no capture group", pcr.Pattern)
+	}
+	m := re.FindStringSubmatch(providerConfig)
+	if m == nil {
+		return "", nil
+	}
+	if region, ok := pcr.Regions[m[1]]; ok {
+		return region, nil
+	}
+	return m[1], nil
+}
+
+// A ValidationError is returned when a field of the XR is invalid. Errors
+// caused by a Function bug or by the Function's environment are not
+// ValidationErrors.
+type ValidationError struct {
+	// Field is the path of the invalid field, for example spec.cidrBlock.
+	Field string
+
+	// Reason the field is invalid.
+	Reason string
+}
+
+// Error returns the invalid field and why it's invalid.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Reason)
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+)
+
+func TestParse(t *testing.T) {
+	xr := func(labels, spec string) *resource.Composite {
+		oxr := &resource.Composite{Resource: composite.New()}
+		if err := resource.AsObject(resource.MustStructJSON(`{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code", "labels": `+labels+`},
+			"spec": `+spec+`
+		}`), oxr.Resource); err != nil {
+			t.Fatalf("resource.AsObject(...): %v", err)
+		}
+		return oxr
+	}
+
+	type want struct {
+		cfg Config
+		err string
+	}
+
+	cases := map[string]struct {
+		reason string
+		oxr    *resource.Composite
+		want   want
+	}{
+		"Minimal": {
+			reason: "An XR with only an ID should take every default, and record that it did",
+			oxr:    xr(`{}`, `{"id": "code"}`),
+			want: want{cfg: Config{
+				ID:                       "code",
+				Region:                   DefaultRegion,
+				ProviderConfigName:       DefaultProviderConfigName,
+				CIDRBlock:                DefaultCIDRBlock,
+				MinCIDRPrefixLength:      MinVPCPrefixLength,
+				PublicSubnetAutoAssignIP: true,
+				Mode:                     ModeCompose,
+				Cloud:                    CloudAWS,
+				Defaulted: []DefaultedField{
+					{Field: "spec.region", Value: DefaultRegion},
+					{Field: "spec.cidrBlock", Value: DefaultCIDRBlock},
+					{Field: "spec.providerConfigName", Value: DefaultProviderConfigName},
+				},
+			}},
+		},
+		"Explicit": {
+			reason: "Fields set in the XR's spec should be used as is",
+			oxr: xr(`{}`, `{
+				"id": "code",
+				"count": 2,
+				"includeGateway": true,
+				"region": "us-east-1",
+				"providerConfigName": "shared",
+				"cidrBlock": "10.0.0.0/16",
+				"tags": {"team": "net"}
+			}`),
+			want: want{cfg: Config{
+				ID:                       "code",
+				Count:                    2,
+				IncludeGateway:           true,
+				Region:                   "us-east-1",
+				ProviderConfigName:       "shared",
+				CIDRBlock:                "10.0.0.0/16",
+				MinCIDRPrefixLength:      MinVPCPrefixLength,
+				PublicSubnetAutoAssignIP: true,
+				Mode:                     ModeCompose,
+				Cloud:                    CloudAWS,
+				Tags:                     map[string]string{"team": "net"},
+			}},
+		},
+		"Labels": {
+			reason: "The count and region should fall back to the XR's labels",
+			oxr: xr(`{
+				"networks.meta.fn.crossplane.io/count": "3",
+				"networks.meta.fn.crossplane.io/region": "eu-west-1"
+			}`, `{"id": "code", "cidrBlock": "10.0.0.0/16", "providerConfigName": "shared"}`),
+			want: want{cfg: Config{
+				ID:                       "code",
+				Count:                    3,
+				Region:                   "eu-west-1",
+				ProviderConfigName:       "shared",
+				CIDRBlock:                "10.0.0.0/16",
+				MinCIDRPrefixLength:      MinVPCPrefixLength,
+				PublicSubnetAutoAssignIP: true,
+				Mode:                     ModeCompose,
+				Cloud:                    CloudAWS,
+			}},
+		},
+		"IPAM": {
+			reason: "An XR using IPAM should take no default CIDR block",
+			oxr:    xr(`{}`, `{"id": "code", "region": "us-east-1", "providerConfigName": "shared", "ipv4IpamPoolId": "ipam-pool-0123", "ipv4NetmaskLength": 20}`),
+			want: want{cfg: Config{
+				ID:                       "code",
+				Region:                   "us-east-1",
+				ProviderConfigName:       "shared",
+				IPv4IPAMPoolID:           "ipam-pool-0123",
+				IPv4NetmaskLength:        20,
+				MinCIDRPrefixLength:      MinVPCPrefixLength,
+				PublicSubnetAutoAssignIP: true,
+				Mode:                     ModeCompose,
+				Cloud:                    CloudAWS,
+			}},
+		},
+		"MissingID": {
+			reason: "An XR without an ID should be rejected",
+			oxr:    xr(`{}`, `{"count": 1}`),
+			want:   want{err: "spec.id: must be set"},
+		},
+		"BadCountLabel": {
+			reason: "A count label that isn't a number should be rejected",
+			oxr:    xr(`{"networks.meta.fn.crossplane.io/count": "two"}`, `{"id": "code"}`),
+			want:   want{err: `metadata.labels[networks.meta.fn.crossplane.io/count]: strconv.ParseInt: parsing "two": invalid syntax`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Parse(tc.oxr)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if diff := cmp.Diff(tc.want.err, got); diff != "" {
+				t.Errorf("%s\nParse(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cfg, cfg); diff != "" {
+				t.Errorf("%s\nParse(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package config
+
+// PrefixList is a managed prefix list of CIDR blocks, which security groups and
+// route tables can reference in place of the blocks themselves.
+type PrefixList struct {
+	Name       string            `json:"name"`
+	MaxEntries int64             `json:"maxEntries"`
+	Entries    []PrefixListEntry `json:"entries"`
+}
+
+// PrefixListEntry is a CIDR block in a managed prefix list.
+type PrefixListEntry struct {
+	CIDR        string `json:"cidr"`
+	Description string `json:"description"`
+}
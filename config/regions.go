@@ -0,0 +1,77 @@
+package config
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// regionPattern matches the names of AWS regions, like eu-central-1 and
+// us-gov-west-1.
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-[0-9]+$`)
+
+// regionAZs are the availability zones of each AWS region the function knows
+// about. Regions that aren't listed fall back to matching by prefix.
+var regionAZs = map[string][]string{
+	"us-east-1":      {"us-east-1a", "us-east-1b", "us-east-1c", "us-east-1d", "us-east-1e", "us-east-1f"},
+	"us-east-2":      {"us-east-2a", "us-east-2b", "us-east-2c"},
+	"us-west-1":      {"us-west-1a", "us-west-1b", "us-west-1c"},
+	"us-west-2":      {"us-west-2a", "us-west-2b", "us-west-2c", "us-west-2d"},
+	"ca-central-1":   {"ca-central-1a", "ca-central-1b", "ca-central-1d"},
+	"eu-central-1":   {"eu-central-1a", "eu-central-1b", "eu-central-1c"},
+	"eu-central-2":   {"eu-central-2a", "eu-central-2b", "eu-central-2c"},
+	"eu-west-1":      {"eu-west-1a", "eu-west-1b", "eu-west-1c"},
+	"eu-west-2":      {"eu-west-2a", "eu-west-2b", "eu-west-2c"},
+	"eu-west-3":      {"eu-west-3a", "eu-west-3b", "eu-west-3c"},
+	"eu-north-1":     {"eu-north-1a", "eu-north-1b", "eu-north-1c"},
+	"eu-south-1":     {"eu-south-1a", "eu-south-1b", "eu-south-1c"},
+	"ap-northeast-1": {"ap-northeast-1a", "ap-northeast-1c", "ap-northeast-1d"},
+	"ap-northeast-2": {"ap-northeast-2a", "ap-northeast-2b", "ap-northeast-2c", "ap-northeast-2d"},
+	"ap-south-1":     {"ap-south-1a", "ap-south-1b", "ap-south-1c"},
+	"ap-southeast-1": {"ap-southeast-1a", "ap-southeast-1b", "ap-southeast-1c"},
+	"ap-southeast-2": {"ap-southeast-2a", "ap-southeast-2b", "ap-southeast-2c"},
+	"sa-east-1":      {"sa-east-1a", "sa-east-1b", "sa-east-1c"},
+}
+
+// RegionAZs returns the availability zones of the supplied AWS region, and
+// false if the function doesn't know them.
+func RegionAZs(region string) ([]string, bool) {
+	azs, ok := regionAZs[region]
+	return azs, ok
+}
+
+// LooksLikeRegion returns true if the supplied string is the name of a region
+// the function knows about, or has the form of one.
+func LooksLikeRegion(region string) bool {
+	if _, ok := regionAZs[region]; ok {
+		return true
+	}
+	return regionPattern.MatchString(region)
+}
+
+// resolveRegionAlias returns the region the supplied alias stands for. A region
+// that isn't an alias is returned as is if it looks like a real region, and
+// is an error otherwise.
+func resolveRegionAlias(aliases map[string]string, region string) (string, error) {
+	if r, ok := aliases[region]; ok {
+		return r, nil
+	}
+	if LooksLikeRegion(region) {
+		return region, nil
+	}
+	return "", errors.Errorf("%q is neither a region alias nor an AWS region", region)
+}
+
+// firstAZs returns the first n distinct availability zones of the supplied
+// zones in sorted order, so the same zones are picked whatever order they're
+// listed in. Zones that don't need capping are returned as is.
+func firstAZs(azs []string, n int64) []string {
+	sorted := slices.Clone(azs)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+	if int64(len(sorted)) <= n {
+		return azs
+	}
+	return sorted[:n]
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// Topologies an XR may ask for with spec.topology.
+const (
+	// TopologyStandard is public subnets routed to an InternetGateway, and
+	// private subnets routed to a NAT gateway.
+	TopologyStandard = "standard"
+
+	// TopologyIsolated is private subnets with no route to the internet, for
+	// workloads reached only through endpoints or a transit gateway.
+	TopologyIsolated = "isolated"
+)
+
+// topologyAZs is how many availability zones a topology spans when the XR
+// doesn't list any.
+const topologyAZs = 2
+
+// withTopology returns the supplied config with the settings of the XR's
+// spec.topology applied. The standard topology only fills in the fields the
+// XR leaves unset, so individual fields still override pieces of it. The
+// isolated topology never has internet access, so it overrides any field
+// that would add it and records the field in TopologyConflicts. Each unset
+// field a topology fills in is recorded in Defaulted.
+func withTopology(oxr *resource.Composite, cfg Config) (Config, error) {
+	topology, _ := oxr.Resource.GetString("spec.topology")
+	unset := func(path string) bool {
+		_, err := oxr.Resource.GetValue(path)
+		return err != nil
+	}
+	defaulted := func(path string, value bool) bool {
+		if !unset(path) {
+			return false
+		}
+		cfg.Defaulted = append(cfg.Defaulted, DefaultedField{Field: path, Value: strconv.FormatBool(value)})
+		return true
+	}
+
+	switch topology {
+	case "":
+		return cfg, nil
+	case TopologyStandard:
+		if defaulted("spec.includeGateway", true) {
+			cfg.IncludeGateway = true
+		}
+		if defaulted("spec.publicSubnets", true) {
+			cfg.PublicSubnets = true
+		}
+		if defaulted("spec.privateSubnets", true) {
+			cfg.PrivateSubnets = true
+		}
+		// private subnets reach the internet through a NAT gateway in a
+		// public subnet, unless the XR turned either tier off
+		if unset("spec.natGatewayStrategy") && cfg.IncludeGateway && cfg.PublicSubnets && cfg.PrivateSubnets {
+			cfg.NATGatewayStrategy = NATStrategySingle
+			cfg.Defaulted = append(cfg.Defaulted, DefaultedField{Field: "spec.natGatewayStrategy", Value: cfg.NATGatewayStrategy})
+		}
+	case TopologyIsolated:
+		if cfg.IncludeGateway {
+			cfg.TopologyConflicts = append(cfg.TopologyConflicts, "spec.includeGateway")
+		}
+		if cfg.PublicSubnets {
+			cfg.TopologyConflicts = append(cfg.TopologyConflicts, "spec.publicSubnets")
+		}
+		if cfg.NATGatewayStrategy != "" {
+			cfg.TopologyConflicts = append(cfg.TopologyConflicts, "spec.natGatewayStrategy")
+		}
+		cfg.IncludeGateway, cfg.PublicSubnets, cfg.NATGatewayStrategy = false, false, ""
+		if defaulted("spec.privateSubnets", true) {
+			cfg.PrivateSubnets = true
+		}
+	default:
+		return Config{}, &ValidationError{Field: "spec.topology", Reason: fmt.Sprintf("must be %s or %s, got %q", TopologyStandard, TopologyIsolated, topology)}
+	}
+
+	cfg.Topology = topology
+	if unset("spec.availabilityZones") {
+		azs, ok := RegionAZs(cfg.Region)
+		if !ok {
+			return Config{}, &ValidationError{Field: "spec.availabilityZones", Reason: fmt.Sprintf("must be set for the %s topology in region %s, whose availability zones the Function doesn't know", topology, cfg.Region)}
+		}
+		n := int64(topologyAZs)
+		if cfg.MaxAZs > 0 {
+			n = cfg.MaxAZs
+		}
+		cfg.AvailabilityZones = firstAZs(azs, n)
+		cfg.Defaulted = append(cfg.Defaulted, DefaultedField{Field: "spec.availabilityZones", Value: strings.Join(cfg.AvailabilityZones, ", ")})
+	}
+	return cfg, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/jbw976/demo-xfn-network/names"
+)
+
+// connectionSecretRef returns the reference to the secret the named resource
+// should write its connection details to, or nil unless
+// spec.writeConnectionSecrets is set. Each resource gets its own secret in
+// spec.writeConnectionSecretNamespace.
+func (c Config) connectionSecretRef(name string) *v1.SecretReference {
+	if !c.WriteConnectionSecrets {
+		return nil
+	}
+	return &v1.SecretReference{Name: names.ConnectionSecretName(name), Namespace: c.ConnectionSecretNamespace}
+}
+
+// validateConnectionSecrets returns a ValidationError if
+// spec.writeConnectionSecrets is set without a valid
+// spec.writeConnectionSecretNamespace to write them to.
+func (c Config) validateConnectionSecrets() error {
+	if !c.WriteConnectionSecrets {
+		return nil
+	}
+	if c.ConnectionSecretNamespace == "" {
+		return &ValidationError{Field: "spec.writeConnectionSecretNamespace", Reason: "must be set when spec.writeConnectionSecrets is true"}
+	}
+	if errs := validation.IsDNS1123Label(c.ConnectionSecretNamespace); len(errs) > 0 {
+		return &ValidationError{Field: "spec.writeConnectionSecretNamespace", Reason: strings.Join(errs, "; ")}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunFunctionConnectionSecrets(t *testing.T) {
+	xr := func(write bool, namespace string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 2,
+				"includeGateway": true,
+				"privateSubnets": true,
+				"availabilityZones": ["eu-central-1a"],
+				"writeConnectionSecrets": ` + strconv.FormatBool(write) + `,
+				"writeConnectionSecretNamespace": "` + namespace + `"
+			}
+		}`
+	}
+
+	type want struct {
+		names      map[string]string
+		namespaces map[string]string
+		results    []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Disabled": {
+			reason: "No resource should write a connection secret unless the XR asks",
+			xr:     xr(false, "crossplane-system"),
+			want: want{
+				names:      map[string]string{},
+				namespaces: map[string]string{},
+			},
+		},
+		"Enabled": {
+			reason: "Each VPC and gateway should write its own connection secret to the namespace, and other resources none",
+			xr:     xr(true, "crossplane-system"),
+			want: want{
+				names: map[string]string{
+					"vpc-code-0":     "vpc-code-0-connection",
+					"vpc-code-1":     "vpc-code-1-connection",
+					"gateway-code-0": "gateway-code-0-connection",
+					"gateway-code-1": "gateway-code-1-connection",
+				},
+				namespaces: map[string]string{
+					"vpc-code-0":     "crossplane-system",
+					"vpc-code-1":     "crossplane-system",
+					"gateway-code-0": "crossplane-system",
+					"gateway-code-1": "crossplane-system",
+				},
+			},
+		},
+		"NoNamespace": {
+			reason: "Writing connection secrets without a namespace should return a fatal result",
+			xr:     xr(true, ""),
+			want: want{
+				names:      map[string]string{},
+				namespaces: map[string]string{},
+				results:    []string{"invalid network config: spec.writeConnectionSecretNamespace: must be set when spec.writeConnectionSecrets is true"},
+			},
+		},
+		"InvalidNamespace": {
+			reason: "A namespace that isn't a valid namespace name should return a fatal result",
+			xr:     xr(true, "Crossplane_System"),
+			want: want{
+				names:      map[string]string{},
+				namespaces: map[string]string{},
+				results:    []string{"invalid network config: spec.writeConnectionSecretNamespace: a lowercase RFC 1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.names, desiredStrings(t, rsp, "spec.writeConnectionSecretToRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want secret names, +got secret names:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.namespaces, desiredStrings(t, rsp, "spec.writeConnectionSecretToRef.namespace")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want secret namespaces, +got secret namespaces:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// contextKeyResourceGroups is the pipeline context key of the map of composed
+// resource names to the group, such as the network, they belong to.
+const contextKeyResourceGroups = "networks.fn.crossplane.io/resource-groups"
+
+// setResourceGroups records in the response's pipeline context that each
+// supplied composed resource belongs to the supplied group. Entries written by
+// earlier steps of the pipeline are kept, so that later steps can tell which
+// resources each network was composed from.
+func setResourceGroups(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse, rw IO, composedNames map[resource.Name]bool, group string) error {
+	groups := map[string]any{}
+	if v, ok := rw.GetContextKey(req, contextKeyResourceGroups); ok {
+		if v.GetStructValue() == nil {
+			return errors.Errorf("context key %q is not an object", contextKeyResourceGroups)
+		}
+		groups = v.GetStructValue().AsMap()
+	}
+
+	for name := range composedNames {
+		groups[string(name)] = group
+	}
+
+	s, err := structpb.NewStruct(groups)
+	if err != nil {
+		return errors.Wrap(err, "cannot convert resource groups to a struct")
+	}
+	rw.SetContextKey(rsp, contextKeyResourceGroups, structpb.NewStructValue(s))
+	return nil
+}
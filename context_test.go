@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionResourceGroups(t *testing.T) {
+	xr := `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 1, "includeGateway": true}
+	}`
+	enabled := `{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"emitResourceGroups": true
+	}`
+
+	cases := map[string]struct {
+		reason  string
+		input   string
+		context map[string]any
+		want    map[string]any
+		results []string
+	}{
+		"Disabled": {
+			reason: "No resource groups should be recorded unless the input enables them",
+			input:  `{"apiVersion": "networks.fn.crossplane.io/v1beta1", "kind": "Input"}`,
+		},
+		"Enabled": {
+			reason: "Each composed resource should be grouped under its network",
+			input:  enabled,
+			want: map[string]any{
+				"vpc-code-0":     "code",
+				"gateway-code-0": "code",
+			},
+		},
+		"EarlierSteps": {
+			reason:  "Groups recorded by earlier steps of the pipeline should be kept",
+			input:   enabled,
+			context: map[string]any{contextKeyResourceGroups: map[string]any{"bucket-other": "other"}},
+			want: map[string]any{
+				"bucket-other":   "other",
+				"vpc-code-0":     "code",
+				"gateway-code-0": "code",
+			},
+		},
+		"NotAnObject": {
+			reason:  "A context key that isn't an object should return a fatal result",
+			input:   enabled,
+			context: map[string]any{contextKeyResourceGroups: "oops"},
+			results: []string{`cannot set resource groups: context key "networks.fn.crossplane.io/resource-groups" is not an object`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input:    resource.MustStructJSON(tc.input),
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)}},
+			}
+			if tc.context != nil {
+				c, err := structpb.NewStruct(tc.context)
+				if err != nil {
+					t.Fatalf("structpb.NewStruct(...): %v", err)
+				}
+				req.Context = c
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+
+			var got map[string]any
+			if v, ok := rsp.GetContext().GetFields()[contextKeyResourceGroups]; ok && tc.results == nil {
+				got = v.GetStructValue().AsMap()
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want resource groups, +got resource groups:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
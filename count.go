@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/input/v1beta1"
+)
+
+// extraResourceCount is the key of the ConfigMap holding the network's count
+// among the extra resources the function requires.
+const extraResourceCount = "count"
+
+// requireCount asks Crossplane to supply the ConfigMap holding the network's
+// count as an extra resource.
+func requireCount(rsp *fnv1.RunFunctionResponse, c v1beta1.CountFrom) {
+	requireResource(rsp, extraResourceCount, "v1", "ConfigMap", c.ConfigMapName)
+}
+
+// externalCount returns the count the supplied extra resources' ConfigMap
+// holds. It returns false if Crossplane hasn't supplied the ConfigMap yet. It
+// returns an error if the ConfigMap doesn't exist, or doesn't hold a count
+// that's a non-negative integer.
+func externalCount(c v1beta1.CountFrom, extra map[string][]resource.Extra) (int64, bool, error) {
+	items, ok := extra[extraResourceCount]
+	if !ok {
+		return 0, false, nil
+	}
+	if len(items) == 0 {
+		return 0, false, errors.Errorf("ConfigMap %q doesn't exist", c.ConfigMapName)
+	}
+	v, err := fieldpath.Pave(items[0].Resource.Object).GetString("data[" + c.Key + "]")
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "cannot get key %q of ConfigMap %q", c.Key, c.ConfigMapName)
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "key %q of ConfigMap %q is not an integer", c.Key, c.ConfigMapName)
+	}
+	if n < 0 {
+		return 0, false, errors.Errorf("key %q of ConfigMap %q must not be negative, got %d", c.Key, c.ConfigMapName, n)
+	}
+	return n, true, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionCountFrom(t *testing.T) {
+	input := `{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"countFrom": {"configMapName": "network-scale", "key": "vpcs"}
+	}`
+	xr := `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 1}
+	}`
+	scale := func(data string) *fnv1.Resources {
+		return &fnv1.Resources{Items: []*fnv1.Resource{{Resource: resource.MustStructJSON(`{
+			"apiVersion": "v1",
+			"kind": "ConfigMap",
+			"metadata": {"name": "network-scale"},
+			"data": ` + data + `
+		}`)}}}
+	}
+
+	type want struct {
+		vpcs    int
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		extra  map[string]*fnv1.Resources
+		want   want
+	}{
+		"NotYetSupplied": {
+			reason: "The XR's count should be used until Crossplane supplies the ConfigMap",
+			want:   want{vpcs: 1},
+		},
+		"ExternallyDriven": {
+			reason: "The ConfigMap's count should take precedence over the XR's",
+			extra:  map[string]*fnv1.Resources{extraResourceCount: scale(`{"vpcs": "3"}`)},
+			want:   want{vpcs: 3},
+		},
+		"ScaledToZero": {
+			reason: "A count of zero is a valid signal",
+			extra:  map[string]*fnv1.Resources{extraResourceCount: scale(`{"vpcs": "0"}`)},
+			want:   want{vpcs: 0},
+		},
+		"Missing": {
+			reason: "A ConfigMap that doesn't exist should return a fatal result rather than fall back to the XR's count",
+			extra:  map[string]*fnv1.Resources{extraResourceCount: {}},
+			want: want{
+				results: []string{`cannot read count: ConfigMap "network-scale" doesn't exist`},
+			},
+		},
+		"MissingKey": {
+			reason: "A ConfigMap without the key should return a fatal result",
+			extra:  map[string]*fnv1.Resources{extraResourceCount: scale(`{"other": "3"}`)},
+			want: want{
+				results: []string{`cannot read count: cannot get key "vpcs" of ConfigMap "network-scale": data.vpcs: no such field`},
+			},
+		},
+		"NotAnInteger": {
+			reason: "A count that isn't an integer should return a fatal result",
+			extra:  map[string]*fnv1.Resources{extraResourceCount: scale(`{"vpcs": "three"}`)},
+			want: want{
+				results: []string{`cannot read count: key "vpcs" of ConfigMap "network-scale" is not an integer: strconv.ParseInt: parsing "three": invalid syntax`},
+			},
+		},
+		"Negative": {
+			reason: "A negative count should return a fatal result",
+			extra:  map[string]*fnv1.Resources{extraResourceCount: scale(`{"vpcs": "-1"}`)},
+			want: want{
+				results: []string{`cannot read count: key "vpcs" of ConfigMap "network-scale" must not be negative, got -1`},
+			},
+		},
+		"TooMany": {
+			reason: "A count beyond the resource limit should return a fatal result",
+			extra:  map[string]*fnv1.Resources{extraResourceCount: scale(`{"vpcs": "1000000"}`)},
+			want: want{
+				results: []string{"refusing to compose 1000000 VPCs, more than the maximum of 200 resources"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input:          resource.MustStructJSON(input),
+				Observed:       &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)}},
+				ExtraResources: tc.extra,
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.vpcs, len(rsp.GetDesired().GetResources())); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want VPCs, +got VPCs:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// removeDeletedResources removes each composed resource listed in
+// spec.deleteResources from the supplied desired composed resources, so that
+// Crossplane deletes it, even if the function would otherwise compose it. A
+// resource may be listed by either its generated name or its override from
+// spec.resourceNameOverrides or spec.stableResourceKeys. A listed resource that
+// is observed but no longer composed is already on its way out, and is skipped.
+// It returns an error if a listed resource is neither composed by the function
+// nor an observed resource of the network.
+func removeDeletedResources(cfg Config, desired map[resource.Name]*resource.DesiredComposed, composedNames map[resource.Name]bool, observed map[resource.Name]resource.ObservedComposed) error {
+	keys := cfg.resourceKeys()
+	logical := make(map[string]string, len(keys))
+	for generated, override := range keys {
+		logical[override] = generated
+	}
+	for i, n := range cfg.DeleteResources {
+		name := resource.Name(n)
+		if generated, ok := logical[n]; ok {
+			name = resource.Name(generated)
+		}
+		if composedNames[name] {
+			delete(desired, name)
+			delete(composedNames, name)
+			continue
+		}
+		// it may already be gone from the desired state, for example because
+		// the spec no longer asks for it
+		if oc, ok := observed[name]; ok && oc.Resource.GetLabels()[labelNetworkID] == cfg.ID {
+			continue
+		}
+		return &ValidationError{Field: fmt.Sprintf("spec.deleteResources[%d]", i), Reason: fmt.Sprintf("%q is not a resource of network %s", n, cfg.ID)}
+	}
+	return nil
+}
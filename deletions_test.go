@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionDeleteResources(t *testing.T) {
+	xr := func(deletes string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"includeGateway": true,
+				"resourceNameOverrides": {"vpc-code-0": "vpc"},
+				"deleteResources": ` + deletes + `
+			}
+		}`
+	}
+
+	type want struct {
+		names   map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason   string
+		xr       string
+		observed map[string]*fnv1.Resource
+		want     want
+	}{
+		"Generated": {
+			reason: "A resource listed by its generated name should be removed from the desired state",
+			xr:     xr(`["gateway-code-0"]`),
+			want: want{
+				names: map[string]string{"vpc": "vpc-code-0"},
+			},
+		},
+		"Override": {
+			reason: "A resource listed by its override should be removed from the desired state",
+			xr:     xr(`["vpc"]`),
+			want: want{
+				names: map[string]string{"gateway-code-0": "gateway-code-0"},
+			},
+		},
+		"AlreadyRemoved": {
+			reason: "An observed resource of the network that the function no longer composes should be accepted",
+			xr:     xr(`["subnet-code-0-public-0"]`),
+			observed: map[string]*fnv1.Resource{
+				"subnet-code-0-public-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "Subnet",
+					"metadata": {
+						"name": "subnet-code-0-public-0",
+						"labels": {"networks.meta.fn.crossplane.io/network-id": "code"}
+					}
+				}`)},
+			},
+			want: want{
+				names: map[string]string{
+					"vpc":            "vpc-code-0",
+					"gateway-code-0": "gateway-code-0",
+				},
+				results: []string{"0/1 synced, 0/1 ready"},
+			},
+		},
+		"NotManaged": {
+			reason: "A resource the network doesn't manage should return a fatal result",
+			xr:     xr(`["gateway-code-0", "bucket"]`),
+			observed: map[string]*fnv1.Resource{
+				"bucket": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "s3.aws.upbound.io/v1beta1",
+					"kind": "Bucket",
+					"metadata": {"name": "bucket"}
+				}`)},
+			},
+			want: want{
+				names:   map[string]string{},
+				results: []string{`invalid network config: spec.deleteResources[1]: "bucket" is not a resource of network code`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)},
+					Resources: tc.observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.names, desiredStrings(t, rsp, "metadata.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want names, +got names:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
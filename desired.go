@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+
+	"github.com/jbw976/demo-xfn-network/graph"
+)
+
+// DesiredResourcesSorted returns the desired composed resources of the supplied
+// RunFunctionResponse, sorted by name.
+func DesiredResourcesSorted(rsp *fnv1.RunFunctionResponse) []graph.NamedResource {
+	resources := rsp.GetDesired().GetResources()
+	out := make([]graph.NamedResource, 0, len(resources))
+	for name, r := range resources {
+		out = append(out, graph.NamedResource{Name: name, Resource: r})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// useGenerateName replaces the name of the supplied desired composed resource
+// with a generateName prefix, so that the API server appends a unique suffix.
+func useGenerateName(dc *composed.Unstructured) {
+	dc.SetGenerateName(dc.GetName() + "-")
+	dc.SetName("")
+}
+
+// setSpecHash annotates the supplied desired composed resource with a hash of
+// its spec.forProvider. Object keys are marshalled in sorted order, so the
+// hash is stable for identical input.
+func setSpecHash(dc *composed.Unstructured) error {
+	fp, err := dc.GetValue("spec.forProvider")
+	if err != nil {
+		return errors.Wrap(err, "cannot get spec.forProvider")
+	}
+	b, err := json.Marshal(fp)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal spec.forProvider")
+	}
+	sum := sha256.Sum256(b)
+
+	annotations := dc.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annotationSpecHash] = hex.EncodeToString(sum[:])
+	dc.SetAnnotations(annotations)
+	return nil
+}
+
+// setExpiresAt annotates the supplied desired composed resource with the time
+// it expires. A resource that already exists keeps the expiry it was created
+// with, so that it doesn't move forward each time the function runs.
+func setExpiresAt(dc *composed.Unstructured, oc resource.ObservedComposed, expires time.Time) {
+	at := expires.UTC().Format(time.RFC3339)
+	if oc.Resource != nil {
+		if v := oc.Resource.GetAnnotations()[annotationExpiresAt]; v != "" {
+			at = v
+		}
+	}
+
+	annotations := dc.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annotationExpiresAt] = at
+	dc.SetAnnotations(annotations)
+}
+
+// setDesiredStatus sets the supplied field of the desired XR's status to the
+// supplied value. It builds on the desired XR already in the response, so it
+// keeps any status fields set earlier in this run.
+func setDesiredStatus(rsp *fnv1.RunFunctionResponse, rw IO, field string, v any) error {
+	dxr, err := rw.GetDesiredCompositeResource(&fnv1.RunFunctionRequest{Desired: rsp.GetDesired()})
+	if err != nil {
+		return errors.Wrap(err, "cannot get desired composite resource")
+	}
+	if err := dxr.Resource.SetValue("status."+field, v); err != nil {
+		return errors.Wrapf(err, "cannot set status.%s", field)
+	}
+	return errors.Wrapf(rw.SetDesiredCompositeResource(rsp, dxr), "cannot set desired composite resource in %T", rsp)
+}
+
+// stripDefaultStatus removes the status of each supplied desired composed
+// resource whose status holds only default values, such as the
+// observedGeneration: 0 that composed.From emits for a managed resource with
+// no status.
+func stripDefaultStatus(desired map[resource.Name]*resource.DesiredComposed) {
+	for _, dc := range desired {
+		if s, ok := dc.Resource.Object["status"]; ok && isDefault(s) {
+			delete(dc.Resource.Object, "status")
+		}
+	}
+}
+
+// isDefault returns true if the supplied unstructured value is the zero value
+// of its type, or an object or array made up only of zero values.
+func isDefault(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]any:
+		for _, e := range v {
+			if !isDefault(e) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		for _, e := range v {
+			if !isDefault(e) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.ValueOf(v).IsZero()
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+
+	"github.com/jbw976/demo-xfn-network/config"
+	"github.com/jbw976/demo-xfn-network/graph"
+
+	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDesiredResourcesSorted(t *testing.T) {
+	r := func(name string) *fnv1.Resource {
+		return &fnv1.Resource{Resource: resource.MustStructJSON(`{"metadata": {"name": "` + name + `"}}`)}
+	}
+
+	cases := map[string]struct {
+		reason string
+		rsp    *fnv1.RunFunctionResponse
+		want   []graph.NamedResource
+	}{
+		"NilResponse": {
+			reason: "A nil response should have no desired resources",
+			want:   []graph.NamedResource{},
+		},
+		"NoDesiredResources": {
+			reason: "A response without desired resources should return an empty slice",
+			rsp:    &fnv1.RunFunctionResponse{},
+			want:   []graph.NamedResource{},
+		},
+		"SortedByName": {
+			reason: "Every desired resource should be returned, sorted by name",
+			rsp: &fnv1.RunFunctionResponse{
+				Desired: &fnv1.State{
+					Resources: map[string]*fnv1.Resource{
+						"vpc-code-0":              r("vpc-code-0"),
+						"gateway-code-0":          r("gateway-code-0"),
+						"subnet-code-0-public-0":  r("subnet-code-0-public-0"),
+						"vpc-code-1":              r("vpc-code-1"),
+						"subnet-code-0-private-0": r("subnet-code-0-private-0"),
+					},
+				},
+			},
+			want: []graph.NamedResource{
+				{Name: "gateway-code-0", Resource: r("gateway-code-0")},
+				{Name: "subnet-code-0-private-0", Resource: r("subnet-code-0-private-0")},
+				{Name: "subnet-code-0-public-0", Resource: r("subnet-code-0-public-0")},
+				{Name: "vpc-code-0", Resource: r("vpc-code-0")},
+				{Name: "vpc-code-1", Resource: r("vpc-code-1")},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := DesiredResourcesSorted(tc.rsp)
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nDesiredResourcesSorted(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestStripDefaultStatus(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		object map[string]any
+		want   map[string]any
+	}{
+		"DefaultStatus": {
+			reason: "A status holding only default values should be removed",
+			object: map[string]any{
+				"kind":   "VPC",
+				"status": map[string]any{"observedGeneration": int64(0), "atProvider": map[string]any{}},
+			},
+			want: map[string]any{"kind": "VPC"},
+		},
+		"PopulatedStatus": {
+			reason: "A status holding any non-default value should be kept",
+			object: map[string]any{
+				"kind":   "VPC",
+				"status": map[string]any{"observedGeneration": int64(0), "atProvider": map[string]any{"id": "vpc-0123"}},
+			},
+			want: map[string]any{
+				"kind":   "VPC",
+				"status": map[string]any{"observedGeneration": int64(0), "atProvider": map[string]any{"id": "vpc-0123"}},
+			},
+		},
+		"NoStatus": {
+			reason: "A resource without a status should be unchanged",
+			object: map[string]any{"kind": "VPC"},
+			want:   map[string]any{"kind": "VPC"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dc := &resource.DesiredComposed{Resource: composed.New()}
+			dc.Resource.Object = tc.object
+			stripDefaultStatus(map[resource.Name]*resource.DesiredComposed{"vpc": dc})
+
+			if diff := cmp.Diff(tc.want, dc.Resource.Object); diff != "" {
+				t.Errorf("%s\nstripDefaultStatus(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestStripDefaultStatusRoundTrip(t *testing.T) {
+	cfg := Config{Config: config.Config{ID: "code", Region: config.DefaultRegion, ProviderConfigName: config.DefaultProviderConfigName, CIDRBlock: config.DefaultCIDRBlock}}
+	want := newVPC(cfg, "vpc-code-0", rolePrimary)
+
+	dc, err := composed.From(want)
+	if err != nil {
+		t.Fatalf("composed.From(...): unexpected error: %v", err)
+	}
+	stripDefaultStatus(map[resource.Name]*resource.DesiredComposed{"vpc-code-0": {Resource: dc}})
+	if _, ok := dc.Object["status"]; ok {
+		t.Errorf("stripDefaultStatus(...): want no status, got %v", dc.Object["status"])
+	}
+
+	got := &awsv1beta1.VPC{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(dc.Object, got); err != nil {
+		t.Fatalf("FromUnstructured(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("stripDefaultStatus(...): -want VPC, +got VPC after round-tripping:\n%s", diff)
+	}
+}
+
+func TestRunFunctionStripStatus(t *testing.T) {
+	xr := `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 1, "includeGateway": true}
+	}`
+
+	cases := map[string]struct {
+		reason string
+		input  string
+		want   map[string]bool
+	}{
+		"StrippedByDefault": {
+			reason: "Desired resources should have no status by default",
+			want:   map[string]bool{"vpc-code-0": false, "gateway-code-0": false},
+		},
+		"Kept": {
+			reason: "Desired resources should keep their default status when the input disables stripping",
+			input: `{
+				"apiVersion": "networks.fn.crossplane.io/v1beta1",
+				"kind": "Input",
+				"stripStatus": false
+			}`,
+			want: map[string]bool{"vpc-code-0": true, "gateway-code-0": true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)}},
+			}
+			if tc.input != "" {
+				req.Input = resource.MustStructJSON(tc.input)
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			got := map[string]bool{}
+			for name, r := range rsp.GetDesired().GetResources() {
+				_, ok := r.GetResource().GetFields()["status"]
+				got[name] = ok
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want has status, +got has status:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionSpecHash(t *testing.T) {
+	xr := func(cidr string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"includeGateway": true,
+				"cidrBlock": "` + cidr + `",
+				"availabilityZones": ["eu-central-1a"],
+				"privateSubnets": true,
+				"emitSpecHash": true
+			}
+		}`
+	}
+	hashes := func(t *testing.T, xr string) map[string]string {
+		t.Helper()
+		return desiredStrings(t, runXR(t, xr), "metadata.annotations["+annotationSpecHash+"]")
+	}
+
+	a, b := hashes(t, xr("10.0.0.0/16")), hashes(t, xr("10.0.0.0/16"))
+	for _, name := range []string{"vpc-code-0", "gateway-code-0", "subnet-code-0-private-0"} {
+		if a[name] == "" {
+			t.Errorf("f.RunFunction(...): want a spec hash annotation on %s, got none", name)
+		}
+	}
+	if diff := cmp.Diff(a, b); diff != "" {
+		t.Errorf("f.RunFunction(...): identical inputs should produce identical hashes: -first, +second:\n%s", diff)
+	}
+
+	c := hashes(t, xr("10.1.0.0/16"))
+	for _, name := range []string{"vpc-code-0", "subnet-code-0-private-0"} {
+		if a[name] == c[name] {
+			t.Errorf("f.RunFunction(...): %s should have a different hash for a different CIDR block, got %s for both", name, a[name])
+		}
+	}
+	if a["gateway-code-0"] != c["gateway-code-0"] {
+		t.Errorf("f.RunFunction(...): gateway-code-0 doesn't depend on the CIDR block, so its hash should be unchanged")
+	}
+
+	if got := hashes(t, strings.Replace(xr("10.0.0.0/16"), `"emitSpecHash": true`, `"emitSpecHash": false`, 1)); len(got) != 0 {
+		t.Errorf("f.RunFunction(...): want no spec hash annotations unless spec.emitSpecHash is set, got %v", got)
+	}
+}
+
+func TestRunFunctionExpiresAt(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	xr := func(expiresAfter string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "code", "count": 1, "includeGateway": true, "expiresAfter": "` + expiresAfter + `"}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason   string
+		xr       string
+		observed map[string]*fnv1.Resource
+		want     map[string]string
+		results  []string
+	}{
+		"Created": {
+			reason: "Each new composed resource should expire after the duration, starting now",
+			xr:     xr("72h"),
+			want: map[string]string{
+				"vpc-code-0":     "2024-06-04T12:00:00Z",
+				"gateway-code-0": "2024-06-04T12:00:00Z",
+			},
+		},
+		"Existing": {
+			reason: "An existing composed resource should keep the expiry it was created with",
+			xr:     xr("72h"),
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {
+						"name": "vpc-code-0",
+						"annotations": {"networks.meta.fn.crossplane.io/expires-at": "2024-06-02T09:00:00Z"}
+					}
+				}`)},
+			},
+			want: map[string]string{
+				"vpc-code-0":     "2024-06-02T09:00:00Z",
+				"gateway-code-0": "2024-06-04T12:00:00Z",
+			},
+		},
+		"NotADuration": {
+			reason:  "An expiry that isn't a duration should return a fatal result",
+			xr:      xr("3 days"),
+			want:    map[string]string{},
+			results: []string{`invalid network config: spec.expiresAfter: "3 days" is not a duration`},
+		},
+		"Negative": {
+			reason:  "A negative expiry should return a fatal result",
+			xr:      xr("-1h"),
+			want:    map[string]string{},
+			results: []string{"invalid network config: spec.expiresAfter: must be positive, got -1h"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), clock: func() time.Time { return now }}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)},
+					Resources: tc.observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			got := desiredStrings(t, rsp, `metadata.annotations["networks.meta.fn.crossplane.io/expires-at"]`)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want expires-at, +got expires-at:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
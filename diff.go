@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// A fieldChange is a spec.forProvider field whose desired value differs from
+// its observed value.
+type fieldChange struct {
+	Path     string
+	Observed string
+	Desired  string
+}
+
+// String returns the change as, for example, cidrBlock: "10.0.0.0/16" ->
+// "10.1.0.0/16".
+func (c fieldChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Observed, c.Desired)
+}
+
+// forProviderDiff returns the fields of the supplied desired spec.forProvider
+// whose values differ from the supplied observed spec.forProvider, sorted by
+// path. Only fields the Function sets are compared, so fields the provider
+// late-initializes or manages are ignored. Values are compared as JSON, so
+// numbers compare equal whether they were unmarshalled as integers or floats.
+func forProviderDiff(desired, observed map[string]any) []fieldChange {
+	var changes []fieldChange
+	diffFields("", desired, observed, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// diffFields appends a change to changes for each field of desired, prefixed
+// with the supplied path, that differs from the same field of observed. Objects
+// are compared field by field, and everything else as a whole.
+func diffFields(path string, desired, observed map[string]any, changes *[]fieldChange) {
+	for k, dv := range desired {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		ov, ok := observed[k]
+		if dm, isMap := dv.(map[string]any); isMap {
+			om, _ := ov.(map[string]any)
+			diffFields(p, dm, om, changes)
+			continue
+		}
+		d, o := jsonValue(dv), "<unset>"
+		if ok {
+			o = jsonValue(ov)
+		}
+		if d != o {
+			*changes = append(*changes, fieldChange{Path: p, Observed: o, Desired: d})
+		}
+	}
+}
+
+// jsonValue returns the supplied unstructured value as JSON.
+func jsonValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// resourceDiffs returns a description of how each of the named desired
+// composed resources that has been observed will change, sorted by name.
+// Resources that haven't been observed yet, or won't change, are omitted.
+func resourceDiffs(desired map[resource.Name]*resource.DesiredComposed, observed map[resource.Name]resource.ObservedComposed, composedNames map[resource.Name]bool) []string {
+	names := make([]string, 0, len(composedNames))
+	for name := range composedNames {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	var diffs []string
+	for _, name := range names {
+		oc, ok := observed[resource.Name(name)]
+		if !ok {
+			continue
+		}
+		dc := desired[resource.Name(name)].Resource
+		dfp, _ := dc.GetValue("spec.forProvider")
+		ofp, _ := oc.Resource.GetValue("spec.forProvider")
+		dm, _ := dfp.(map[string]any)
+		om, _ := ofp.(map[string]any)
+		changes := forProviderDiff(dm, om)
+		if len(changes) == 0 {
+			continue
+		}
+		parts := make([]string, len(changes))
+		for i, c := range changes {
+			parts[i] = c.String()
+		}
+		diffs = append(diffs, fmt.Sprintf("%s %q will change: %s", dc.GetKind(), name, strings.Join(parts, ", ")))
+	}
+	return diffs
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionEmitDiff(t *testing.T) {
+	xr := func(cidr string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "code", "count": 1, "cidrBlock": "` + cidr + `", "emitDiff": true}
+		}`
+	}
+
+	// the VPC as the provider reports it, with fields it late-initialized
+	// and a tag the Function sets removed out of band
+	vpc := func(t *testing.T) *fnv1.Resource {
+		t.Helper()
+		rsp := runXR(t, xr("10.0.0.0/16"))
+		observed := rsp.GetDesired().GetResources()["vpc-code-0"].GetResource().AsMap()
+		p := fieldpath.Pave(observed)
+		for path, v := range map[string]any{
+			"spec.forProvider.instanceTenancy": "default",
+			"spec.forProvider.ownerId":         "123456789012",
+			"status.atProvider.id":             "vpc-0123",
+		} {
+			if err := p.SetValue(path, v); err != nil {
+				t.Fatalf("SetValue(%q): %v", path, err)
+			}
+		}
+		s, err := structpb.NewStruct(observed)
+		if err != nil {
+			t.Fatalf("structpb.NewStruct(...): %v", err)
+		}
+		return &fnv1.Resource{Resource: s}
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   []string
+	}{
+		"NoOp": {
+			reason: "An unchanged spec should produce no diff, ignoring fields the provider late-initialized",
+			xr:     xr("10.0.0.0/16"),
+		},
+		"CIDRChange": {
+			reason: "A changed CIDR block should be listed with its observed and desired values",
+			xr:     xr("10.1.0.0/16"),
+			want:   []string{`VPC "vpc-code-0" will change: cidrBlock: "10.0.0.0/16" -> "10.1.0.0/16"`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)},
+					Resources: map[string]*fnv1.Resource{"vpc-code-0": vpc(t)},
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var got []string
+			for _, r := range rsp.GetResults() {
+				if r.GetReason() == reasonForProviderDiff {
+					got = append(got, r.GetMessage())
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want diffs, +got diffs:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestForProviderDiff(t *testing.T) {
+	cases := map[string]struct {
+		reason   string
+		desired  map[string]any
+		observed map[string]any
+		want     []fieldChange
+	}{
+		"Numbers": {
+			reason:   "Numbers should compare equal whether they're integers or floats",
+			desired:  map[string]any{"ipv4NetmaskLength": int64(20)},
+			observed: map[string]any{"ipv4NetmaskLength": float64(20)},
+		},
+		"Nested": {
+			reason:   "Changed and unset fields of nested objects should be listed by path",
+			desired:  map[string]any{"tags": map[string]any{"Name": "vpc-code-0", "team": "net"}},
+			observed: map[string]any{"tags": map[string]any{"Name": "vpc-code-0"}},
+			want:     []fieldChange{{Path: "tags.team", Observed: "<unset>", Desired: `"net"`}},
+		},
+		"Arrays": {
+			reason:   "Arrays should be compared as a whole",
+			desired:  map[string]any{"ingress": []any{"a", "b"}},
+			observed: map[string]any{"ingress": []any{"a"}},
+			want:     []fieldChange{{Path: "ingress", Observed: `["a"]`, Desired: `["a","b"]`}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := forProviderDiff(tc.desired, tc.observed)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nforProviderDiff(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
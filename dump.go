@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/pkg/errors"
+)
+
+// dumpRequest writes the supplied request as JSON to a new file in the
+// supplied directory, and returns the file's path. The file can be passed to
+// --render to reproduce the run. Requests can hold connection details, so the
+// file is only readable by its owner.
+func dumpRequest(dir string, req *fnv1.RunFunctionRequest, now time.Time) (string, error) {
+	j, err := protojson.Marshal(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot marshal %T", req)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("request-%d.json", now.UnixNano()))
+	if err := os.WriteFile(path, j, 0o600); err != nil {
+		return "", errors.Wrapf(err, "cannot write request to %q", path)
+	}
+	return path, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionDumpRequest(t *testing.T) {
+	now := time.Date(2024, 9, 6, 12, 0, 0, 0, time.UTC)
+	req := &fnv1.RunFunctionRequest{
+		Meta: &fnv1.RequestMeta{Tag: "hello"},
+		Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "code", "count": 1}
+		}`)}},
+	}
+
+	cases := map[string]struct {
+		reason string
+		dump   bool
+		want   []string
+	}{
+		"Disabled": {
+			reason: "No request should be written by default",
+		},
+		"Enabled": {
+			reason: "The request should be written to the dump directory, named for when it was received",
+			dump:   true,
+			want:   []string{"request-1725624000000000000.json"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			f := &Function{log: logging.NewNopLogger(), clock: func() time.Time { return now }}
+			if tc.dump {
+				f.dumpDir = dir
+			}
+			if _, err := f.RunFunction(context.Background(), req); err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("%s\nos.ReadDir(...): unexpected error: %v", tc.reason, err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want files, +got files:\n%s", tc.reason, diff)
+			}
+
+			for _, name := range got {
+				b, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatalf("%s\nos.ReadFile(...): unexpected error: %v", tc.reason, err)
+				}
+				dumped := &fnv1.RunFunctionRequest{}
+				if err := protojson.Unmarshal(b, dumped); err != nil {
+					t.Fatalf("%s\nprotojson.Unmarshal(...): unexpected error: %v", tc.reason, err)
+				}
+				if diff := cmp.Diff(req, dumped, protocmp.Transform()); diff != "" {
+					t.Errorf("%s\nf.RunFunction(...): -want dumped request, +got dumped request:\n%s", tc.reason, diff)
+				}
+			}
+		})
+	}
+}
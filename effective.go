@@ -0,0 +1,57 @@
+package main
+
+// effectiveConfig is the network configuration the function composed with,
+// after defaulting, as written to the XR's status.effectiveConfig. Fields use
+// the names of the spec fields they resolve.
+type effectiveConfig struct {
+	ID                       string            `json:"id"`
+	Count                    int64             `json:"count"`
+	Region                   string            `json:"region"`
+	RegionOverrides          map[string]string `json:"regionOverrides,omitempty"`
+	ProviderConfigName       string            `json:"providerConfigName"`
+	CIDRBlock                string            `json:"cidrBlock,omitempty"`
+	AvailabilityZones        []string          `json:"availabilityZones"`
+	IncludeGateway           bool              `json:"includeGateway"`
+	PublicSubnets            bool              `json:"publicSubnets"`
+	PrivateSubnets           bool              `json:"privateSubnets"`
+	CreateDBSubnetGroup      bool              `json:"createDbSubnetGroup"`
+	PublicSubnetAutoAssignIP bool              `json:"publicSubnetAutoAssignIp"`
+	Mode                     string            `json:"mode"`
+	Cloud                    string            `json:"cloud"`
+	Topology                 string            `json:"topology,omitempty"`
+	NATGatewayStrategy       string            `json:"natGatewayStrategy,omitempty"`
+	Tags                     map[string]string `json:"tags,omitempty"`
+
+	// Defaulted lists the spec fields that were unset, so took a default.
+	Defaulted []string `json:"defaulted,omitempty"`
+}
+
+// effective returns the effective configuration. The CIDR block is omitted
+// when it's allocated from an IPAM pool, since it isn't known up front.
+func (c Config) effective() effectiveConfig {
+	ec := effectiveConfig{
+		ID:                       c.ID,
+		Count:                    c.Count,
+		Region:                   c.Region,
+		RegionOverrides:          c.RegionOverrides,
+		ProviderConfigName:       c.ProviderConfigName,
+		AvailabilityZones:        c.AvailabilityZones,
+		IncludeGateway:           c.IncludeGateway,
+		PublicSubnets:            c.PublicSubnets,
+		PrivateSubnets:           c.PrivateSubnets,
+		CreateDBSubnetGroup:      c.CreateDBSubnetGroup,
+		PublicSubnetAutoAssignIP: c.PublicSubnetAutoAssignIP,
+		Mode:                     c.Mode,
+		Cloud:                    c.Cloud,
+		Topology:                 c.Topology,
+		NATGatewayStrategy:       c.NATGatewayStrategy,
+		Tags:                     c.Tags,
+	}
+	if !c.UsesIPAM() {
+		ec.CIDRBlock = c.CIDRBlock
+	}
+	for _, d := range c.Defaulted {
+		ec.Defaulted = append(ec.Defaulted, d.Field)
+	}
+	return ec
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+
+	"github.com/jbw976/demo-xfn-network/config"
+)
+
+func TestRunFunctionReportEffectiveConfig(t *testing.T) {
+	type want struct {
+		effective any
+		freeSpace bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Disabled": {
+			reason: "The XR's status should be left alone unless the report is enabled",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 1}
+			}`,
+		},
+		"Defaults": {
+			reason: "Every field the XR leaves unset should be reported with the default it took",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 1, "reportEffectiveConfig": true}
+			}`,
+			want: want{
+				effective: map[string]any{
+					"id":                       "code",
+					"count":                    float64(1),
+					"region":                   config.DefaultRegion,
+					"providerConfigName":       config.DefaultProviderConfigName,
+					"cidrBlock":                config.DefaultCIDRBlock,
+					"availabilityZones":        nil,
+					"includeGateway":           false,
+					"publicSubnets":            false,
+					"privateSubnets":           false,
+					"createDbSubnetGroup":      false,
+					"publicSubnetAutoAssignIp": true,
+					"mode":                     config.ModeCompose,
+					"cloud":                    config.CloudAWS,
+					"defaulted":                []any{"spec.region", "spec.cidrBlock", "spec.providerConfigName"},
+				},
+			},
+		},
+		"AlongsideFreeAddressSpace": {
+			reason: "Reporting the effective config shouldn't clobber the free address space reported with it",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"region": "us-west-2",
+					"providerConfigName": "aws",
+					"cidrBlock": "10.0.0.0/16",
+					"privateSubnets": true,
+					"availabilityZones": ["us-west-2a"],
+					"reportFreeAddressSpace": true,
+					"reportEffectiveConfig": true
+				}
+			}`,
+			want: want{
+				effective: map[string]any{
+					"id":                       "code",
+					"count":                    float64(1),
+					"region":                   "us-west-2",
+					"providerConfigName":       "aws",
+					"cidrBlock":                "10.0.0.0/16",
+					"availabilityZones":        []any{"us-west-2a"},
+					"includeGateway":           false,
+					"publicSubnets":            false,
+					"privateSubnets":           true,
+					"createDbSubnetGroup":      false,
+					"publicSubnetAutoAssignIp": true,
+					"mode":                     config.ModeCompose,
+					"cloud":                    config.CloudAWS,
+				},
+				freeSpace: true,
+			},
+		},
+		"TopologyDefaults": {
+			reason: "Fields the XR's topology fills in should be reported with the values they took",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"region": "us-west-2",
+					"providerConfigName": "aws",
+					"cidrBlock": "10.0.0.0/16",
+					"topology": "standard",
+					"reportEffectiveConfig": true
+				}
+			}`,
+			want: want{
+				effective: map[string]any{
+					"id":                       "code",
+					"count":                    float64(1),
+					"region":                   "us-west-2",
+					"providerConfigName":       "aws",
+					"cidrBlock":                "10.0.0.0/16",
+					"availabilityZones":        []any{"us-west-2a", "us-west-2b"},
+					"includeGateway":           true,
+					"publicSubnets":            true,
+					"privateSubnets":           true,
+					"createDbSubnetGroup":      false,
+					"publicSubnetAutoAssignIp": true,
+					"mode":                     config.ModeCompose,
+					"cloud":                    config.CloudAWS,
+					"topology":                 config.TopologyStandard,
+					"natGatewayStrategy":       config.NATStrategySingle,
+					"defaulted": []any{
+						"spec.includeGateway",
+						"spec.publicSubnets",
+						"spec.privateSubnets",
+						"spec.natGatewayStrategy",
+						"spec.availabilityZones",
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			status := fieldpath.Pave(rsp.GetDesired().GetComposite().GetResource().AsMap())
+			got, _ := status.GetValue("status.effectiveConfig")
+			if diff := cmp.Diff(tc.want.effective, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want status.effectiveConfig, +got status.effectiveConfig:\n%s", tc.reason, diff)
+			}
+			if _, err := status.GetValue("status.freeAddressSpace"); (err == nil) != tc.want.freeSpace {
+				t.Errorf("%s\nf.RunFunction(...): want status.freeAddressSpace %t, got %v", tc.reason, tc.want.freeSpace, err)
+			}
+		})
+	}
+}
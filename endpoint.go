@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+
+	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+)
+
+// newS3GatewayEndpoint returns a gateway VPCEndpoint for S3 with the supplied
+// name in the named VPC. A gateway endpoint only takes effect for the route
+// tables it's associated with. The VPC is selected by label unless managed
+// labels are disabled, in which case it's referenced by name. It's composed at
+// v1beta2 when the Function input pins that version.
+func newS3GatewayEndpoint(cfg Config, name, vpcName string) runtime.Object {
+	ep := &awsv1beta1.VPCEndpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+				labelVPCID:     cfg.vpcIDLabel(vpcName),
+			}),
+		},
+		Spec: awsv1beta1.VPCEndpointSpec{
+			ForProvider: awsv1beta1.VPCEndpointParameters_2{
+				Region:          ptr.To(cfg.Region),
+				ServiceName:     ptr.To(fmt.Sprintf("com.amazonaws.%s.s3", cfg.Region)),
+				VPCEndpointType: ptr.To("Gateway"),
+				Tags:            tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+
+	if cfg.DisableManagedLabels {
+		ep.Spec.ForProvider.VPCIDRef = &v1.Reference{Name: vpcName}
+		return vpcEndpointAtVersion(cfg, ep)
+	}
+	ep.Spec.ForProvider.VPCIDSelector = &v1.Selector{
+		MatchControllerRef: ptr.To(true),
+		MatchLabels: map[string]string{
+			labelVPCID: cfg.vpcIDLabel(vpcName),
+		},
+	}
+	return vpcEndpointAtVersion(cfg, ep)
+}
+
+// newEndpointRouteTableAssociation returns a VPCEndpointRouteTableAssociation
+// with the supplied name, associating the named gateway endpoint with the
+// named VPC's route table for the supplied subnet tier. The route table is
+// selected by label unless managed labels are disabled, in which case it's
+// referenced by name.
+func newEndpointRouteTableAssociation(cfg Config, name, endpointName, vpcName, routeTableName, tier string) *awsv1beta1.VPCEndpointRouteTableAssociation {
+	a := &awsv1beta1.VPCEndpointRouteTableAssociation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+			}),
+		},
+		Spec: awsv1beta1.VPCEndpointRouteTableAssociationSpec{
+			ForProvider: awsv1beta1.VPCEndpointRouteTableAssociationParameters{
+				Region:           ptr.To(cfg.Region),
+				VPCEndpointIDRef: &v1.Reference{Name: endpointName},
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+
+	if cfg.DisableManagedLabels {
+		a.Spec.ForProvider.RouteTableIDRef = &v1.Reference{Name: routeTableName}
+		return a
+	}
+	a.Spec.ForProvider.RouteTableIDSelector = &v1.Selector{
+		MatchControllerRef: ptr.To(true),
+		MatchLabels: map[string]string{
+			labelVPCID:      cfg.vpcIDLabel(vpcName),
+			labelSubnetTier: tier,
+		},
+	}
+	return a
+}
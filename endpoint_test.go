@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunFunctionS3GatewayEndpoint(t *testing.T) {
+	type want struct {
+		services       map[string]string
+		endpointRefs   map[string]string
+		rtSelectors    map[string]string
+		rtTierSelector map[string]string
+		rtRefs         map[string]string
+		results        []string
+	}
+
+	xr := func(spec string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 2,
+				"s3GatewayEndpoint": true` + spec + `
+			}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Associated": {
+			reason: "Each VPC should get an S3 gateway endpoint associated with its route table, which is selected by label",
+			xr:     xr(`, "includeGateway": true, "publicSubnets": true, "availabilityZones": ["eu-central-1a"]`),
+			want: want{
+				services: map[string]string{
+					"s3endpoint-code-0": "com.amazonaws.eu-central-1.s3",
+					"s3endpoint-code-1": "com.amazonaws.eu-central-1.s3",
+				},
+				endpointRefs: map[string]string{
+					"s3endpoint-code-0-public": "s3endpoint-code-0",
+					"s3endpoint-code-1-public": "s3endpoint-code-1",
+				},
+				rtSelectors: map[string]string{
+					"s3endpoint-code-0-public": "vpc-code-0",
+					"s3endpoint-code-1-public": "vpc-code-1",
+				},
+				rtTierSelector: map[string]string{
+					"s3endpoint-code-0-public": "public",
+					"s3endpoint-code-1-public": "public",
+				},
+				rtRefs: map[string]string{},
+			},
+		},
+		"DisableManagedLabels": {
+			reason: "Without managed labels the association should reference the route table by name",
+			xr:     xr(`, "includeGateway": true, "publicSubnets": true, "availabilityZones": ["eu-central-1a"], "disableManagedLabels": true`),
+			want: want{
+				services: map[string]string{
+					"s3endpoint-code-0": "com.amazonaws.eu-central-1.s3",
+					"s3endpoint-code-1": "com.amazonaws.eu-central-1.s3",
+				},
+				endpointRefs: map[string]string{
+					"s3endpoint-code-0-public": "s3endpoint-code-0",
+					"s3endpoint-code-1-public": "s3endpoint-code-1",
+				},
+				rtSelectors:    map[string]string{},
+				rtTierSelector: map[string]string{},
+				rtRefs: map[string]string{
+					"s3endpoint-code-0-public": "routetable-code-0-public",
+					"s3endpoint-code-1-public": "routetable-code-1-public",
+				},
+			},
+		},
+		"NoRouteTables": {
+			reason: "An S3 gateway endpoint without route tables to associate with should return a fatal result",
+			xr:     xr(`, "privateSubnets": true, "availabilityZones": ["eu-central-1a"]`),
+			want: want{
+				services:       map[string]string{},
+				endpointRefs:   map[string]string{},
+				rtSelectors:    map[string]string{},
+				rtTierSelector: map[string]string{},
+				rtRefs:         map[string]string{},
+				results:        []string{"invalid network config: spec.s3GatewayEndpoint: requires route tables, which are only created for public subnets with an InternetGateway"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.services, desiredStrings(t, rsp, "spec.forProvider.serviceName")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want endpoint services, +got endpoint services:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.endpointRefs, desiredStrings(t, rsp, "spec.forProvider.vpcEndpointIdRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want endpoint references, +got endpoint references:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.rtSelectors, desiredStrings(t, rsp, "spec.forProvider.routeTableIdSelector.matchLabels[networks.meta.fn.crossplane.io/vpc-id]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want route table VPC selectors, +got route table VPC selectors:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.rtTierSelector, desiredStrings(t, rsp, "spec.forProvider.routeTableIdSelector.matchLabels[networks.meta.fn.crossplane.io/subnet-tier]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want route table tier selectors, +got route table tier selectors:\n%s", tc.reason, diff)
+			}
+			// routes and subnet associations also reference route tables by
+			// name, so only consider the endpoint associations
+			got := desiredStrings(t, rsp, "spec.forProvider.routeTableIdRef.name")
+			for name := range got {
+				if _, ok := tc.want.endpointRefs[name]; !ok {
+					delete(got, name)
+				}
+			}
+			if diff := cmp.Diff(tc.want.rtRefs, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want route table references, +got route table references:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/config"
+)
+
+func TestRunFunctionEnvironmentCIDRPools(t *testing.T) {
+	input := `{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"environmentCidrPools": {"dev": "10.10.0.0/16", "prod": "10.20.0.0/16"}
+	}`
+	xr := func(spec string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1` + spec + `
+			}
+		}`
+	}
+
+	type want struct {
+		cidrs   map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Dev": {
+			reason: "A dev network should take its CIDR block from the dev pool",
+			xr:     xr(`, "environment": "dev"`),
+			want: want{
+				cidrs: map[string]string{"vpc-code-0": "10.10.0.0/16"},
+			},
+		},
+		"Prod": {
+			reason: "A prod network should take its CIDR block from the prod pool",
+			xr:     xr(`, "environment": "prod"`),
+			want: want{
+				cidrs: map[string]string{"vpc-code-0": "10.20.0.0/16"},
+			},
+		},
+		"NoEnvironment": {
+			reason: "A network without an environment should use the default CIDR block",
+			xr:     xr(""),
+			want: want{
+				cidrs: map[string]string{"vpc-code-0": config.DefaultCIDRBlock},
+			},
+		},
+		"WithinPool": {
+			reason: "A CIDR block set within the environment's pool should be used",
+			xr:     xr(`, "environment": "prod", "cidrBlock": "10.20.0.0/20"`),
+			want: want{
+				cidrs: map[string]string{"vpc-code-0": "10.20.0.0/20"},
+			},
+		},
+		"OutsidePool": {
+			reason: "A CIDR block set outside the environment's pool should return a fatal result",
+			xr:     xr(`, "environment": "prod", "cidrBlock": "10.10.0.0/20"`),
+			want: want{
+				cidrs:   map[string]string{},
+				results: []string{`invalid network config: spec.cidrBlock: CIDR block "10.10.0.0/20" is outside 10.20.0.0/16, the CIDR pool of environment "prod"`},
+			},
+		},
+		"UnknownEnvironment": {
+			reason: "An environment without a pool should return a fatal result",
+			xr:     xr(`, "environment": "stage"`),
+			want: want{
+				cidrs:   map[string]string{},
+				results: []string{`invalid network config: spec.environment: the Function input has no CIDR pool for environment "stage"`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input:    resource.MustStructJSON(input),
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cidrs, onlyPrefix(desiredStrings(t, rsp, "spec.forProvider.cidrBlock"), "vpc-")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want cidrBlock, +got cidrBlock:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
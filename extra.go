@@ -0,0 +1,22 @@
+package main
+
+import (
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+// requireResource asks Crossplane to supply the named resource as the extra
+// resource with the supplied key. Crossplane calls the function again once
+// it's done so.
+func requireResource(rsp *fnv1.RunFunctionResponse, key, apiVersion, kind, name string) {
+	if rsp.Requirements == nil {
+		rsp.Requirements = &fnv1.Requirements{}
+	}
+	if rsp.Requirements.ExtraResources == nil {
+		rsp.Requirements.ExtraResources = map[string]*fnv1.ResourceSelector{}
+	}
+	rsp.Requirements.ExtraResources[key] = &fnv1.ResourceSelector{
+		ApiVersion: apiVersion,
+		Kind:       kind,
+		Match:      &fnv1.ResourceSelector_MatchName{MatchName: name},
+	}
+}
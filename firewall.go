@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+
+	nfv1beta1 "github.com/upbound/provider-aws/apis/networkfirewall/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// firewallRuleGroupCapacity is the capacity of each VPC's stateless rule
+// group. AWS doesn't allow it to change once the group is created, so it
+// leaves room for rules to be added later.
+const firewallRuleGroupCapacity = 100
+
+// firewallForward hands traffic to the firewall's stateful engine.
+const firewallForward = "aws:forward_to_sfe"
+
+// deploysNetworkFirewall returns true if the config's VPCs should each get a
+// Network Firewall in their firewall subnets.
+func (c Config) deploysNetworkFirewall() bool {
+	return c.EnableNetworkFirewall && c.FirewallSubnets && len(c.AvailabilityZones) > 0
+}
+
+// newFirewallRuleGroup returns a basic stateless RuleGroup with the supplied
+// name, that forwards all IPv4 traffic to the stateful engine.
+func newFirewallRuleGroup(cfg Config, name string) *nfv1beta1.RuleGroup {
+	return &nfv1beta1.RuleGroup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+			}),
+		},
+		Spec: nfv1beta1.RuleGroupSpec{
+			ForProvider: nfv1beta1.RuleGroupParameters{
+				Region:   ptr.To(cfg.Region),
+				Name:     ptr.To(name),
+				Type:     ptr.To("STATELESS"),
+				Capacity: ptr.To(float64(firewallRuleGroupCapacity)),
+				RuleGroup: []nfv1beta1.RuleGroupRuleGroupParameters{{
+					RulesSource: []nfv1beta1.RulesSourceParameters{{
+						StatelessRulesAndCustomActions: []nfv1beta1.StatelessRulesAndCustomActionsParameters{{
+							StatelessRule: []nfv1beta1.StatelessRuleParameters{{
+								Priority: ptr.To(float64(1)),
+								RuleDefinition: []nfv1beta1.RuleDefinitionParameters{{
+									Actions: []*string{ptr.To(firewallForward)},
+									MatchAttributes: []nfv1beta1.MatchAttributesParameters{{
+										Source:      []nfv1beta1.SourceParameters{{AddressDefinition: ptr.To("0.0.0.0/0")}},
+										Destination: []nfv1beta1.DestinationParameters{{AddressDefinition: ptr.To("0.0.0.0/0")}},
+									}},
+								}},
+							}},
+						}},
+					}},
+				}},
+				Tags: tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+}
+
+// newFirewallPolicy returns a FirewallPolicy with the supplied name that
+// applies the named stateless rule group, and forwards any traffic it doesn't
+// match to the stateful engine.
+func newFirewallPolicy(cfg Config, name, ruleGroupName string) *nfv1beta1.FirewallPolicy {
+	return &nfv1beta1.FirewallPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+			}),
+		},
+		Spec: nfv1beta1.FirewallPolicySpec{
+			ForProvider: nfv1beta1.FirewallPolicyParameters{
+				Region: ptr.To(cfg.Region),
+				FirewallPolicy: []nfv1beta1.FirewallPolicyFirewallPolicyParameters{{
+					StatelessDefaultActions:         []*string{ptr.To(firewallForward)},
+					StatelessFragmentDefaultActions: []*string{ptr.To(firewallForward)},
+					StatelessRuleGroupReference: []nfv1beta1.StatelessRuleGroupReferenceParameters{{
+						Priority:       ptr.To(float64(1)),
+						ResourceArnRef: &v1.Reference{Name: ruleGroupName},
+					}},
+				}},
+				Tags: tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+}
+
+// newFirewall returns a Network Firewall with the supplied name in the named
+// VPC, using the named policy, with an endpoint in each of the VPC's firewall
+// subnets. The VPC is selected by label unless managed labels are disabled, in
+// which case it's referenced by name.
+func newFirewall(cfg Config, name, vpcName, policyName string, subnets []subnet) *nfv1beta1.Firewall {
+	fw := &nfv1beta1.Firewall{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+				labelVPCID:     cfg.vpcIDLabel(vpcName),
+			}),
+		},
+		Spec: nfv1beta1.FirewallSpec{
+			ForProvider: nfv1beta1.FirewallParameters{
+				Region:               ptr.To(cfg.Region),
+				Name:                 ptr.To(name),
+				Description:          ptr.To(fmt.Sprintf("Inspects traffic of VPC %s", vpcName)),
+				FirewallPolicyArnRef: &v1.Reference{Name: policyName},
+				Tags:                 tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+	for _, s := range subnets {
+		if s.Tier == tierFirewall {
+			fw.Spec.ForProvider.SubnetMapping = append(fw.Spec.ForProvider.SubnetMapping, nfv1beta1.SubnetMappingParameters{
+				SubnetIDRef: &v1.Reference{Name: s.Name},
+			})
+		}
+	}
+
+	if cfg.DisableManagedLabels {
+		fw.Spec.ForProvider.VPCIDRef = &v1.Reference{Name: vpcName}
+		return fw
+	}
+	fw.Spec.ForProvider.VPCIDSelector = &v1.Selector{
+		MatchControllerRef: ptr.To(true),
+		MatchLabels: map[string]string{
+			labelVPCID: cfg.vpcIDLabel(vpcName),
+		},
+	}
+	return fw
+}
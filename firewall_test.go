@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunFunctionNetworkFirewall(t *testing.T) {
+	xr := func(extra string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"region": "eu-central-1",
+				"availabilityZones": ["eu-central-1a", "eu-central-1b"]` + extra + `
+			}
+		}`
+	}
+
+	type want struct {
+		ruleGroupTypes map[string]string
+		policyRefs     map[string]string
+		mappings       map[string]string
+		results        []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Disabled": {
+			reason: "No firewall should be created unless it's enabled, even with firewall subnets",
+			xr:     xr(`, "firewallSubnets": true`),
+			want: want{
+				ruleGroupTypes: map[string]string{},
+				policyRefs:     map[string]string{},
+				mappings:       map[string]string{},
+			},
+		},
+		"Enabled": {
+			reason: "A firewall, policy and stateless rule group should be created, with an endpoint in each firewall subnet",
+			xr:     xr(`, "firewallSubnets": true, "enableNetworkFirewall": true`),
+			want: want{
+				ruleGroupTypes: map[string]string{"firewallrulegroup-code-0": "STATELESS"},
+				policyRefs: map[string]string{
+					"firewallpolicy-code-0": "firewallrulegroup-code-0",
+					"firewall-code-0":       "firewallpolicy-code-0",
+				},
+				mappings: map[string]string{
+					"subnet-code-0-firewall-0": "firewall-code-0",
+					"subnet-code-0-firewall-1": "firewall-code-0",
+				},
+			},
+		},
+		"NoFirewallSubnets": {
+			reason: "Enabling the firewall without firewall subnets should return a fatal result",
+			xr:     xr(`, "enableNetworkFirewall": true`),
+			want: want{
+				ruleGroupTypes: map[string]string{},
+				policyRefs:     map[string]string{},
+				mappings:       map[string]string{},
+				results:        []string{"invalid network config: spec.enableNetworkFirewall: requires spec.firewallSubnets and at least one availability zone"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ruleGroupTypes, desiredStrings(t, rsp, "spec.forProvider.type")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want rule group types, +got rule group types:\n%s", tc.reason, diff)
+			}
+
+			refs := desiredStrings(t, rsp, "spec.forProvider.firewallPolicy[0].statelessRuleGroupReference[0].resourceArnRef.name")
+			for name, ref := range desiredStrings(t, rsp, "spec.forProvider.firewallPolicyArnRef.name") {
+				refs[name] = ref
+			}
+			if diff := cmp.Diff(tc.want.policyRefs, refs); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want policy refs, +got policy refs:\n%s", tc.reason, diff)
+			}
+
+			mappings := map[string]string{}
+			for name := range desiredStrings(t, rsp, "spec.forProvider.firewallPolicyArnRef.name") {
+				for i := 0; ; i++ {
+					m := desiredStrings(t, rsp, fmt.Sprintf("spec.forProvider.subnetMapping[%d].subnetIdRef.name", i))
+					if len(m) == 0 {
+						break
+					}
+					mappings[m[name]] = name
+				}
+			}
+			if diff := cmp.Diff(tc.want.mappings, mappings); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want subnet mappings, +got subnet mappings:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
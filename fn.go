@@ -3,144 +3,1726 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
-	"github.com/crossplane/function-sdk-go/request"
 	"github.com/crossplane/function-sdk-go/resource"
 	"github.com/crossplane/function-sdk-go/resource/composed"
 	"github.com/crossplane/function-sdk-go/response"
 	"github.com/pkg/errors"
 
+	"github.com/jbw976/demo-xfn-network/config"
+	"github.com/jbw976/demo-xfn-network/input/v1beta1"
+	"github.com/jbw976/demo-xfn-network/names"
+
 	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	awsv1beta2 "github.com/upbound/provider-aws/apis/ec2/v1beta2"
+	nfv1beta1 "github.com/upbound/provider-aws/apis/networkfirewall/v1beta1"
+	rdsv1beta1 "github.com/upbound/provider-aws/apis/rds/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/utils/ptr"
 )
 
+const (
+	// subnetPrefixLength is the size of each subnet carved from a VPC's CIDR
+	// block.
+	subnetPrefixLength = 24
+
+	// ipv6VPCPrefixLength is the size of the Amazon-provided IPv6 CIDR block
+	// of a VPC.
+	ipv6VPCPrefixLength = 56
+
+	// ipv6SubnetPrefixLength is the size of each subnet carved from a VPC's
+	// IPv6 CIDR block. AWS requires IPv6 subnets to be /64s.
+	ipv6SubnetPrefixLength = 64
+
+	// defaultMaxTotalResources is the default for the most composed resources
+	// the function will produce for a single XR.
+	defaultMaxTotalResources = 200
+
+	// minDBSubnetGroupAZs is the number of availability zones RDS requires a
+	// DB subnet group to span.
+	minDBSubnetGroupAZs = 2
+)
+
+// Labels used to relate the resources this function composes to each other.
+const (
+	labelNetworkID  = "networks.meta.fn.crossplane.io/network-id"
+	labelVPCID      = "networks.meta.fn.crossplane.io/vpc-id"
+	labelSubnetTier = "networks.meta.fn.crossplane.io/subnet-tier"
+	labelRole       = "networks.meta.fn.crossplane.io/role"
+)
+
+// annotationCIDR is an informational annotation holding the CIDR block assigned
+// to a VPC or subnet, for tooling that doesn't read the spec.
+const annotationCIDR = "networks.meta.fn.crossplane.io/cidr"
+
+// annotationSpecHash holds a hash of the spec.forProvider a composed resource
+// was built with, so that external tooling can detect drift.
+const annotationSpecHash = "networks.meta.fn.crossplane.io/spec-hash"
+
+// annotationExpiresAt holds the RFC 3339 time after which an external reaper
+// may delete a composed resource of an ephemeral network.
+const annotationExpiresAt = "networks.meta.fn.crossplane.io/expires-at"
+
+// Reasons of informational results.
+const (
+	// reasonVersion is the reason of the result reporting the function's
+	// version.
+	reasonVersion = "FunctionVersion"
+
+	// reasonConsoleLink is the reason of the results linking to each VPC in
+	// the AWS console.
+	reasonConsoleLink = "VPCConsoleLink"
+
+	// reasonResourceGraph is the reason of the result holding the graph of
+	// composed resources, when spec.emitGraph is set.
+	reasonResourceGraph = "ResourceGraph"
+
+	// reasonGatewayChanges is the reason of the result summarizing which
+	// InternetGateways are new, and which are already attached.
+	reasonGatewayChanges = "GatewayChanges"
+
+	// reasonFreeAddressSpace is the reason of the results reporting how much
+	// of each VPC's CIDR block no subnet uses.
+	reasonFreeAddressSpace = "FreeAddressSpace"
+
+	// reasonNetworkSummary is the reason of the result summarizing the
+	// observed composed resources, when spec.mode is report.
+	reasonNetworkSummary = "NetworkSummary"
+
+	// reasonProviderConfigAssumed is the reason of the warning that an XR
+	// without spec.providerConfigName uses the default ProviderConfig.
+	reasonProviderConfigAssumed = "ProviderConfigAssumed"
+
+	// reasonProviderConfigAssignment is the reason of the results listing
+	// the composed resources that use each ProviderConfig other than
+	// default.
+	reasonProviderConfigAssignment = "ProviderConfigAssignment"
+
+	// reasonForProviderDiff is the reason of the results listing how each
+	// observed resource's spec.forProvider will change, when spec.emitDiff
+	// is set.
+	reasonForProviderDiff = "ForProviderDiff"
+
+	// reasonStatusPatch is the reason of the result holding the JSON patch
+	// the function applies to the XR's status, when spec.emitStatusPatch is
+	// set.
+	reasonStatusPatch = "StatusPatch"
+
+	// reasonSyncFailed is the reason of the warnings relaying the error of
+	// each observed resource whose Synced condition is False.
+	reasonSyncFailed = "ResourceSyncFailed"
+
+	// reasonTopologyConflict is the reason of the warnings that a field is
+	// ignored because spec.topology overrides it.
+	reasonTopologyConflict = "TopologyConflict"
+)
+
+// The condition set on the XR when spec.readyTimeoutSeconds is set, and its
+// reasons.
+const (
+	conditionNetworkProgressing = "NetworkProgressing"
+
+	reasonResourcesPending = "ResourcesPending"
+	reasonResourcesReady   = "ResourcesReady"
+	reasonNetworkStalled   = "NetworkStalled"
+)
+
+// supportedAWSAPIVersions are the ec2.aws.upbound.io API versions the Function
+// can compose. It's built with provider-aws types, and the VPC, Subnet, and
+// InternetGateway kinds it composes exist only at v1beta1, so at v1beta2 only
+// Routes and VPCEndpoints are composed at v1beta2.
+var supportedAWSAPIVersions = []string{awsv1beta1.CRDGroupVersion.Version, awsv1beta2.CRDGroupVersion.Version}
+
+// Subnet tiers.
+const (
+	tierPublic   = "public"
+	tierPrivate  = "private"
+	tierFirewall = "firewall"
+)
+
+// VPC roles. In hub-and-spoke designs the primary VPC is the hub. Private VPCs
+// have no route to the internet.
+const (
+	rolePrimary   = "primary"
+	roleSecondary = "secondary"
+	rolePrivate   = "private"
+)
+
+// Config is the network configuration read from the observed XR, with all
+// defaults applied, and anything the function resolves from the rest of the
+// request.
+type Config struct {
+	config.Config
+
+	// VPCIndexes are the indexes of the network's VPCs, when
+	// spec.fillIndexGaps resolved them from the observed VPCs.
+	VPCIndexes []int64
+
+	// AZSlots are the slots of the availability zones, when
+	// spec.stableResourceKeys resolved them from the observed subnets.
+	AZSlots map[string]int
+
+	// AWSAPIVersion is the ec2.aws.upbound.io API version the Function input
+	// pins, if any.
+	AWSAPIVersion string
+}
+
+// getConfig reads the network configuration from the supplied XR and input,
+// defaulting any optional fields that are unset.
+func getConfig(oxr *resource.Composite, in *v1beta1.Input, d config.Defaults) (Config, error) {
+	c, err := config.ParseWithInput(oxr, in, d)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Config{Config: c}
+	if in.AWSAPIVersion != nil {
+		cfg.AWSAPIVersion = *in.AWSAPIVersion
+	}
+	return cfg, nil
+}
+
+// withoutDefault returns the supplied defaulted fields, less the named field.
+func withoutDefault(fields []config.DefaultedField, field string) []config.DefaultedField {
+	out := make([]config.DefaultedField, 0, len(fields))
+	for _, d := range fields {
+		if d.Field != field {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// A ValidationError is returned when a field of the XR is invalid. Errors
+// caused by a Function bug or by the Function's environment are not
+// ValidationErrors.
+type ValidationError = config.ValidationError
+
+// validate returns a ValidationError if the supplied config can't be used to
+// build a working network.
+func (c Config) validate() error {
+	if azs, _ := uniqueAZs(c.AvailabilityZones); c.EnableIPv6 {
+		// each subnet gets the /64 at its index of the VPC's /56
+		limit := 1 << (ipv6SubnetPrefixLength - ipv6VPCPrefixLength)
+		if n := len(c.subnetTiers()) * len(azs); n > limit {
+			return &ValidationError{Field: "spec.availabilityZones", Reason: fmt.Sprintf("%d subnets per VPC exceed the %d /%d IPv6 subnets of a /%d", n, limit, ipv6SubnetPrefixLength, ipv6VPCPrefixLength)}
+		}
+	}
+	if c.SubnetAlignment != 0 && (c.SubnetAlignment < config.MinVPCPrefixLength || c.SubnetAlignment > subnetPrefixLength) {
+		return &ValidationError{Field: "spec.subnetAlignment", Reason: fmt.Sprintf("/%d subnets can't be aligned on a /%d boundary; must be between /%d and /%d", subnetPrefixLength, c.SubnetAlignment, config.MinVPCPrefixLength, subnetPrefixLength)}
+	}
+	if c.UsesIPAM() {
+		if err := c.validateIPAM(); err != nil {
+			return err
+		}
+		if c.DivideCIDRBlock && c.Count > 0 {
+			return &ValidationError{Field: "spec.divideCidrBlock", Reason: "cannot be combined with spec.ipv4IpamPoolId"}
+		}
+	} else if err := c.validateCIDRBlock(); err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		path string
+		tags map[string]string
+	}{
+		{path: "spec.tags", tags: c.Tags},
+		{path: "spec.publicSubnetTags", tags: c.PublicSubnetTags},
+		{path: "spec.privateSubnetTags", tags: c.PrivateSubnetTags},
+	} {
+		if err := validateTags(f.tags); err != nil {
+			return &ValidationError{Field: f.path, Reason: err.Error()}
+		}
+	}
+	if c.ClusterName != "" {
+		if err := validateClusterName(c.ClusterName); err != nil {
+			return &ValidationError{Field: "spec.clusterName", Reason: err.Error()}
+		}
+	}
+	if err := c.validateTagCount(); err != nil {
+		return err
+	}
+	// with spec.fillIndexGaps the indexes of the network's VPCs aren't known
+	// until they're resolved from the observed VPCs, so RunFunction validates
+	// the fields that refer to them then
+	if !c.FillIndexGaps {
+		if err := c.validateVPCIndexes(); err != nil {
+			return err
+		}
+	}
+	for i, az := range c.AvailabilityZones {
+		if !inRegion(c.Region, az) {
+			return &ValidationError{Field: fmt.Sprintf("spec.availabilityZones[%d]", i), Reason: fmt.Sprintf("%s is not in region %s", az, c.Region)}
+		}
+	}
+	if err := c.validateRegionOverrides(); err != nil {
+		return err
+	}
+	if _, dupes := uniqueAZs(c.AvailabilityZones); c.Strict && len(dupes) > 0 {
+		return &ValidationError{Field: "spec.availabilityZones", Reason: fmt.Sprintf("lists %s more than once", strings.Join(dupes, ", "))}
+	}
+	if c.PrefixList != nil {
+		if err := prefixList(*c.PrefixList).validate(); err != nil {
+			return &ValidationError{Field: "spec.prefixList", Reason: err.Error()}
+		}
+	}
+	if err := c.validateIGWRouteCIDRs(); err != nil {
+		return err
+	}
+	if err := c.validateResourceNameOverrides(); err != nil {
+		return err
+	}
+	if c.PredictableVPCNames && c.Count > 0 {
+		// the last VPC's index is the longest
+		if n := names.VPCNameTag(c.ID, c.Count-1); utf8.RuneCountInString(n) > maxTagValueLength {
+			return &ValidationError{Field: "spec.id", Reason: fmt.Sprintf("VPC Name tags such as %q are longer than the %d characters AWS allows", n, maxTagValueLength)}
+		}
+	}
+	if c.S3GatewayEndpoint && !c.routesPublicSubnets() {
+		// a gateway endpoint does nothing without route tables to add it to
+		return &ValidationError{Field: "spec.s3GatewayEndpoint", Reason: "requires route tables, which are only created for public subnets with an InternetGateway"}
+	}
+	if c.EnableNetworkFirewall && !c.deploysNetworkFirewall() {
+		return &ValidationError{Field: "spec.enableNetworkFirewall", Reason: "requires spec.firewallSubnets and at least one availability zone"}
+	}
+	if err := c.validateNATGatewayStrategy(); err != nil {
+		return err
+	}
+	if c.PrivateRouteTablePerAZ && !c.routesPrivateSubnetsPerAZ() {
+		return &ValidationError{Field: "spec.privateRouteTablePerAz", Reason: "requires spec.privateSubnets and at least one availability zone"}
+	}
+	if c.DefaultEgressCIDR != "" {
+		if !c.LockdownDefaultSG {
+			return &ValidationError{Field: "spec.defaultEgressCidr", Reason: "requires spec.lockdownDefaultSg"}
+		}
+		if err := validateIPv4CIDR(c.DefaultEgressCIDR); err != nil {
+			return &ValidationError{Field: "spec.defaultEgressCidr", Reason: err.Error()}
+		}
+	}
+	if err := c.validateGatewayVPCSelector(); err != nil {
+		return err
+	}
+	if err := c.validateConnectionSecrets(); err != nil {
+		return err
+	}
+	if err := c.validateGenerateName(); err != nil {
+		return err
+	}
+	if c.HashResourceKeys && !c.UseGenerateName {
+		// observed resources are matched to their hashed keys by their
+		// generateName prefix
+		return &ValidationError{Field: "spec.hashResourceKeys", Reason: "requires spec.useGenerateName"}
+	}
+	if c.FillIndexGaps && c.DivideCIDRBlock {
+		// a VPC's share of the CIDR block depends on its index
+		return &ValidationError{Field: "spec.fillIndexGaps", Reason: "cannot be combined with spec.divideCidrBlock"}
+	}
+	if c.ProviderConfigs != nil && len(c.ProviderConfigs) == 0 {
+		return &ValidationError{Field: "spec.providerConfigs", Reason: "must not be empty when set"}
+	}
+	if c.CreateDBSubnetGroup {
+		azs := map[string]bool{}
+		for _, az := range c.AvailabilityZones {
+			azs[az] = true
+		}
+		if !c.PrivateSubnets || len(azs) < minDBSubnetGroupAZs {
+			return &ValidationError{Field: "spec.createDbSubnetGroup", Reason: fmt.Sprintf("requires private subnets in at least %d availability zones", minDBSubnetGroupAZs)}
+		}
+	}
+	return nil
+}
+
+// validateCIDRBlock returns a ValidationError if spec.cidrBlock, or each VPC's
+// share of it when it's divided, isn't a CIDR block AWS allows for a VPC or
+// hasn't room for every subnet.
+func (c Config) validateCIDRBlock() error {
+	if err := validateIPv4CIDR(c.CIDRBlock); err != nil {
+		return &ValidationError{Field: "spec.cidrBlock", Reason: err.Error()}
+	}
+	bits := netip.MustParsePrefix(c.CIDRBlock).Bits()
+	if c.MinCIDRPrefixLength > 0 && int64(bits) < c.MinCIDRPrefixLength {
+		return &ValidationError{Field: "spec.cidrBlock", Reason: fmt.Sprintf("CIDR block %q is larger than /%d, the largest the Function input allows", c.CIDRBlock, c.MinCIDRPrefixLength)}
+	}
+	if c.DivideCIDRBlock && c.Count > 0 {
+		b, err := vpcPrefixLength(c.CIDRBlock, c.Count)
+		if err != nil {
+			return &ValidationError{Field: "spec.cidrBlock", Reason: err.Error()}
+		}
+		bits = b
+	} else if err := validateVPCCIDR(c.CIDRBlock); err != nil {
+		return &ValidationError{Field: "spec.cidrBlock", Reason: err.Error()}
+	}
+	if err := c.validateSubnetsPerAZ(); err != nil {
+		return err
+	}
+	// duplicate AZs are collapsed before subnets are planned, so aren't
+	// counted
+	if err := checkSubnetsFit(bits, c.subnetStride(), c.subnetBlocks()); err != nil {
+		return &ValidationError{Field: "spec.cidrBlock", Reason: err.Error()}
+	}
+	return nil
+}
+
+// subnetStride returns the prefix length of the blocks each subnet is carved
+// from the start of. Subnets are packed contiguously unless spec.subnetAlignment
+// asks for a larger boundary.
+func (c Config) subnetStride() int {
+	if c.SubnetAlignment == 0 {
+		return subnetPrefixLength
+	}
+	return int(c.SubnetAlignment)
+}
+
+// validateGenerateName returns a ValidationError if spec.useGenerateName is
+// set along with anything that references a resource by name, since names
+// aren't known until the API server generates them.
+func (c Config) validateGenerateName() error {
+	if !c.UseGenerateName {
+		return nil
+	}
+	switch {
+	case c.DisableManagedLabels:
+		return &ValidationError{Field: "spec.useGenerateName", Reason: "cannot be combined with spec.disableManagedLabels, since resources must select each other by label"}
+	case c.GatewayRefByName:
+		return &ValidationError{Field: "spec.useGenerateName", Reason: "cannot be combined with spec.gatewayRefByName, since gateways must select their VPC by label"}
+	case c.routesPublicSubnets():
+		return &ValidationError{Field: "spec.useGenerateName", Reason: "cannot be combined with public subnets and an InternetGateway, since their routes reference the gateway and route table by name"}
+	case c.routesPrivateSubnetsPerAZ():
+		return &ValidationError{Field: "spec.useGenerateName", Reason: "cannot be combined with spec.privateRouteTablePerAz, since subnets are associated with their route table by name"}
+	case c.DeletionOrdering:
+		return &ValidationError{Field: "spec.useGenerateName", Reason: "cannot be combined with spec.deletionOrdering, since Usages reference resources by name"}
+	case c.deploysNetworkFirewall():
+		return &ValidationError{Field: "spec.useGenerateName", Reason: "cannot be combined with spec.enableNetworkFirewall, since the firewall references its policy and subnets, and the policy its rule group, by name"}
+	}
+	return nil
+}
+
+// validateVPCIndexes returns a ValidationError if any of the fields that refer
+// to VPCs by index, such as spec.privateVpcIndexes, refers to an index that
+// isn't one of the network's VPCs, or refers to a VPC more than once.
+func (c Config) validateVPCIndexes() error {
+	if c.PrimaryVPCIndex < 0 || (c.PrimaryVPCIndex != 0 && !c.hasVPCIndex(c.PrimaryVPCIndex)) {
+		return &ValidationError{Field: "spec.primaryVpcIndex", Reason: fmt.Sprintf("%d is out of range for %s", c.PrimaryVPCIndex, c.vpcIndexRange())}
+	}
+	seen := map[int64]bool{}
+	for j, i := range c.PrivateVPCIndexes {
+		field := fmt.Sprintf("spec.privateVpcIndexes[%d]", j)
+		if i < 0 {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%d is out of range for %s", i, c.vpcIndexRange())}
+		}
+		if !c.hasVPCIndex(i) {
+			// most likely spec.count was reduced without this field, which
+			// would otherwise leave a VPC added back later at this index
+			// public again
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%d is out of range for %s; when reducing spec.count, remove the indexes of the VPCs it drops from spec.privateVpcIndexes too", i, c.vpcIndexRange())}
+		}
+		if seen[i] {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%d is listed more than once", i)}
+		}
+		seen[i] = true
+	}
+	gateways := map[int64]bool{}
+	for j, i := range c.GatewayVPCIndexes {
+		field := fmt.Sprintf("spec.gatewayVpcIndexes[%d]", j)
+		if !c.hasVPCIndex(i) {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%d is out of range for %s", i, c.vpcIndexRange())}
+		}
+		if gateways[i] {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%d is listed more than once", i)}
+		}
+		if c.isPrivateVPC(i) {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("VPC %d is also listed in spec.privateVpcIndexes", i)}
+		}
+		gateways[i] = true
+	}
+	return c.validateVPCIDLabels()
+}
+
+// validateVPCIDLabels returns a ValidationError if any of the vpc-id label
+// overrides isn't for a VPC, isn't a valid label value, or would label two VPCs
+// the same.
+func (c Config) validateVPCIDLabels() error {
+	indexes := make([]int64, 0, len(c.VPCIDLabels))
+	for i := range c.VPCIDLabels {
+		indexes = append(indexes, i)
+	}
+	// check in a stable order so the same bad input always reports the same
+	// index
+	sort.Slice(indexes, func(a, b int) bool { return indexes[a] < indexes[b] })
+
+	used := map[string]int64{}
+	for _, i := range indexes {
+		field := fmt.Sprintf("spec.vpcIdLabels[%d]", i)
+		if !c.hasVPCIndex(i) {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%d is out of range for %s", i, c.vpcIndexRange())}
+		}
+		v := c.VPCIDLabels[i]
+		if errs := validation.IsValidLabelValue(v); v == "" || len(errs) > 0 {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%q is not a valid label value", v)}
+		}
+		if j, ok := used[v]; ok {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%q is already the vpc-id label of VPC %d", v, j)}
+		}
+		if j, ok := c.defaultVPCIDLabelIndex(v); ok {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%q is already the vpc-id label of VPC %d", v, j)}
+		}
+		used[v] = i
+	}
+	return nil
+}
+
+// defaultVPCIDLabelIndex returns the index of the VPC whose default vpc-id
+// label is the supplied value, if that VPC's label isn't overridden.
+func (c Config) defaultVPCIDLabelIndex(v string) (int64, bool) {
+	n, ok := strings.CutPrefix(v, "vpc-"+c.ID+"-")
+	if !ok {
+		return 0, false
+	}
+	j, err := strconv.ParseInt(n, 10, 64)
+	if err != nil || !c.hasVPCIndex(j) || names.VPCName(c.ID, j) != v {
+		return 0, false
+	}
+	if _, overridden := c.VPCIDLabels[j]; overridden {
+		return 0, false
+	}
+	return j, true
+}
+
+// validateIPAM returns a ValidationError if the IPAM allocation settings are
+// incomplete or conflict with other settings.
+func (c Config) validateIPAM() error {
+	if c.IPv4IPAMPoolID == "" || c.IPv4NetmaskLength == 0 {
+		return &ValidationError{Field: "spec.ipv4IpamPoolId", Reason: "must be set together with spec.ipv4NetmaskLength"}
+	}
+	if c.CIDRBlock != "" {
+		return &ValidationError{Field: "spec.cidrBlock", Reason: "cannot be combined with spec.ipv4IpamPoolId"}
+	}
+	if c.IPv4NetmaskLength < config.MinVPCPrefixLength || c.IPv4NetmaskLength > config.MaxVPCPrefixLength {
+		return &ValidationError{Field: "spec.ipv4NetmaskLength", Reason: fmt.Sprintf("must be between %d and %d", config.MinVPCPrefixLength, config.MaxVPCPrefixLength)}
+	}
+	if len(c.subnetTiers()) > 0 && len(c.AvailabilityZones) > 0 {
+		// we carve subnets from the VPC's CIDR block, which we don't know
+		// until IPAM allocates it
+		return &ValidationError{Field: "spec.ipv4IpamPoolId", Reason: "cannot be combined with subnets, which are carved from the VPC's CIDR block before IPAM allocates it"}
+	}
+	return nil
+}
+
+// forVPC returns the config to use for the i'th VPC and its dependent
+// resources. When spec.providerConfigs is set VPCs are assigned to its
+// provider configs round-robin, so VPC 0 uses the first, VPC 1 the second and
+// so on. When spec.divideCidrBlock is set each VPC gets its share of the CIDR
+// block. Private VPCs get no gateway or public subnets, and when
+// spec.gatewayVpcIndexes is set only the VPCs it lists get a gateway.
+func (c Config) forVPC(i int64) Config {
+	if len(c.ProviderConfigs) > 0 {
+		c.ProviderConfigName = c.ProviderConfigs[i%int64(len(c.ProviderConfigs))]
+	}
+	if c.isPrivateVPC(i) {
+		c.IncludeGateway, c.PublicSubnets, c.NATGatewayStrategy = false, false, ""
+	}
+	if len(c.GatewayVPCIndexes) > 0 && !slices.Contains(c.GatewayVPCIndexes, i) {
+		c.IncludeGateway, c.NATGatewayStrategy = false, ""
+	}
+	if c.DivideCIDRBlock {
+		// validate ensures the block can be divided among every VPC
+		bits, _ := vpcPrefixLength(c.CIDRBlock, c.Count)
+		c.CIDRBlock, _ = subnetCIDR(c.CIDRBlock, bits, int(i))
+	}
+	return c
+}
+
+// isPrivateVPC returns true if the i'th VPC is listed in
+// spec.privateVpcIndexes.
+func (c Config) isPrivateVPC(i int64) bool {
+	return slices.Contains(c.PrivateVPCIndexes, i)
+}
+
+// vpcRole returns the role of the i'th VPC. A private VPC's role is private,
+// even if it's the primary VPC.
+func (c Config) vpcRole(i int64) string {
+	if c.isPrivateVPC(i) {
+		return rolePrivate
+	}
+	if i == c.PrimaryVPCIndex {
+		return rolePrimary
+	}
+	return roleSecondary
+}
+
+func init() {
+	// Add the AWS EC2 v1beta1 types (including VPC, InternetGateway and
+	// ManagedPrefixList) and v1beta2 types (including Route and VPCEndpoint),
+	// the RDS v1beta1 types (including SubnetGroup), and the Network Firewall
+	// v1beta1 types to the composed resource scheme.
+	// composed.From uses this to automatically set apiVersion and kind. We do
+	// this once rather than on every RunFunction call, since concurrent calls
+	// would otherwise race writing to the shared scheme.
+	_ = awsv1beta1.AddToScheme(composed.Scheme)
+	_ = awsv1beta2.AddToScheme(composed.Scheme)
+	_ = rdsv1beta1.AddToScheme(composed.Scheme)
+	_ = nfv1beta1.AddToScheme(composed.Scheme)
+}
+
+// A ComposedBuilder builds a desired composed resource from a managed
+// resource.
+type ComposedBuilder interface {
+	Build(mr runtime.Object) (*composed.Unstructured, error)
+}
+
+// A ComposedBuilderFn is a function that satisfies the ComposedBuilder
+// interface.
+type ComposedBuilderFn func(mr runtime.Object) (*composed.Unstructured, error)
+
+// Build a desired composed resource from the supplied managed resource.
+func (fn ComposedBuilderFn) Build(mr runtime.Object) (*composed.Unstructured, error) {
+	return fn(mr)
+}
+
 type Function struct {
 	fnv1.UnimplementedFunctionRunnerServiceServer
 
-	log logging.Logger
+	log      logging.Logger
+	defaults config.Defaults
+
+	// builder builds desired composed resources. It defaults to
+	// composed.From when nil.
+	builder ComposedBuilder
+
+	// clouds are the providers spec.cloud selects between, keyed by name.
+	// It defaults to AWS alone when nil.
+	clouds map[string]CloudProvider
+
+	// io reads the request and writes the response. It defaults to SDKIO
+	// when nil.
+	io IO
+
+	// clock returns the current time. It defaults to time.Now when nil.
+	clock func() time.Time
+
+	// dumpDir is a directory each request is written to before it's
+	// processed, for reproducing issues. Requests aren't written when empty.
+	dumpDir string
 }
 
 // RunFunction implements our custom full code function logic. It will create a
-// variable number of VPCs and conditionally create InternetGateways for each
-// VPC.
+// variable number of VPCs and conditionally create InternetGateways, subnets,
+// public route tables and DB subnet groups for each VPC.
 func (f *Function) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest) (*fnv1.RunFunctionResponse, error) {
-	f.log.Info("Running function", "tag", req.GetMeta().GetTag())
+	f.log.Info("Running function", "tag", req.GetMeta().GetTag(), "version", Version)
+
+	if f.dumpDir != "" {
+		// a failed dump shouldn't fail the run it's meant to help debug
+		path, err := dumpRequest(f.dumpDir, req, f.now())
+		if err != nil {
+			f.log.Info("Cannot dump request", "error", err)
+		} else {
+			f.log.Debug("Dumped request", "path", path)
+		}
+	}
 
 	rsp := response.To(req, response.DefaultTTL)
 
-	// get the observed XR so we can read all the specified config from it
-	oxr, err := request.GetObservedCompositeResource(req)
-	if err != nil {
-		response.Fatal(rsp, errors.Wrapf(err, "cannot get desired XR"))
+	var rw IO = SDKIO{}
+	if f.io != nil {
+		rw = f.io
+	}
+
+	// record which build of the function produced this response, to help
+	// with support when several versions run across clusters
+	response.Normalf(rsp, "demo-xfn-network version %s", Version).WithReason(reasonVersion)
+
+	// get the function's input, which is configured by the Composition
+	in := &v1beta1.Input{}
+	if err := rw.GetInput(req, in); err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "cannot get Function input from %T", req))
+		return rsp, nil
+	}
+
+	// get the observed XR so we can read all the specified config from it.
+	// The input may tolerate there being none yet, but never a malformed one.
+	oxr, err := rw.GetObservedCompositeResource(req)
+	switch {
+	case errors.Is(err, errNoObservedXR) && in.AllowMissingXR != nil && *in.AllowMissingXR:
+		response.Normal(rsp, "There is no observed XR yet, so no resources were composed")
+		return rsp, nil
+	case err != nil:
+		response.Fatal(rsp, errors.Wrap(err, "cannot get observed XR"))
+		return rsp, nil
+	}
+
+	if in.MinCIDRPrefixLength != nil && (*in.MinCIDRPrefixLength < 1 || *in.MinCIDRPrefixLength > config.MaxVPCPrefixLength) {
+		response.Fatal(rsp, errors.Errorf("invalid Function input: minCidrPrefixLength must be between 1 and %d, got %d", config.MaxVPCPrefixLength, *in.MinCIDRPrefixLength))
+		return rsp, nil
+	}
+
+	if in.AWSAPIVersion != nil && !slices.Contains(supportedAWSAPIVersions, *in.AWSAPIVersion) {
+		response.Fatal(rsp, errors.Errorf("invalid Function input: awsApiVersion %q is not supported; must be one of %s", *in.AWSAPIVersion, strings.Join(supportedAWSAPIVersions, ", ")))
 		return rsp, nil
 	}
 
 	// retrieve all the specified config from the XR
-	id, _ := oxr.Resource.GetString("spec.id")
-	count, _ := oxr.Resource.GetInteger("spec.count")
-	includeGateway, _ := oxr.Resource.GetBool("spec.includeGateway")
-	region, _ := oxr.Resource.GetString("spec.region")
-	if region == "" {
-		region = "eu-central-1"
+	cfg, err := getConfig(oxr, in, f.defaults)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "invalid network config"))
+		return rsp, nil
 	}
-	providerConfigName, _ := oxr.Resource.GetString("spec.providerConfigName")
-	if providerConfigName == "" {
-		providerConfigName = "default"
+
+	// extra resources, like the CIDR plan and VPC quota, that Crossplane
+	// supplied in response to an earlier run's requirements
+	extra, err := rw.GetExtraResources(req)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot get extra resources"))
+		return rsp, nil
+	}
+
+	// a centrally maintained allocation plan takes precedence over the
+	// XR's CIDR block, so networks don't overlap
+	if in.CIDRPlan != nil {
+		requireCIDRPlan(rsp, *in.CIDRPlan)
+		if cidr, ok := plannedCIDR(extra, cfg.ID); ok && !cfg.UsesIPAM() {
+			cfg.CIDRBlock = cidr
+			cfg.Defaulted = withoutDefault(cfg.Defaulted, "spec.cidrBlock")
+		}
+	}
+
+	// an externally driven count, such as an autoscaler's, takes precedence
+	// over the XR's. A count that can't be read is fatal rather than falling
+	// back to the XR's, which could delete VPCs the signal still wants.
+	if in.CountFrom != nil {
+		requireCount(rsp, *in.CountFrom)
+		n, ok, err := externalCount(*in.CountFrom, extra)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot read count"))
+			return rsp, nil
+		}
+		if ok {
+			cfg.Count = n
+		}
+	}
+
+	// platform-wide tags, like a cost center, that an earlier function in
+	// the pipeline supplied apply beneath the XR's own
+	if in.DefaultTagsContextKey != nil {
+		defaults, err := contextTags(req, rw, *in.DefaultTagsContextKey)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot read default tags"))
+			return rsp, nil
+		}
+		cfg.Tags = withDefaultTags(cfg.Tags, defaults)
+	}
+	f.log.Debug("Resolved network config",
+		"id", cfg.ID,
+		"count", cfg.Count,
+		"includeGateway", cfg.IncludeGateway,
+		"region", cfg.Region,
+		"regionOverrides", cfg.RegionOverrides,
+		"providerConfigName", cfg.ProviderConfigName,
+		"cidrBlock", cfg.CIDRBlock,
+		"ipv4IpamPoolId", cfg.IPv4IPAMPoolID,
+		"ipv4NetmaskLength", cfg.IPv4NetmaskLength,
+		"divideCidrBlock", cfg.DivideCIDRBlock,
+		"enableIpv6", cfg.EnableIPv6,
+		"primaryVpcIndex", cfg.PrimaryVPCIndex,
+		"privateVpcIndexes", cfg.PrivateVPCIndexes,
+		"gatewayVpcIndexes", cfg.GatewayVPCIndexes,
+		"strict", cfg.Strict,
+		"prefixList", cfg.PrefixList,
+		"availabilityZones", cfg.AvailabilityZones,
+		"maxAzs", cfg.MaxAZs,
+		"maxSubnetsPerAz", cfg.MaxSubnetsPerAZ,
+		"environment", cfg.Environment,
+		"subnetAlignment", cfg.SubnetAlignment,
+		"publicSubnets", cfg.PublicSubnets,
+		"privateSubnets", cfg.PrivateSubnets,
+		"createDbSubnetGroup", cfg.CreateDBSubnetGroup,
+		"tags", cfg.Tags,
+		"publicSubnetTags", cfg.PublicSubnetTags,
+		"privateSubnetTags", cfg.PrivateSubnetTags,
+		"clusterName", cfg.ClusterName,
+		"gatewayRefByName", cfg.GatewayRefByName,
+		"writeConnectionSecrets", cfg.WriteConnectionSecrets,
+		"writeConnectionSecretNamespace", cfg.ConnectionSecretNamespace,
+		"gatewayVpcSelector", cfg.GatewayVPCSelector,
+		"gatewayProviderConfigName", cfg.GatewayProviderConfigName,
+		"igwRouteCidrs", cfg.IGWRouteCIDRs,
+		"disableManagedLabels", cfg.DisableManagedLabels,
+		"lockdownDefaultSg", cfg.LockdownDefaultSG,
+		"defaultEgressCidr", cfg.DefaultEgressCIDR,
+		"s3GatewayEndpoint", cfg.S3GatewayEndpoint,
+		"predictableVpcNames", cfg.PredictableVPCNames,
+		"minCidrPrefixLength", cfg.MinCIDRPrefixLength,
+		"privateRouteTablePerAz", cfg.PrivateRouteTablePerAZ,
+		"natGatewayStrategy", cfg.NATGatewayStrategy,
+		"deletionOrdering", cfg.DeletionOrdering,
+		"emitGraph", cfg.EmitGraph,
+		"emitDiff", cfg.EmitDiff,
+		"emitStatusPatch", cfg.EmitStatusPatch,
+		"fillIndexGaps", cfg.FillIndexGaps,
+		"publicSubnetAutoAssignIp", cfg.PublicSubnetAutoAssignIP,
+		"firewallSubnets", cfg.FirewallSubnets,
+		"enableNetworkFirewall", cfg.EnableNetworkFirewall,
+		"vpcIdLabels", cfg.VPCIDLabels,
+		"useGenerateName", cfg.UseGenerateName,
+		"emitSpecHash", cfg.EmitSpecHash,
+		"setOwnerReferences", cfg.OwnerReference != nil,
+		"readyTimeout", cfg.ReadyTimeout,
+		"expiresAfter", cfg.ExpiresAfter,
+		"reportFreeAddressSpace", cfg.ReportFreeAddressSpace,
+		"reportEffectiveConfig", cfg.ReportEffectiveConfig,
+		"reportSubnets", cfg.ReportSubnets,
+		"resourceNameOverrides", cfg.ResourceNameOverrides,
+		"stableResourceKeys", cfg.StableResourceKeys,
+		"hashResourceKeys", cfg.HashResourceKeys,
+		"deleteResources", cfg.DeleteResources,
+		"providerConfigs", cfg.ProviderConfigs,
+		"mode", cfg.Mode,
+		"cloud", cfg.Cloud,
+		"topology", cfg.Topology,
+	)
+	if err := cfg.validate(); err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "invalid network config"))
+		return rsp, nil
+	}
+	cloud, err := f.cloudProvider(cfg.Cloud)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "invalid network config"))
+		return rsp, nil
+	}
+
+	if cfg.Mode == config.ModeReport {
+		// a reporter over resources composed elsewhere, so desire nothing
+		observed, err := rw.GetObservedComposedResources(req)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrapf(err, "cannot get observed composed resources from %T", req))
+			return rsp, nil
+		}
+		summary := summarizeNetwork(observed)
+		if err := setDesiredStatus(rsp, rw, "summary", summary); err != nil {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+		response.Normalf(rsp, "Network %q has %s", cfg.ID, summary).WithReason(reasonNetworkSummary)
+		if cfg.EmitStatusPatch {
+			if err := emitStatusPatch(oxr, rsp, rw); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+		}
+		f.log.Info("Function reported OK", "id", cfg.ID, "total", summary.Total, "ready", summary.Ready)
+		return rsp, nil
+	}
+
+	// strict XRs want to know about every field that took a default
+	if cfg.Strict {
+		for _, d := range cfg.Defaulted {
+			response.Warning(rsp, errors.Errorf("%s is unset, so it defaulted to %s", d.Field, d.Value))
+		}
+	}
+
+	// everyone else still wants to know when their resources will silently
+	// use the ProviderConfig named default
+	assumed := slices.ContainsFunc(cfg.Defaulted, func(d config.DefaultedField) bool { return d.Field == "spec.providerConfigName" })
+	if !cfg.Strict && assumed && len(cfg.ProviderConfigs) == 0 && cfg.ProviderConfigName == config.DefaultProviderConfigName {
+		response.Warning(rsp, errors.Errorf("spec.providerConfigName is unset, so resources will use the ProviderConfig named %s; set it explicitly if that isn't intended", config.DefaultProviderConfigName)).WithReason(reasonProviderConfigAssumed)
+	}
+
+	for _, field := range cfg.TopologyConflicts {
+		response.Warning(rsp, errors.Errorf("%s is ignored because spec.topology is %s, which has no internet access", field, cfg.Topology)).WithReason(reasonTopologyConflict)
+	}
+
+	// listing an AZ twice would plan clashing subnets, so collapse any
+	// duplicates strict mode didn't already reject
+	if azs, dupes := uniqueAZs(cfg.AvailabilityZones); len(dupes) > 0 {
+		response.Warning(rsp, errors.Errorf("spec.availabilityZones lists %s more than once; the duplicates were collapsed", strings.Join(dupes, ", ")))
+		cfg.AvailabilityZones = azs
+	}
+
+	// refuse to compose more resources than the controller can comfortably
+	// handle for a single XR
+	if err := checkResourceLimit(cfg, in); err != nil {
+		response.Fatal(rsp, err)
+		return rsp, nil
+	}
+
+	// check the count against the region's VPC quota, to avoid a rollout
+	// that's doomed to fail part way
+	if in.VPCQuota != nil {
+		requireVPCQuota(rsp, *in.VPCQuota)
+		quota, ok, err := vpcQuota(*in.VPCQuota, extra)
+		switch {
+		case err != nil:
+			response.Warning(rsp, errors.Wrap(err, "cannot check the VPC quota"))
+		case ok && cfg.Count > quota:
+			err := errors.Errorf("spec.count %d exceeds the VPC quota of %d in region %s", cfg.Count, quota, cfg.Region)
+			if cfg.Strict {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+			response.Warning(rsp, err)
+		}
+	}
+
+	// gateways attach to VPCs, so asking for gateways without any VPCs is
+	// probably a mistake
+	if cfg.IncludeGateway && cfg.Count == 0 {
+		response.Warning(rsp, errors.New("spec.includeGateway is true but spec.count is 0; InternetGateways are only created for VPCs, so none will be created"))
 	}
 
 	// get a reference to the desired composed resources, so we can add our
 	// desired VPCs and InternetGateways to this list
-	desired, err := request.GetDesiredComposedResources(req)
+	desired, err := rw.GetDesiredComposedResources(req)
 	if err != nil {
 		response.Fatal(rsp, errors.Wrapf(err, "cannot get desired resources from %T", req))
 		return rsp, nil
 	}
 
-	// Add the AWS EC2 v1beta1 types (including VPC and InternetGateway) to the
-	// composed resource scheme. composed.From uses this to automatically set
-	// apiVersion and kind.
-	_ = awsv1beta1.AddToScheme(composed.Scheme)
+	// get the observed composed resources, so we can take into account what
+	// already exists
+	observed, err := rw.GetObservedComposedResources(req)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "cannot get observed composed resources from %T", req))
+		return rsp, nil
+	}
 
-	// Iterate over the desired count of network resources, creating 1 resource per iteration
-	for i := range count {
-		// configure the VPC resource
-		vpcName := fmt.Sprintf("vpc-%s-%d", id, i)
-		vpc := &awsv1beta1.VPC{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: vpcName,
-				Labels: map[string]string{
-					"networks.meta.fn.crossplane.io/network-id": id,
-					"networks.meta.fn.crossplane.io/vpc-id":     vpcName,
-				},
-			},
-			Spec: awsv1beta1.VPCSpec{
-				ForProvider: awsv1beta1.VPCParameters_2{
-					Region:             ptr.To(region),
-					CidrBlock:          ptr.To("192.168.0.0/16"),
-					EnableDNSSupport:   ptr.To(true),
-					EnableDNSHostnames: ptr.To(true),
-				},
-				ResourceSpec: v1.ResourceSpec{
-					ProviderConfigReference: &v1.Reference{Name: providerConfigName},
-				},
-			},
+	// keep the resources of each AZ in the slot they were created in, so
+	// inserting an AZ doesn't rename or re-address those of the others. The
+	// stable keys of per-AZ resources are keyed by their slotted names, so
+	// resolve the slots first.
+	if cfg.StableResourceKeys {
+		cfg.AZSlots = filledAZSlots(cfg, observed)
+		if !cfg.UsesIPAM() {
+			if err := cfg.validateCIDRBlock(); err != nil {
+				response.Fatal(rsp, errors.Wrap(err, "invalid network config"))
+				return rsp, nil
+			}
+		}
+	}
+
+	if cfg.HashResourceKeys {
+		observed = observedByHashedKey(observed, cfg.resourceKeys())
+	}
+
+	// reuse the indexes of existing VPCs, and fill gaps left by deleted ones
+	// before adding VPCs at the end. The stable keys of per-AZ resources
+	// depend on the indexes, so resolve them first.
+	if cfg.FillIndexGaps {
+		cfg.VPCIndexes = filledVPCIndexes(cfg, observedByLogicalName(observed, cfg.ResourceNameOverrides))
+		if err := cfg.validateVPCIndexes(); err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "invalid network config"))
+			return rsp, nil
+		}
+	}
+	observed = observedByLogicalName(observed, cfg.resourceKeys())
+
+	// when rolling out in batches, defer the VPCs beyond the current batch
+	var batch map[int64]bool
+	if in.MaxVPCsPerRun != nil {
+		if *in.MaxVPCsPerRun < 1 {
+			response.Fatal(rsp, errors.Errorf("invalid Function input: maxVpcsPerRun must be at least 1, got %d", *in.MaxVPCsPerRun))
+			return rsp, nil
+		}
+		batch = vpcBatch(cfg, observed, *in.MaxVPCsPerRun)
+		if deferred := cfg.Count - int64(len(batch)); deferred > 0 {
+			response.Normalf(rsp, "Creating VPCs in batches of %d; %d of %d VPCs are deferred until earlier VPCs are created", *in.MaxVPCsPerRun, deferred, cfg.Count)
 		}
+	}
 
-		// add the VPC resource to the desired composed resources
-		dcVPC, err := composed.From(vpc)
+	// in strict mode the first resource that can't be built is fatal.
+	// Otherwise keep building, so that every failure can be reported at once.
+	var buildErrs []error
+	composedNames := map[resource.Name]bool{}
+	build := func(name string, mr runtime.Object) error {
+		err := f.addDesired(desired, name, mr)
+		if err != nil && !cfg.Strict {
+			buildErrs = append(buildErrs, err)
+			return nil
+		}
 		if err != nil {
-			response.Fatal(rsp, errors.Wrapf(err, "cannot convert %T to %T", vpc, &composed.Unstructured{}))
+			return err
+		}
+		composedNames[resource.Name(name)] = true
+		dc := desired[resource.Name(name)].Resource
+		if err := overrideRegion(dc, cfg.RegionOverrides, kindOf(mr)); err != nil {
+			return errors.Wrapf(err, "cannot override region of %s", name)
+		}
+		if cfg.OwnerReference != nil {
+			dc.SetOwnerReferences([]metav1.OwnerReference{*cfg.OwnerReference})
+		}
+		if cfg.EmitSpecHash {
+			if err := setSpecHash(dc); err != nil {
+				return errors.Wrapf(err, "cannot hash %s", name)
+			}
+		}
+		if cfg.ExpiresAfter > 0 {
+			setExpiresAt(dc, observed[resource.Name(name)], f.now().Add(cfg.ExpiresAfter))
+		}
+		if cfg.UseGenerateName {
+			useGenerateName(dc)
+		}
+		return nil
+	}
+
+	// gateways we'd desire anyway, split by whether they're new or already
+	// attached, so re-runs only report actual changes
+	var newGateways, attachedGateways []string
+
+	// unallocated address space of each VPC that has subnets, by VPC name
+	freeSpace := map[string]freeAddressSpace{}
+
+	// every subnet composed, in order, with how many addresses it has free
+	var subnetStats []subnetStatus
+
+	// Iterate over the desired count of network resources, creating 1 resource per iteration
+	for _, i := range cfg.vpcIndexes() {
+		if batch != nil && !batch[i] {
+			continue
+		}
+
+		// use the provider config assigned to this VPC for it and everything in it
+		cfg := cfg.forVPC(i)
+
+		// configure the VPC resource and add it to the desired composed resources
+		vpcName := names.VPCName(cfg.ID, i)
+		vpc := cloud.Network(cfg, vpcName, cfg.vpcRole(i))
+		if v, ok := vpc.(*awsv1beta1.VPC); ok && cfg.PredictableVPCNames {
+			// a VPC's external name is the ID AWS assigns it, so name it
+			// predictably by its Name tag instead, unless spec.tags sets one
+			if _, ok := cfg.Tags["Name"]; !ok {
+				v.Spec.ForProvider.Tags["Name"] = ptr.To(names.VPCNameTag(cfg.ID, i))
+			}
+		}
+		if err := build(vpcName, vpc); err != nil {
+			response.Fatal(rsp, err)
 			return rsp, nil
 		}
-		desired[resource.Name(vpcName)] = &resource.DesiredComposed{Resource: dcVPC}
 
-		if includeGateway {
+		// link to the VPC in the AWS console once it exists, to save
+		// operators hunting for it
+		if id := observedVPCID(observed, vpcName); id != "" {
+			response.Normalf(rsp, "VPC %q is %s: %s", vpcName, id, vpcConsoleURL(cfg.Region, id)).WithReason(reasonConsoleLink)
+		}
+
+		if cfg.IncludeGateway {
 			// the user wants an InternetGateway to be created also, configure one now
-			gatewayName := fmt.Sprintf("gateway-%s-%d", id, i)
-			gateway := &awsv1beta1.InternetGateway{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: gatewayName,
-					Labels: map[string]string{
-						"networks.meta.fn.crossplane.io/network-id": id,
-					},
-				},
-				Spec: awsv1beta1.InternetGatewaySpec{
-					ForProvider: awsv1beta1.InternetGatewayParameters_2{
-						Region: ptr.To(region),
-						VPCIDSelector: &v1.Selector{
-							MatchControllerRef: ptr.To(true),
-							MatchLabels: map[string]string{
-								"networks.meta.fn.crossplane.io/vpc-id": vpcName,
-							},
-						},
-					},
-					ResourceSpec: v1.ResourceSpec{
-						ProviderConfigReference: &v1.Reference{Name: providerConfigName},
-					},
-				},
-			}
-
-			// add the InternetGateway resource to the desired composed resources
-			dcGateway, err := composed.From(gateway)
+			gatewayName := names.GatewayName(cfg.ID, i)
+			if err := build(gatewayName, cloud.Gateway(cfg, gatewayName, vpcName)); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+			if observedGatewayAttached(observed, gatewayName) {
+				attachedGateways = append(attachedGateways, gatewayName)
+			} else {
+				f.log.Debug("Adding new InternetGateway", "name", gatewayName, "vpc", vpcName)
+				newGateways = append(newGateways, gatewayName)
+			}
+		}
+
+		// dual-stack subnets are carved from the VPC's Amazon provided IPv6
+		// CIDR block, which we only know once AWS has assigned it
+		ipv6Block := ""
+		if cfg.EnableIPv6 {
+			vpcID, block := observedVPCIPv6(observed, vpcName)
+			ipv6Block = block
+			if vpcID != "" && block == "" && len(cfg.subnetTiers()) > 0 {
+				response.Warning(rsp, errors.Errorf("VPC %q has no IPv6 CIDR block yet; its subnets will be dual-stack once it does", vpcName))
+			}
+		}
+
+		// carve the VPC's CIDR blocks into subnets for each requested tier
+		subnets, err := planSubnets(cfg, i, ipv6Block)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrapf(err, "cannot plan subnets for VPC %q", vpcName))
+			return rsp, nil
+		}
+		for _, s := range subnets {
+			if err := build(s.Name, newSubnet(cfg, s, vpcName)); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+		}
+		if cfg.ReportSubnets {
+			stats, err := subnetStatuses(vpcName, subnets)
+			if err != nil {
+				response.Fatal(rsp, errors.Wrapf(err, "cannot compute available IPs of the subnets of VPC %q", vpcName))
+				return rsp, nil
+			}
+			subnetStats = append(subnetStats, stats...)
+		}
+		if len(subnets) > 0 && cfg.CIDRBlock != "" {
+			// the headroom left for capacity planners to add subnets to
+			fs, err := vpcFreeAddressSpace(cfg.CIDRBlock, subnets)
 			if err != nil {
-				response.Fatal(rsp, errors.Wrapf(err, "cannot convert %T to %T", gateway, &composed.Unstructured{}))
+				response.Fatal(rsp, errors.Wrapf(err, "cannot compute free address space of VPC %q", vpcName))
 				return rsp, nil
 			}
-			desired[resource.Name(gatewayName)] = &resource.DesiredComposed{Resource: dcGateway}
+			response.Normalf(rsp, "VPC %q has %s of %s unallocated: %s", vpcName, fs.percentString(), cfg.CIDRBlock, strings.Join(fs.CIDRs, ", ")).WithReason(reasonFreeAddressSpace)
+			freeSpace[vpcName] = fs
 		}
 
+		if cfg.routesPublicSubnets() {
+			// route the public subnets' traffic to the VPC's InternetGateway
+			rtName := names.RouteTableName(cfg.ID, i, tierPublic)
+			if err := build(rtName, newRouteTable(cfg, rtName, vpcName, tierPublic)); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+			gatewayName := names.GatewayName(cfg.ID, i)
+			for j, cidr := range cfg.igwRouteCIDRs() {
+				routeName := names.RouteName(cfg.ID, i, tierPublic, j)
+				if err := build(routeName, newGatewayRoute(cfg, routeName, rtName, gatewayName, cidr)); err != nil {
+					response.Fatal(rsp, err)
+					return rsp, nil
+				}
+			}
+			for _, s := range subnets {
+				if s.Tier != tierPublic {
+					continue
+				}
+				assocName := names.RouteTableAssociationName(s.Name)
+				if err := build(assocName, newRouteTableAssociation(cfg, assocName, s.Name, rtName)); err != nil {
+					response.Fatal(rsp, err)
+					return rsp, nil
+				}
+			}
+		}
+
+		if cfg.routesPrivateSubnetsPerAZ() {
+			// give each AZ its own route table, and associate each private
+			// subnet with the one in its AZ, so a subnet's egress can stay
+			// within its AZ
+			tables := cfg.routeTablesByAZ(i, tierPrivate)
+			for _, az := range cfg.AvailabilityZones {
+				rtName := tables[az]
+				if err := build(rtName, newRouteTable(cfg, rtName, vpcName, tierPrivate)); err != nil {
+					response.Fatal(rsp, err)
+					return rsp, nil
+				}
+			}
+			for _, s := range subnets {
+				if s.Tier != tierPrivate {
+					continue
+				}
+				rtName, err := azRouteTable(tables, s)
+				if err != nil {
+					response.Fatal(rsp, errors.Wrapf(err, "cannot associate subnets of VPC %q", vpcName))
+					return rsp, nil
+				}
+				assocName := names.RouteTableAssociationName(s.Name)
+				if err := build(assocName, newRouteTableAssociation(cfg, assocName, s.Name, rtName)); err != nil {
+					response.Fatal(rsp, err)
+					return rsp, nil
+				}
+			}
+		}
+
+		if azs := cfg.natGatewayAZs(); len(azs) > 0 {
+			// give private subnets egress through NAT gateways in the public
+			// subnets, either one per AZ or one shared by every AZ
+			for _, j := range azs {
+				eipName := names.EIPName(cfg.ID, i, cfg.azSlot(j))
+				if err := build(eipName, newEIP(cfg, eipName)); err != nil {
+					response.Fatal(rsp, err)
+					return rsp, nil
+				}
+				natName := names.NATGatewayName(cfg.ID, i, cfg.azSlot(j))
+				if err := build(natName, newNATGateway(cfg, natName, eipName, names.SubnetName(cfg.ID, i, tierPublic, cfg.azSlot(j)))); err != nil {
+					response.Fatal(rsp, err)
+					return rsp, nil
+				}
+			}
+			tables := cfg.routeTablesByAZ(i, tierPrivate)
+			for j, az := range cfg.AvailabilityZones {
+				routeName := names.NATRouteName(cfg.ID, i, cfg.azSlot(j))
+				natName := names.NATGatewayName(cfg.ID, i, cfg.azSlot(cfg.natGatewayAZ(j)))
+				if err := build(routeName, newNATRoute(cfg, routeName, tables[az], natName)); err != nil {
+					response.Fatal(rsp, err)
+					return rsp, nil
+				}
+			}
+		}
+
+		if cfg.S3GatewayEndpoint && cfg.routesPublicSubnets() {
+			// route the VPC's S3 traffic through a gateway endpoint, which
+			// only takes effect for the route tables it's associated with.
+			// Private VPCs have no route tables, so they get no endpoint.
+			epName := names.S3EndpointName(cfg.ID, i)
+			if err := build(epName, newS3GatewayEndpoint(cfg, epName, vpcName)); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+			assocName := names.S3EndpointAssociationName(cfg.ID, i, tierPublic)
+			rtName := names.RouteTableName(cfg.ID, i, tierPublic)
+			if err := build(assocName, newEndpointRouteTableAssociation(cfg, assocName, epName, vpcName, rtName, tierPublic)); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+		}
+
+		if cfg.deploysNetworkFirewall() {
+			// inspect the VPC's traffic with a firewall that has an endpoint
+			// in each of its firewall subnets
+			rgName := names.FirewallRuleGroupName(cfg.ID, i)
+			if err := build(rgName, newFirewallRuleGroup(cfg, rgName)); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+			policyName := names.FirewallPolicyName(cfg.ID, i)
+			if err := build(policyName, newFirewallPolicy(cfg, policyName, rgName)); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+			fwName := names.FirewallName(cfg.ID, i)
+			if err := build(fwName, newFirewall(cfg, fwName, vpcName, policyName, subnets)); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+		}
+
+		if cfg.LockdownDefaultSG {
+			// AWS gives every VPC a default security group that allows all
+			// traffic from its members and all egress; revoke those rules
+			sgName := names.DefaultSecurityGroupName(cfg.ID, i)
+			if err := build(sgName, newDefaultSecurityGroup(cfg, sgName, vpcName)); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+		}
+
+		if cfg.CreateDBSubnetGroup {
+			// group the VPC's private subnets so databases can be placed in them
+			groupName := names.DBSubnetGroupName(cfg.ID, i)
+			if err := build(groupName, newDBSubnetGroup(cfg, groupName, vpcName, subnets)); err != nil {
+				response.Fatal(rsp, err)
+				return rsp, nil
+			}
+		}
+	}
+
+	if cfg.PrefixList != nil {
+		// the prefix list is shared by the whole network, so it uses the
+		// first VPC's provider config
+		cfg := cfg.forVPC(0)
+		name := names.PrefixListName(cfg.ID)
+		if err := build(name, newPrefixList(cfg, name)); err != nil {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+	}
+
+	if len(buildErrs) > 0 {
+		response.Fatal(rsp, kerrors.NewAggregate(buildErrs))
+		return rsp, nil
+	}
+
+	// operators decommission resources surgically by listing them, even
+	// though the spec would otherwise compose them
+	if err := removeDeletedResources(cfg, desired, composedNames, observed); err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "invalid network config"))
+		return rsp, nil
+	}
+
+	if cfg.DeletionOrdering {
+		// block deleting each resource until its dependents are deleted,
+		// so deleting the XR doesn't leave resources stuck on finalizers
+		usages, err := dependencyUsages(cfg, desired, composedNames)
+		if err != nil {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+		if err := checkUsageLimit(cfg, in, len(usages)); err != nil {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+		for name, u := range usages {
+			desired[name] = &resource.DesiredComposed{Resource: u}
+		}
+	}
+
+	// summarize how the network's existing resources are doing. This and the
+	// orphaned gateway warnings below find the network's resources by label,
+	// so they're silent when spec.disableManagedLabels is set.
+	if h := networkHealth(observed, cfg.ID); h.Total > 0 {
+		response.Normalf(rsp, "%d/%d synced, %d/%d ready", h.Synced, h.Total, h.Ready, h.Total)
+	}
+
+	// relay provider errors, like AWS rejecting a CIDR block, so they're
+	// visible on the XR without digging into each managed resource
+	for _, e := range syncErrors(observed, cfg.ID) {
+		response.Warning(rsp, errors.Errorf("%s %q is not synced: %s", e.Kind, e.Name, e.Message)).WithReason(reasonSyncFailed)
+	}
+
+	if len(newGateways)+len(attachedGateways) > 0 {
+		msg := fmt.Sprintf("InternetGateways: %d new, %d already attached", len(newGateways), len(attachedGateways))
+		if len(newGateways) > 0 {
+			msg += fmt.Sprintf(" (new: %s)", strings.Join(newGateways, ", "))
+		}
+		response.Normal(rsp, msg).WithReason(reasonGatewayChanges)
+	}
+
+	// surface resources that have been pending too long as a condition,
+	// rather than leaving the stall silent
+	if cfg.ReadyTimeout > 0 {
+		f.setProgressing(rsp, cfg, observed)
+	}
+
+	// gateways we stop desiring get deleted, which fails while they're still
+	// attached to a VPC, so warn about the teardown order up front
+	for _, g := range orphanedGateways(observed, desired, cfg.ID) {
+		response.Warning(rsp, errors.Errorf("InternetGateway %q is no longer desired and will be deleted, but it is still attached to VPC %q; detach it from the VPC first, or delete the VPC and its gateway together", g.Name, g.VPCID))
+	}
+
+	if cfg.EmitDiff {
+		// what a spec edit will actually change in AWS, for reviewers
+		for _, d := range resourceDiffs(desired, observed, composedNames) {
+			response.Normal(rsp, d).WithReason(reasonForProviderDiff)
+		}
+	}
+
+	if cfg.EmitGraph {
+		// a DOT digraph users can paste into a visualizer
+		response.Normalf(rsp, "%s", resourceGraph(cfg.ID, desired)).WithReason(reasonResourceGraph)
+	}
+
+	// key resources migrated from another composition by their old names, and
+	// per-AZ resources by their AZ when asked to, so that Crossplane doesn't
+	// recreate them
+	desired, composedNames, err = overrideResourceNames(desired, composedNames, cfg.resourceKeys())
+	if err != nil {
+		response.Fatal(rsp, err)
+		return rsp, nil
+	}
+	if cfg.HashResourceKeys {
+		// key resources by a hash of their identity rather than their
+		// name, which the API server generates
+		desired, composedNames, err = overrideResourceNames(desired, composedNames, hashedResourceKeys(composedNames))
+		if err != nil {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+	}
+
+	if in.EmitResourceGroups != nil && *in.EmitResourceGroups {
+		// let later steps of the pipeline filter resources by network
+		if err := setResourceGroups(req, rsp, rw, composedNames, cfg.ID); err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot set resource groups"))
+			return rsp, nil
+		}
+	}
+
+	// which account each resource lands in, for auditing cross-account
+	// placement. Resources using the default ProviderConfig are the norm, so
+	// only the others are listed.
+	assigned := providerConfigAssignments(desired, composedNames)
+	pcs := make([]string, 0, len(assigned))
+	for pc := range assigned {
+		if pc != config.DefaultProviderConfigName {
+			pcs = append(pcs, pc)
+		}
+	}
+	sort.Strings(pcs)
+	for _, pc := range pcs {
+		response.Normalf(rsp, "ProviderConfig %q is used by %s", pc, strings.Join(assigned[pc], ", ")).WithReason(reasonProviderConfigAssignment)
+	}
+
+	if cfg.ReportFreeAddressSpace && len(freeSpace) > 0 {
+		if err := setDesiredStatus(rsp, rw, "freeAddressSpace", freeSpace); err != nil {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+	}
+	if cfg.ReportEffectiveConfig {
+		if err := setDesiredStatus(rsp, rw, "effectiveConfig", cfg.effective()); err != nil {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+	}
+	if cfg.ReportSubnets && len(subnetStats) > 0 {
+		if err := setDesiredStatus(rsp, rw, "subnets", subnetStats); err != nil {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+	}
+	if cfg.EmitStatusPatch {
+		// what this run changes in the XR's status, for auditing
+		if err := emitStatusPatch(oxr, rsp, rw); err != nil {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+	}
+
+	// desired state shouldn't carry status, so drop the default status
+	// blocks composed.From emits unless the Composition asks to keep them
+	if in.StripStatus == nil || *in.StripStatus {
+		stripDefaultStatus(desired)
 	}
 
 	// set the desired composed resources back on the response
-	if err := response.SetDesiredComposedResources(rsp, desired); err != nil {
+	if err := rw.SetDesiredComposedResources(rsp, desired); err != nil {
 		response.Fatal(rsp, errors.Wrapf(err, "cannot set desired composed resources in %T", rsp))
 		return rsp, nil
 	}
 
-	f.log.Info("Function ran OK", "id", id, "count", count, "includeGateway", includeGateway, "region", region, "providerConfigName", providerConfigName)
+	f.log.Info("Function ran OK", "id", cfg.ID, "count", cfg.Count, "includeGateway", cfg.IncludeGateway, "region", cfg.Region, "providerConfigName", cfg.ProviderConfigName)
 	return rsp, nil
 }
+
+// now returns the current time from the Function's clock.
+func (f *Function) now() time.Time {
+	if f.clock != nil {
+		return f.clock()
+	}
+	return time.Now()
+}
+
+// setProgressing sets the NetworkProgressing condition of the XR from the
+// readiness of the supplied observed resources of the network. It's false once
+// any resource has been unready for longer than the configured timeout.
+func (f *Function) setProgressing(rsp *fnv1.RunFunctionResponse, cfg Config, observed map[resource.Name]resource.ObservedComposed) {
+	if stalled := stalledResources(observed, cfg.ID, cfg.ReadyTimeout, f.now()); len(stalled) > 0 {
+		response.ConditionFalse(rsp, conditionNetworkProgressing, reasonNetworkStalled).
+			WithMessage(fmt.Sprintf("%s not ready after %s", strings.Join(stalled, ", "), cfg.ReadyTimeout))
+		return
+	}
+	if h := networkHealth(observed, cfg.ID); h.Ready < h.Total || (h.Total == 0 && cfg.Count > 0) {
+		response.ConditionTrue(rsp, conditionNetworkProgressing, reasonResourcesPending).
+			WithMessage(fmt.Sprintf("%d/%d ready", h.Ready, h.Total))
+		return
+	}
+	response.ConditionTrue(rsp, conditionNetworkProgressing, reasonResourcesReady)
+}
+
+// addDesired converts the supplied managed resource to a desired composed
+// resource and adds it to the desired composed resources under the supplied
+// name. Errors name the resource and its kind, so a failure is easy to find
+// among the many resources a network composes.
+func (f *Function) addDesired(desired map[resource.Name]*resource.DesiredComposed, name string, mr runtime.Object) error {
+	var b ComposedBuilder = ComposedBuilderFn(composed.From)
+	if f.builder != nil {
+		b = f.builder
+	}
+	dc, err := b.Build(mr)
+	if err != nil {
+		return errors.Wrapf(err, "cannot convert %s %q to %T", kindOf(mr), name, &composed.Unstructured{})
+	}
+	desired[resource.Name(name)] = &resource.DesiredComposed{Resource: dc}
+	return nil
+}
+
+// kindOf returns the kind the supplied object is registered as, or its Go
+// type if it isn't registered.
+func kindOf(o runtime.Object) string {
+	if gvks, _, err := composed.Scheme.ObjectKinds(o); err == nil && len(gvks) > 0 {
+		return gvks[0].Kind
+	}
+	return fmt.Sprintf("%T", o)
+}
+
+// newVPC returns the VPC with the supplied name and role. Its CIDR block is
+// allocated from an IPAM pool if one is configured, and it gets an Amazon
+// provided IPv6 CIDR block if IPv6 is enabled. Only a VPC with a known CIDR
+// block is annotated with it.
+func newVPC(cfg Config, name, role string) *awsv1beta1.VPC {
+	vpc := &awsv1beta1.VPC{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+				labelVPCID:     cfg.vpcIDLabel(name),
+				labelRole:      role,
+			}),
+		},
+		Spec: awsv1beta1.VPCSpec{
+			ForProvider: awsv1beta1.VPCParameters_2{
+				Region:             ptr.To(cfg.Region),
+				EnableDNSSupport:   ptr.To(true),
+				EnableDNSHostnames: ptr.To(true),
+				Tags:               tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference:          &v1.Reference{Name: cfg.ProviderConfigName},
+				WriteConnectionSecretToReference: cfg.connectionSecretRef(name),
+			},
+		},
+	}
+
+	if cfg.EnableIPv6 {
+		vpc.Spec.ForProvider.AssignGeneratedIPv6CidrBlock = ptr.To(true)
+	}
+	if cfg.UsesIPAM() {
+		vpc.Spec.ForProvider.IPv4IpamPoolID = ptr.To(cfg.IPv4IPAMPoolID)
+		vpc.Spec.ForProvider.IPv4NetmaskLength = ptr.To(float64(cfg.IPv4NetmaskLength))
+		return vpc
+	}
+	vpc.Spec.ForProvider.CidrBlock = ptr.To(cfg.CIDRBlock)
+	vpc.SetAnnotations(map[string]string{annotationCIDR: cfg.CIDRBlock})
+	return vpc
+}
+
+// gatewayProviderConfigName returns the provider config of gateways, which is
+// the VPC's unless spec.gatewayProviderConfigName overrides it.
+func (c Config) gatewayProviderConfigName() string {
+	if c.GatewayProviderConfigName != "" {
+		return c.GatewayProviderConfigName
+	}
+	return c.ProviderConfigName
+}
+
+// newGateway returns an InternetGateway with the supplied name, attached to the
+// named VPC. The VPC is selected by label unless spec.gatewayRefByName is set,
+// in which case it's referenced by name.
+func newGateway(cfg Config, name, vpcName string) *awsv1beta1.InternetGateway {
+	gw := &awsv1beta1.InternetGateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+			}),
+		},
+		Spec: awsv1beta1.InternetGatewaySpec{
+			ForProvider: awsv1beta1.InternetGatewayParameters_2{
+				Region: ptr.To(cfg.Region),
+				Tags:   tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference:          &v1.Reference{Name: cfg.gatewayProviderConfigName()},
+				WriteConnectionSecretToReference: cfg.connectionSecretRef(name),
+			},
+		},
+	}
+
+	if cfg.GatewayRefByName {
+		gw.Spec.ForProvider.VPCIDRef = &v1.Reference{Name: vpcName}
+		return gw
+	}
+	gw.Spec.ForProvider.VPCIDSelector = &v1.Selector{
+		MatchControllerRef: ptr.To(true),
+		MatchLabels:        cfg.gatewayVPCMatchLabels(vpcName),
+	}
+	return gw
+}
+
+// subnet is a planned subnet of a VPC.
+type subnet struct {
+	Name     string
+	Tier     string
+	AZ       string
+	CIDR     string
+	IPv6CIDR string
+}
+
+// planSubnets returns the subnets of the i'th VPC. Each requested tier gets a
+// subnet in every availability zone, numbered by the zone's slot. Subnet CIDR
+// blocks are packed contiguously from the start of the VPC's CIDR block, public
+// tier first, or start on each spec.subnetAlignment boundary when that's set.
+// With spec.stableResourceKeys they're instead placed by their zone's slot, so
+// they don't move when zones are added. If the VPC's IPv6 CIDR block is
+// supplied each subnet also gets the /64 at the same index within it.
+func planSubnets(cfg Config, i int64, ipv6Block string) ([]subnet, error) {
+	tiers := cfg.subnetTiers()
+	subnets := make([]subnet, 0, len(tiers)*len(cfg.AvailabilityZones))
+	for _, tier := range tiers {
+		for j, az := range cfg.AvailabilityZones {
+			s := subnet{
+				Name: names.SubnetName(cfg.ID, i, tier, cfg.azSlot(j)),
+				Tier: tier,
+				AZ:   az,
+			}
+			n := cfg.subnetBlock(tier, j, len(subnets))
+			block, err := subnetCIDR(cfg.CIDRBlock, cfg.subnetStride(), n)
+			if err != nil {
+				return nil, err
+			}
+			cidr, err := subnetCIDR(block, subnetPrefixLength, 0)
+			if err != nil {
+				return nil, err
+			}
+			s.CIDR = cidr
+			if ipv6Block != "" {
+				cidr, err := ipv6SubnetCIDR(ipv6Block, ipv6SubnetPrefixLength, n)
+				if err != nil {
+					return nil, err
+				}
+				s.IPv6CIDR = cidr
+			}
+			subnets = append(subnets, s)
+		}
+	}
+	return subnets, nil
+}
+
+// validateSubnetsPerAZ returns a ValidationError if the function would create
+// more subnets in an availability zone than spec.maxSubnetsPerAz allows. Each
+// VPC has one subnet of each tier in each of its AZs.
+func (c Config) validateSubnetsPerAZ() error {
+	tiers := c.subnetTiers()
+	if c.MaxSubnetsPerAZ == 0 || len(c.AvailabilityZones) == 0 || int64(len(tiers)) <= c.MaxSubnetsPerAZ {
+		return nil
+	}
+	return &ValidationError{Field: "spec.maxSubnetsPerAz", Reason: fmt.Sprintf("would create %d subnets in each availability zone (%s), more than %d", len(tiers), strings.Join(tiers, ", "), c.MaxSubnetsPerAZ)}
+}
+
+// subnetTiers returns the tiers of subnets to create in each availability
+// zone.
+func (c Config) subnetTiers() []string {
+	var tiers []string
+	if c.PublicSubnets {
+		tiers = append(tiers, tierPublic)
+	}
+	if c.PrivateSubnets {
+		tiers = append(tiers, tierPrivate)
+	}
+	if c.FirewallSubnets {
+		tiers = append(tiers, tierFirewall)
+	}
+	return tiers
+}
+
+// vpcIDLabel returns the value of the vpc-id label of the named VPC, which is
+// its name unless spec.vpcIdLabels overrides it.
+func (c Config) vpcIDLabel(vpcName string) string {
+	for i, v := range c.VPCIDLabels {
+		if names.VPCName(c.ID, i) == vpcName {
+			return v
+		}
+	}
+	return vpcName
+}
+
+// managedLabels returns the supplied labels, or nil if spec.disableManagedLabels
+// is set.
+func (c Config) managedLabels(labels map[string]string) map[string]string {
+	if c.DisableManagedLabels {
+		return nil
+	}
+	return labels
+}
+
+// uniqueAZs returns the supplied availability zones with any duplicates
+// removed, keeping the first occurrence of each, and the zones that were
+// duplicated.
+func uniqueAZs(azs []string) (unique, dupes []string) {
+	seen := map[string]int{}
+	for _, az := range azs {
+		seen[az]++
+		switch seen[az] {
+		case 1:
+			unique = append(unique, az)
+		case 2:
+			dupes = append(dupes, az)
+		}
+	}
+	return unique, dupes
+}
+
+// subnetTags returns the tags configured for subnets of the supplied tier.
+func (c Config) subnetTags(tier string) map[string]string {
+	switch tier {
+	case tierPublic:
+		return c.PublicSubnetTags
+	case tierPrivate:
+		return c.PrivateSubnetTags
+	}
+	return nil
+}
+
+// newSubnet returns the supplied planned subnet, in the named VPC. Subnets with
+// an IPv6 CIDR block are dual-stack. The VPC is selected by label unless managed
+// labels are disabled, in which case it's referenced by name.
+func newSubnet(cfg Config, s subnet, vpcName string) *awsv1beta1.Subnet {
+	sn := &awsv1beta1.Subnet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: s.Name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID:  cfg.ID,
+				labelVPCID:      cfg.vpcIDLabel(vpcName),
+				labelSubnetTier: s.Tier,
+			}),
+			Annotations: map[string]string{
+				annotationCIDR: s.CIDR,
+			},
+		},
+		Spec: awsv1beta1.SubnetSpec{
+			ForProvider: awsv1beta1.SubnetParameters_2{
+				Region:              ptr.To(cfg.Region),
+				AvailabilityZone:    ptr.To(s.AZ),
+				CidrBlock:           ptr.To(s.CIDR),
+				MapPublicIPOnLaunch: ptr.To(s.Tier == tierPublic && cfg.PublicSubnetAutoAssignIP),
+				Tags:                tagsFor(cfg, s.Name, cfg.clusterTags(s.Tier), cfg.subnetTags(s.Tier)),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+
+	if cfg.DisableManagedLabels {
+		sn.Spec.ForProvider.VPCIDRef = &v1.Reference{Name: vpcName}
+	} else {
+		sn.Spec.ForProvider.VPCIDSelector = &v1.Selector{
+			MatchControllerRef: ptr.To(true),
+			MatchLabels: map[string]string{
+				labelVPCID: cfg.vpcIDLabel(vpcName),
+			},
+		}
+	}
+	if s.IPv6CIDR != "" {
+		sn.Spec.ForProvider.IPv6CidrBlock = ptr.To(s.IPv6CIDR)
+		sn.Spec.ForProvider.AssignIPv6AddressOnCreation = ptr.To(true)
+	}
+	return sn
+}
+
+// newDBSubnetGroup returns an RDS SubnetGroup with the supplied name, spanning
+// the private subnets of the named VPC. The subnets are selected by label
+// unless managed labels are disabled, in which case the supplied subnets'
+// private ones are referenced by name.
+func newDBSubnetGroup(cfg Config, name, vpcName string, subnets []subnet) *rdsv1beta1.SubnetGroup {
+	sg := &rdsv1beta1.SubnetGroup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+				labelVPCID:     cfg.vpcIDLabel(vpcName),
+			}),
+		},
+		Spec: rdsv1beta1.SubnetGroupSpec{
+			ForProvider: rdsv1beta1.SubnetGroupParameters{
+				Region:      ptr.To(cfg.Region),
+				Description: ptr.To(fmt.Sprintf("Private subnets of VPC %s", vpcName)),
+				Tags:        tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+
+	if cfg.DisableManagedLabels {
+		for _, s := range subnets {
+			if s.Tier == tierPrivate {
+				sg.Spec.ForProvider.SubnetIDRefs = append(sg.Spec.ForProvider.SubnetIDRefs, v1.Reference{Name: s.Name})
+			}
+		}
+		return sg
+	}
+	sg.Spec.ForProvider.SubnetIDSelector = &v1.Selector{
+		MatchControllerRef: ptr.To(true),
+		MatchLabels: map[string]string{
+			labelVPCID:      cfg.vpcIDLabel(vpcName),
+			labelSubnetTier: tierPrivate,
+		},
+	}
+	return sg
+}
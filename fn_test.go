@@ -1,18 +1,40 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
 	"google.golang.org/protobuf/types/known/durationpb"
 
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
 	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/config"
+
+	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	rdsv1beta1 "github.com/upbound/provider-aws/apis/rds/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
 )
 
 func TestRunFunction(t *testing.T) {
@@ -21,8 +43,11 @@ func TestRunFunction(t *testing.T) {
 		req *fnv1.RunFunctionRequest
 	}
 	type want struct {
-		rsp *fnv1.RunFunctionResponse
-		err error
+		// desired names the desired composed resources, each compared
+		// with its golden file in testdata/<case>/<name>.json.
+		desired []string
+		rsp     *fnv1.RunFunctionResponse
+		err     error
 	}
 
 	cases := map[string]struct {
@@ -62,62 +87,167 @@ func TestRunFunction(t *testing.T) {
 				},
 			},
 			want: want{
+				desired: []string{"vpc-code-0", "gateway-code-0"},
 				rsp: &fnv1.RunFunctionResponse{
 					Meta: &fnv1.ResponseMeta{Ttl: durationpb.New(60 * time.Second)},
-					Desired: &fnv1.State{
-						Resources: map[string]*fnv1.Resource{
-							"vpc-code-0": {Resource: resource.MustStructJSON(`{
-								"apiVersion": "ec2.aws.upbound.io/v1beta1",
-								"kind": "VPC",
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "demo-xfn-network version " + Version,
+							Reason:   ptr.To(reasonVersion),
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "InternetGateways: 1 new, 0 already attached (new: gateway-code-0)",
+							Reason:   ptr.To(reasonGatewayChanges),
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{},
+				},
+			},
+		},
+		"AddDBSubnetGroup": {
+			reason: "The Function should add private subnets in each availability zone and a DB subnet group that selects them",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+								"kind": "XNetwork",
 								"metadata": {
-									"labels": {
-										"networks.meta.fn.crossplane.io/network-id": "code",
-										"networks.meta.fn.crossplane.io/vpc-id": "vpc-code-0"
-									},
-									"name": "vpc-code-0"
+									"name": "network-code"
 								},
 								"spec": {
-									"forProvider": {
-										"cidrBlock": "192.168.0.0/16",
-										"enableDnsHostnames": true,
-										"enableDnsSupport": true,
-										"region": "eu-central-1"
-									},
-									"providerConfigRef": {
-										"name": "default"
-									}
-								},
-								"status": {
-									"observedGeneration": 0
+									"id": "code",
+									"count": 1,
+									"availabilityZones": ["eu-central-1a", "eu-central-1b"],
+									"privateSubnets": true,
+									"createDbSubnetGroup": true
 								}
-							}`)},
-							"gateway-code-0": {Resource: resource.MustStructJSON(`{
-								"apiVersion": "ec2.aws.upbound.io/v1beta1",
-								"kind": "InternetGateway",
+							}`),
+						},
+					},
+				},
+			},
+			want: want{
+				desired: []string{"vpc-code-0", "subnet-code-0-private-0", "subnet-code-0-private-1", "dbsubnetgroup-code-0"},
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Ttl: durationpb.New(60 * time.Second)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "demo-xfn-network version " + Version,
+							Reason:   ptr.To(reasonVersion),
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "spec.providerConfigName is unset, so resources will use the ProviderConfig named default; set it explicitly if that isn't intended",
+							Reason:   ptr.To(reasonProviderConfigAssumed),
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `VPC "vpc-code-0" has 99.2% of 192.168.0.0/16 unallocated: 192.168.2.0/23, 192.168.4.0/22, 192.168.8.0/21, 192.168.16.0/20, 192.168.32.0/19, 192.168.64.0/18, 192.168.128.0/17`,
+							Reason:   ptr.To(reasonFreeAddressSpace),
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{},
+				},
+			},
+		},
+		"DBSubnetGroupRequiresTwoAZs": {
+			reason: "The Function should return a fatal result if a DB subnet group would span fewer than two availability zones",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+								"kind": "XNetwork",
 								"metadata": {
-									"labels": {
-										"networks.meta.fn.crossplane.io/network-id": "code"
-									},
-									"name": "gateway-code-0"
+									"name": "network-code"
 								},
 								"spec": {
-									"forProvider": {
-										"region": "eu-central-1",
-										"vpcIdSelector": {
-											"matchControllerRef": true,
-											"matchLabels": {
-												"networks.meta.fn.crossplane.io/vpc-id": "vpc-code-0"
-											}
-										}
-									},
-									"providerConfigRef": {
-										"name": "default"
-									}
+									"id": "code",
+									"count": 1,
+									"availabilityZones": ["eu-central-1a", "eu-central-1a"],
+									"privateSubnets": true,
+									"createDbSubnetGroup": true
+								}
+							}`),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Ttl: durationpb.New(60 * time.Second)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "demo-xfn-network version " + Version,
+							Reason:   ptr.To(reasonVersion),
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "invalid network config: spec.createDbSubnetGroup: requires private subnets in at least 2 availability zones",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+				},
+			},
+		},
+		"GatewayWithoutVPCs": {
+			reason: "The Function should warn that no gateways will be created when includeGateway is true but count is 0",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+								"kind": "XNetwork",
+								"metadata": {
+									"name": "network-code"
 								},
-								"status": {
-									"observedGeneration": 0
+								"spec": {
+									"id": "code",
+									"count": 0,
+									"includeGateway": true
 								}
-							}`)},
+							}`),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Ttl: durationpb.New(60 * time.Second)},
+					Desired: &fnv1.State{
+						Resources: map[string]*fnv1.Resource{},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "demo-xfn-network version " + Version,
+							Reason:   ptr.To(reasonVersion),
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "spec.providerConfigName is unset, so resources will use the ProviderConfig named default; set it explicitly if that isn't intended",
+							Reason:   ptr.To(reasonProviderConfigAssumed),
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "spec.includeGateway is true but spec.count is 0; InternetGateways are only created for VPCs, so none will be created",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
 				},
@@ -130,13 +260,2874 @@ func TestRunFunction(t *testing.T) {
 			f := &Function{log: logging.NewNopLogger()}
 			rsp, err := f.RunFunction(tc.args.ctx, tc.args.req)
 
-			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform(), protocmp.IgnoreFields(&fnv1.State{}, "resources")); diff != "" {
 				t.Errorf("%s\nf.RunFunction(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
 			}
 
+			got := make([]string, 0, len(rsp.GetDesired().GetResources()))
+			for name := range rsp.GetDesired().GetResources() {
+				got = append(got, name)
+			}
+			if diff := cmp.Diff(tc.want.desired, got, cmpopts.EquateEmpty(), cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want desired resources, +got desired resources:\n%s", tc.reason, diff)
+			}
+			for _, r := range tc.want.desired {
+				assertDesired(t, rsp, r, filepath.Join("testdata", name, r+".json"))
+			}
+
 			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
 				t.Errorf("%s\nf.RunFunction(...): -want err, +got err:\n%s", tc.reason, diff)
 			}
 		})
 	}
 }
+
+// logEntry is a single message captured by a recordingLogger.
+type logEntry struct {
+	msg string
+	kv  map[string]any
+}
+
+// recordingLogger is a logging.Logger that captures debug messages so tests
+// can assert on their structured fields.
+type recordingLogger struct {
+	debug []logEntry
+}
+
+func (l *recordingLogger) Info(_ string, _ ...any) {}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...any) {
+	e := logEntry{msg: msg, kv: map[string]any{}}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		e.kv[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+	l.debug = append(l.debug, e)
+}
+
+func (l *recordingLogger) WithValues(_ ...any) logging.Logger { return l }
+
+func TestRunFunctionDebugConfig(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   map[string]any
+	}{
+		"AllFieldsSet": {
+			reason: "The resolved config should be logged at debug verbosity with a structured field per setting",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 2,
+					"includeGateway": true,
+					"providerConfigName": "aws",
+					"region": "us-west-2"
+				}
+			}`,
+			want: map[string]any{
+				"id":                 "code",
+				"count":              int64(2),
+				"includeGateway":     true,
+				"region":             "us-west-2",
+				"providerConfigName": "aws",
+				"cidrBlock":          "192.168.0.0/16",
+			},
+		},
+		"Defaulted": {
+			reason: "Defaulted settings should be logged with their resolved values",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code"
+				}
+			}`,
+			want: map[string]any{
+				"id":                 "code",
+				"count":              int64(0),
+				"includeGateway":     false,
+				"region":             "eu-central-1",
+				"providerConfigName": "default",
+				"cidrBlock":          "192.168.0.0/16",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			log := &recordingLogger{}
+			f := &Function{log: log}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			if _, err := f.RunFunction(context.Background(), req); err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var got map[string]any
+			for _, e := range log.debug {
+				if e.msg == "Resolved network config" {
+					got = e.kv
+				}
+			}
+			for k, want := range tc.want {
+				if diff := cmp.Diff(want, got[k]); diff != "" {
+					t.Errorf("%s\nf.RunFunction(...): -want %s, +got %s:\n%s", tc.reason, k, k, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestRunFunctionDeterministic(t *testing.T) {
+	req := &fnv1.RunFunctionRequest{
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{
+				Resource: resource.MustStructJSON(`{
+					"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+					"kind": "XNetwork",
+					"metadata": {"name": "network-code"},
+					"spec": {
+						"id": "code",
+						"count": 5,
+						"includeGateway": true
+					}
+				}`),
+			},
+		},
+	}
+
+	f := &Function{log: logging.NewNopLogger()}
+	first, err := f.RunFunction(context.Background(), req)
+	if err != nil {
+		t.Fatalf("f.RunFunction(...): unexpected error: %v", err)
+	}
+	second, err := f.RunFunction(context.Background(), req)
+	if err != nil {
+		t.Fatalf("f.RunFunction(...): unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff(first, second, protocmp.Transform()); diff != "" {
+		t.Errorf("f.RunFunction(...): identical requests should produce identical responses: -first, +second:\n%s", diff)
+	}
+
+	// Equal messages can still serialize differently if anything in them is
+	// order dependent, so compare the deterministic wire encoding too.
+	mo := proto.MarshalOptions{Deterministic: true}
+	a, err := mo.Marshal(first)
+	if err != nil {
+		t.Fatalf("proto.Marshal(...): unexpected error: %v", err)
+	}
+	b, err := mo.Marshal(second)
+	if err != nil {
+		t.Fatalf("proto.Marshal(...): unexpected error: %v", err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Errorf("proto.Marshal(...): identical requests should produce byte-identical responses")
+	}
+}
+
+func TestNewGateway(t *testing.T) {
+	type want struct {
+		ref      *v1.Reference
+		selector *v1.Selector
+	}
+
+	cases := map[string]struct {
+		reason string
+		cfg    Config
+		want   want
+	}{
+		"Selector": {
+			reason: "By default the gateway should select its VPC by label",
+			cfg:    Config{Config: config.Config{ID: "code"}},
+			want: want{
+				selector: &v1.Selector{
+					MatchControllerRef: ptr.To(true),
+					MatchLabels: map[string]string{
+						"networks.meta.fn.crossplane.io/vpc-id": "vpc-code-0",
+					},
+				},
+			},
+		},
+		"BroadenedSelector": {
+			reason: "With spec.gatewayVpcSelector the gateway should select VPCs by its labels, with placeholders filled in",
+			cfg: Config{Config: config.Config{ID: "code", GatewayVPCSelector: map[string]string{
+				"networks.meta.fn.crossplane.io/network-id": "{id}",
+				"example.org/shared-with":                   "{vpc}-peers",
+			}}},
+			want: want{
+				selector: &v1.Selector{
+					MatchControllerRef: ptr.To(true),
+					MatchLabels: map[string]string{
+						"networks.meta.fn.crossplane.io/network-id": "code",
+						"example.org/shared-with":                   "vpc-code-0-peers",
+					},
+				},
+			},
+		},
+		"RefByName": {
+			reason: "With spec.gatewayRefByName the gateway should reference its VPC by name, without a selector",
+			cfg:    Config{Config: config.Config{ID: "code", GatewayRefByName: true}},
+			want: want{
+				ref: &v1.Reference{Name: "vpc-code-0"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			gw := newGateway(tc.cfg, "gateway-code-0", "vpc-code-0")
+
+			if diff := cmp.Diff(tc.want.ref, gw.Spec.ForProvider.VPCIDRef); diff != "" {
+				t.Errorf("%s\nnewGateway(...): -want VPCIDRef, +got VPCIDRef:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.selector, gw.Spec.ForProvider.VPCIDSelector); diff != "" {
+				t.Errorf("%s\nnewGateway(...): -want VPCIDSelector, +got VPCIDSelector:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// runXR runs the Function against a request observing the supplied XR JSON.
+func runXR(t *testing.T, xr string) *fnv1.RunFunctionResponse {
+	t.Helper()
+	f := &Function{log: logging.NewNopLogger()}
+	req := &fnv1.RunFunctionRequest{
+		Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)}},
+	}
+	rsp, err := f.RunFunction(context.Background(), req)
+	if err != nil {
+		t.Fatalf("f.RunFunction(...): unexpected error: %v", err)
+	}
+	return rsp
+}
+
+// update rewrites the golden files compared by assertDesired with what the
+// Function composed, e.g. go test -run TestRunFunction -update.
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// assertDesired compares the named desired composed resource with the JSON in
+// the supplied golden file. Both are compared as plain JSON objects, so a diff
+// reads like the resource rather than its protobuf representation.
+func assertDesired(t *testing.T, rsp *fnv1.RunFunctionResponse, name, goldenPath string) {
+	t.Helper()
+	r, ok := rsp.GetDesired().GetResources()[name]
+	if !ok {
+		t.Errorf("f.RunFunction(...): no desired composed resource %q", name)
+		return
+	}
+	got := r.GetResource().AsMap()
+
+	if *update {
+		b, err := json.MarshalIndent(got, "", "  ")
+		if err != nil {
+			t.Fatalf("json.MarshalIndent(...): unexpected error: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0o750); err != nil {
+			t.Fatalf("os.MkdirAll(...): unexpected error: %v", err)
+		}
+		if err := os.WriteFile(goldenPath, append(b, '\n'), 0o600); err != nil {
+			t.Fatalf("os.WriteFile(...): unexpected error: %v", err)
+		}
+	}
+
+	b, err := os.ReadFile(goldenPath) //nolint:gosec // Golden files are test fixtures.
+	if err != nil {
+		t.Fatalf("os.ReadFile(...): unexpected error: %v", err)
+	}
+	want := map[string]any{}
+	if err := json.Unmarshal(b, &want); err != nil {
+		t.Fatalf("json.Unmarshal(%s): unexpected error: %v", goldenPath, err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("f.RunFunction(...): -want %s, +got %s:\n%s", goldenPath, name, diff)
+	}
+}
+
+// desiredStrings returns the string at the supplied field path of every
+// desired composed resource that has one, keyed by resource name.
+func desiredStrings(t *testing.T, rsp *fnv1.RunFunctionResponse, path string) map[string]string {
+	t.Helper()
+	desired, err := request.GetDesiredComposedResources(&fnv1.RunFunctionRequest{Desired: rsp.GetDesired()})
+	if err != nil {
+		t.Fatalf("request.GetDesiredComposedResources(...): unexpected error: %v", err)
+	}
+	got := map[string]string{}
+	for name, dc := range desired {
+		if v, err := dc.Resource.GetString(path); err == nil {
+			got[string(name)] = v
+		}
+	}
+	return got
+}
+
+// desiredBools returns the bool at the supplied field path of every desired
+// composed resource that has one, keyed by resource name.
+func desiredBools(t *testing.T, rsp *fnv1.RunFunctionResponse, path string) map[string]bool {
+	t.Helper()
+	desired, err := request.GetDesiredComposedResources(&fnv1.RunFunctionRequest{Desired: rsp.GetDesired()})
+	if err != nil {
+		t.Fatalf("request.GetDesiredComposedResources(...): unexpected error: %v", err)
+	}
+	got := map[string]bool{}
+	for name, dc := range desired {
+		if v, err := dc.Resource.GetBool(path); err == nil {
+			got[string(name)] = v
+		}
+	}
+	return got
+}
+
+// resultMessages returns the message of every result in the supplied response,
+// except the results most XRs get, such as those reporting the function's
+// version, linking to VPCs in the AWS console, and warning that the default
+// ProviderConfig is assumed.
+func resultMessages(rsp *fnv1.RunFunctionResponse) []string {
+	var msgs []string
+	for _, r := range rsp.GetResults() {
+		switch r.GetReason() {
+		case reasonVersion, reasonConsoleLink, reasonGatewayChanges, reasonFreeAddressSpace, reasonProviderConfigAssumed, reasonProviderConfigAssignment:
+			continue
+		}
+		msgs = append(msgs, r.GetMessage())
+	}
+	return msgs
+}
+
+func TestRunFunctionProviderConfigs(t *testing.T) {
+	type want struct {
+		providerConfigs map[string]string
+		results         []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"RoundRobin": {
+			reason: "VPCs and their gateways should be spread across the supplied provider configs by index",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 3,
+					"includeGateway": true,
+					"providerConfigs": ["account-a", "account-b"]
+				}
+			}`,
+			want: want{
+				providerConfigs: map[string]string{
+					"vpc-code-0":     "account-a",
+					"gateway-code-0": "account-a",
+					"vpc-code-1":     "account-b",
+					"gateway-code-1": "account-b",
+					"vpc-code-2":     "account-a",
+					"gateway-code-2": "account-a",
+				},
+			},
+		},
+		"GatewayOverride": {
+			reason: "Gateways should use spec.gatewayProviderConfigName while VPCs and subnets use the base provider config",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 2,
+					"includeGateway": true,
+					"privateSubnets": true,
+					"availabilityZones": ["eu-central-1a"],
+					"providerConfigName": "compute",
+					"gatewayProviderConfigName": "network"
+				}
+			}`,
+			want: want{
+				providerConfigs: map[string]string{
+					"vpc-code-0":              "compute",
+					"subnet-code-0-private-0": "compute",
+					"gateway-code-0":          "network",
+					"vpc-code-1":              "compute",
+					"subnet-code-1-private-0": "compute",
+					"gateway-code-1":          "network",
+				},
+			},
+		},
+		"GatewayOverrideRoundRobin": {
+			reason: "spec.gatewayProviderConfigName should override the provider config each gateway's VPC is assigned",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 2,
+					"includeGateway": true,
+					"providerConfigs": ["account-a", "account-b"],
+					"gatewayProviderConfigName": "network"
+				}
+			}`,
+			want: want{
+				providerConfigs: map[string]string{
+					"vpc-code-0":     "account-a",
+					"gateway-code-0": "network",
+					"vpc-code-1":     "account-b",
+					"gateway-code-1": "network",
+				},
+			},
+		},
+		"EmptyList": {
+			reason: "An explicitly empty list of provider configs should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"providerConfigs": []
+				}
+			}`,
+			want: want{
+				providerConfigs: map[string]string{},
+				results:         []string{"invalid network config: spec.providerConfigs: must not be empty when set"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.providerConfigs, desiredStrings(t, rsp, "spec.providerConfigRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want provider configs, +got provider configs:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionDefaults(t *testing.T) {
+	cases := map[string]struct {
+		reason   string
+		defaults config.Defaults
+		xr       string
+		want     map[string]string
+	}{
+		"DeploymentDefault": {
+			reason:   "The deployment-wide default CIDR should be used when the XR doesn't specify one",
+			defaults: config.Defaults{CIDRBlock: "10.0.0.0/16"},
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 1}
+			}`,
+			want: map[string]string{"vpc-code-0": "10.0.0.0/16"},
+		},
+		"XROverride": {
+			reason:   "A CIDR specified on the XR should win over the deployment-wide default",
+			defaults: config.Defaults{CIDRBlock: "10.0.0.0/16"},
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 1, "cidrBlock": "172.16.0.0/16"}
+			}`,
+			want: map[string]string{"vpc-code-0": "172.16.0.0/16"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), defaults: tc.defaults}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want, desiredStrings(t, rsp, "spec.forProvider.cidrBlock")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want CIDR blocks, +got CIDR blocks:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionVersion(t *testing.T) {
+	old := Version
+	Version = "v1.2.3"
+	t.Cleanup(func() { Version = old })
+
+	rsp := runXR(t, `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 1, "providerConfigName": "default"}
+	}`)
+
+	want := []*fnv1.Result{{
+		Severity: fnv1.Severity_SEVERITY_NORMAL,
+		Message:  "demo-xfn-network version v1.2.3",
+		Reason:   ptr.To(reasonVersion),
+		Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+	}}
+	if diff := cmp.Diff(want, rsp.GetResults(), protocmp.Transform()); diff != "" {
+		t.Errorf("f.RunFunction(...): -want results, +got results:\n%s", diff)
+	}
+}
+
+func TestRunFunctionProviderConfigAssumed(t *testing.T) {
+	xr := func(spec string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "code", "count": 1, "region": "eu-central-1", "cidrBlock": "10.0.0.0/16"` + spec + `}
+		}`
+	}
+	assumed := "spec.providerConfigName is unset, so resources will use the ProviderConfig named default; set it explicitly if that isn't intended"
+
+	cases := map[string]struct {
+		reason   string
+		xr       string
+		defaults config.Defaults
+		want     []string
+	}{
+		"Omitted": {
+			reason: "An XR without a provider config should be warned that the default is assumed",
+			xr:     xr(``),
+			want:   []string{assumed},
+		},
+		"Set": {
+			reason: "An XR that sets its provider config, even to default, shouldn't be warned",
+			xr:     xr(`, "providerConfigName": "default"`),
+		},
+		"ProviderConfigs": {
+			reason: "An XR that spreads its VPCs across provider configs shouldn't be warned",
+			xr:     xr(`, "providerConfigs": ["aws-a", "aws-b"]`),
+		},
+		"DeploymentDefault": {
+			reason:   "An XR that takes the deployment's default provider config shouldn't be warned",
+			xr:       xr(``),
+			defaults: config.Defaults{ProviderConfigName: "aws-platform"},
+		},
+		"Strict": {
+			reason: "A strict XR should only get the warning it gets for every defaulted field",
+			xr:     xr(`, "strict": true`),
+			want:   []string{"spec.providerConfigName is unset, so it defaulted to default"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), defaults: tc.defaults}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var got []string
+			for _, r := range rsp.GetResults() {
+				if r.GetSeverity() == fnv1.Severity_SEVERITY_WARNING {
+					got = append(got, r.GetMessage())
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want warnings, +got warnings:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionIPAM(t *testing.T) {
+	type want struct {
+		pools   map[string]string
+		cidrs   map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		spec   string
+		want   want
+	}{
+		"IPAMPool": {
+			reason: "A VPC should be allocated from the IPAM pool instead of using an explicit CIDR block",
+			spec:   `{"id": "code", "count": 1, "ipv4IpamPoolId": "ipam-pool-0123", "ipv4NetmaskLength": 20}`,
+			want: want{
+				pools: map[string]string{"vpc-code-0": "ipam-pool-0123"},
+				cidrs: map[string]string{},
+			},
+		},
+		"PoolWithoutNetmask": {
+			reason: "An IPAM pool without a netmask length should return a fatal result",
+			spec:   `{"id": "code", "count": 1, "ipv4IpamPoolId": "ipam-pool-0123"}`,
+			want: want{
+				pools:   map[string]string{},
+				cidrs:   map[string]string{},
+				results: []string{"invalid network config: spec.ipv4IpamPoolId: must be set together with spec.ipv4NetmaskLength"},
+			},
+		},
+		"PoolWithCIDR": {
+			reason: "An IPAM pool combined with an explicit CIDR block should return a fatal result",
+			spec:   `{"id": "code", "count": 1, "ipv4IpamPoolId": "ipam-pool-0123", "ipv4NetmaskLength": 20, "cidrBlock": "10.0.0.0/16"}`,
+			want: want{
+				pools:   map[string]string{},
+				cidrs:   map[string]string{},
+				results: []string{"invalid network config: spec.cidrBlock: cannot be combined with spec.ipv4IpamPoolId"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": `+tc.spec+`
+			}`)
+
+			if diff := cmp.Diff(tc.want.pools, desiredStrings(t, rsp, "spec.forProvider.ipv4IpamPoolId")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want IPAM pools, +got IPAM pools:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cidrs, desiredStrings(t, rsp, "spec.forProvider.cidrBlock")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want CIDR blocks, +got CIDR blocks:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionPrimaryVPC(t *testing.T) {
+	type want struct {
+		roles   map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"DefaultPrimary": {
+			reason: "The first VPC should be primary and the rest secondary by default",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 3,
+					"includeGateway": true
+				}
+			}`,
+			want: want{
+				roles: map[string]string{
+					"vpc-code-0": rolePrimary,
+					"vpc-code-1": roleSecondary,
+					"vpc-code-2": roleSecondary,
+				},
+			},
+		},
+		"ConfiguredPrimary": {
+			reason: "The VPC at spec.primaryVpcIndex should be primary",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 3,
+					"primaryVpcIndex": 2
+				}
+			}`,
+			want: want{
+				roles: map[string]string{
+					"vpc-code-0": roleSecondary,
+					"vpc-code-1": roleSecondary,
+					"vpc-code-2": rolePrimary,
+				},
+			},
+		},
+		"OutOfRange": {
+			reason: "A primary VPC index beyond the VPC count should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 3,
+					"primaryVpcIndex": 3
+				}
+			}`,
+			want: want{
+				roles:   map[string]string{},
+				results: []string{"invalid network config: spec.primaryVpcIndex: 3 is out of range for spec.count 3"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.roles, desiredStrings(t, rsp, "metadata.labels["+labelRole+"]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want roles, +got roles:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionDuplicateAZs(t *testing.T) {
+	type want struct {
+		azs     map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Collapsed": {
+			reason: "Duplicate availability zones should be collapsed with a warning",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"privateSubnets": true,
+					"availabilityZones": ["eu-central-1a", "eu-central-1b", "eu-central-1a", "eu-central-1a"]
+				}
+			}`,
+			want: want{
+				azs: map[string]string{
+					"subnet-code-0-private-0": "eu-central-1a",
+					"subnet-code-0-private-1": "eu-central-1b",
+				},
+				results: []string{"spec.availabilityZones lists eu-central-1a more than once; the duplicates were collapsed"},
+			},
+		},
+		"CollapsedBeforeFit": {
+			reason: "Duplicate availability zones shouldn't count towards the subnets that must fit in the CIDR block",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"cidrBlock": "10.0.0.0/23",
+					"privateSubnets": true,
+					"availabilityZones": ["eu-central-1a", "eu-central-1b", "eu-central-1a"]
+				}
+			}`,
+			want: want{
+				azs: map[string]string{
+					"subnet-code-0-private-0": "eu-central-1a",
+					"subnet-code-0-private-1": "eu-central-1b",
+				},
+				results: []string{"spec.availabilityZones lists eu-central-1a more than once; the duplicates were collapsed"},
+			},
+		},
+		"Strict": {
+			reason: "Duplicate availability zones should return a fatal result in strict mode",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"strict": true,
+					"privateSubnets": true,
+					"availabilityZones": ["eu-central-1a", "eu-central-1b", "eu-central-1b", "eu-central-1a"]
+				}
+			}`,
+			want: want{
+				azs:     map[string]string{},
+				results: []string{"invalid network config: spec.availabilityZones: lists eu-central-1b, eu-central-1a more than once"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.azs, desiredStrings(t, rsp, "spec.forProvider.availabilityZone")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want availability zones, +got availability zones:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionMaxAZs(t *testing.T) {
+	xr := func(maxAZs string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"region": "us-east-1",
+				"privateSubnets": true,
+				"availabilityZones": ["us-east-1d", "us-east-1b", "us-east-1c", "us-east-1a"],
+				"maxAzs": ` + maxAZs + `
+			}
+		}`
+	}
+
+	type want struct {
+		azs     map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Capped": {
+			reason: "Four availability zones should be capped to the first two in sorted order",
+			xr:     xr("2"),
+			want: want{
+				azs: map[string]string{
+					"subnet-code-0-private-0": "us-east-1a",
+					"subnet-code-0-private-1": "us-east-1b",
+				},
+			},
+		},
+		"Uncapped": {
+			reason: "Availability zones within the cap should be used in the order they're listed",
+			xr:     xr("4"),
+			want: want{
+				azs: map[string]string{
+					"subnet-code-0-private-0": "us-east-1d",
+					"subnet-code-0-private-1": "us-east-1b",
+					"subnet-code-0-private-2": "us-east-1c",
+					"subnet-code-0-private-3": "us-east-1a",
+				},
+			},
+		},
+		"Zero": {
+			reason: "A cap below one should return a fatal result",
+			xr:     xr("0"),
+			want: want{
+				azs:     map[string]string{},
+				results: []string{"invalid network config: spec.maxAzs: must be at least 1, got 0"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.azs, desiredStrings(t, rsp, "spec.forProvider.availabilityZone")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want availability zones, +got availability zones:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionMaxSubnetsPerAZ(t *testing.T) {
+	xr := func(maxSubnets string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"region": "us-east-1",
+				"publicSubnets": true,
+				"privateSubnets": true,
+				"availabilityZones": ["us-east-1a", "us-east-1b"],
+				"maxSubnetsPerAz": ` + maxSubnets + `
+			}
+		}`
+	}
+
+	type want struct {
+		subnets int
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"WithinCap": {
+			reason: "Public and private subnets in each availability zone should be created when the cap allows both",
+			xr:     xr("2"),
+			want: want{
+				subnets: 4,
+			},
+		},
+		"OverCap": {
+			reason: "Public and private subnets in each availability zone should return a fatal result when the cap allows only one",
+			xr:     xr("1"),
+			want: want{
+				results: []string{"invalid network config: spec.maxSubnetsPerAz: would create 2 subnets in each availability zone (public, private), more than 1"},
+			},
+		},
+		"Zero": {
+			reason: "A cap below one should return a fatal result",
+			xr:     xr("0"),
+			want: want{
+				results: []string{"invalid network config: spec.maxSubnetsPerAz: must be at least 1, got 0"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.subnets, len(desiredStrings(t, rsp, "spec.forProvider.availabilityZone"))); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want subnets, +got subnets:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionLabelFallback(t *testing.T) {
+	type want struct {
+		regions map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"LabelsOnly": {
+			reason: "The count and region should be read from the XR's labels when unset in its spec",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {
+					"name": "network-code",
+					"labels": {
+						"networks.meta.fn.crossplane.io/count": "2",
+						"networks.meta.fn.crossplane.io/region": "us-west-2"
+					}
+				},
+				"spec": {"id": "code"}
+			}`,
+			want: want{
+				regions: map[string]string{
+					"vpc-code-0": "us-west-2",
+					"vpc-code-1": "us-west-2",
+				},
+			},
+		},
+		"SpecWins": {
+			reason: "The spec's count and region should take precedence over the XR's labels",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {
+					"name": "network-code",
+					"labels": {
+						"networks.meta.fn.crossplane.io/count": "2",
+						"networks.meta.fn.crossplane.io/region": "us-west-2"
+					}
+				},
+				"spec": {"id": "code", "count": 1, "region": "eu-west-1"}
+			}`,
+			want: want{
+				regions: map[string]string{
+					"vpc-code-0": "eu-west-1",
+				},
+			},
+		},
+		"ZeroCountInSpec": {
+			reason: "An explicit zero count in the spec should take precedence over the XR's labels",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {
+					"name": "network-code",
+					"labels": {"networks.meta.fn.crossplane.io/count": "2"}
+				},
+				"spec": {"id": "code", "count": 0}
+			}`,
+			want: want{
+				regions: map[string]string{},
+			},
+		},
+		"InvalidCountLabel": {
+			reason: "A count label that isn't an integer should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {
+					"name": "network-code",
+					"labels": {"networks.meta.fn.crossplane.io/count": "two"}
+				},
+				"spec": {"id": "code"}
+			}`,
+			want: want{
+				regions: map[string]string{},
+				results: []string{`invalid network config: metadata.labels[networks.meta.fn.crossplane.io/count]: strconv.ParseInt: parsing "two": invalid syntax`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.regions, desiredStrings(t, rsp, "spec.forProvider.region")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want regions, +got regions:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionBuildErrors(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	// failOn returns a builder that fails to build managed resources of the
+	// supplied type, and builds all others as usual.
+	failOn := func(o runtime.Object) ComposedBuilder {
+		return ComposedBuilderFn(func(mr runtime.Object) (*composed.Unstructured, error) {
+			if fmt.Sprintf("%T", mr) == fmt.Sprintf("%T", o) {
+				return nil, errBoom
+			}
+			return composed.From(mr)
+		})
+	}
+
+	xr := `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {
+			"id": "code",
+			"count": 1,
+			"includeGateway": true,
+			"privateSubnets": true,
+			"availabilityZones": ["eu-central-1a", "eu-central-1b"],
+			"createDbSubnetGroup": true,
+			"region": "eu-central-1",
+			"cidrBlock": "192.168.0.0/16",
+			"providerConfigName": "default",
+			"strict": %t
+		}
+	}`
+
+	cases := map[string]struct {
+		reason  string
+		builder ComposedBuilder
+		strict  bool
+		want    []string
+	}{
+		"VPC": {
+			reason:  "A VPC that can't be built should return a fatal result",
+			builder: failOn(&awsv1beta1.VPC{}),
+			want:    []string{`cannot convert VPC "vpc-code-0" to *composed.Unstructured: boom`},
+		},
+		"InternetGateway": {
+			reason:  "An InternetGateway that can't be built should return a fatal result",
+			builder: failOn(&awsv1beta1.InternetGateway{}),
+			want:    []string{`cannot convert InternetGateway "gateway-code-0" to *composed.Unstructured: boom`},
+		},
+		"Subnet": {
+			reason:  "Every Subnet that can't be built should be reported in a single fatal result",
+			builder: failOn(&awsv1beta1.Subnet{}),
+			want: []string{"[" +
+				`cannot convert Subnet "subnet-code-0-private-0" to *composed.Unstructured: boom, ` +
+				`cannot convert Subnet "subnet-code-0-private-1" to *composed.Unstructured: boom` +
+				"]"},
+		},
+		"StrictSubnet": {
+			reason:  "In strict mode the first Subnet that can't be built should return a fatal result",
+			builder: failOn(&awsv1beta1.Subnet{}),
+			strict:  true,
+			want:    []string{`cannot convert Subnet "subnet-code-0-private-0" to *composed.Unstructured: boom`},
+		},
+		"DBSubnetGroup": {
+			reason:  "A DB subnet group that can't be built should return a fatal result",
+			builder: failOn(&rdsv1beta1.SubnetGroup{}),
+			want:    []string{`cannot convert SubnetGroup "dbsubnetgroup-code-0" to *composed.Unstructured: boom`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), builder: tc.builder}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(fmt.Sprintf(xr, tc.strict))}},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if got := rsp.GetResults()[len(rsp.GetResults())-1].GetSeverity(); got != fnv1.Severity_SEVERITY_FATAL {
+				t.Errorf("%s\nf.RunFunction(...): want a fatal result, got %s", tc.reason, got)
+			}
+			if got := rsp.GetDesired().GetResources(); len(got) != 0 {
+				t.Errorf("%s\nf.RunFunction(...): want no desired resources, got %d", tc.reason, len(got))
+			}
+		})
+	}
+}
+
+func TestAddDesired(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		mr     runtime.Object
+		want   string
+	}{
+		"Registered": {
+			reason: "A registered managed resource should be added without error",
+			mr:     &awsv1beta1.VPC{},
+		},
+		"Unregistered": {
+			reason: "A conversion error should name the resource that failed and its kind",
+			mr:     &unregistered{},
+			want:   `cannot convert *main.unregistered "vpc-code-0" to *composed.Unstructured`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			desired := map[resource.Name]*resource.DesiredComposed{}
+			err := f.addDesired(desired, "vpc-code-0", tc.mr)
+
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("%s\nf.addDesired(...): unexpected error: %v", tc.reason, err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+				t.Errorf("%s\nf.addDesired(...): want error starting %q, got %v", tc.reason, tc.want, err)
+			}
+		})
+	}
+}
+
+// unregistered is a managed resource whose type isn't registered with the
+// scheme composed.From uses.
+type unregistered struct {
+	awsv1beta1.VPC
+}
+
+func TestRunFunctionRegionFromProviderConfig(t *testing.T) {
+	input := `{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"providerConfigRegion": {
+			"pattern": "^aws-([a-z0-9-]+)$",
+			"regions": {"euc1": "eu-central-1", "usw2": "us-west-2"}
+		}
+	}`
+
+	type want struct {
+		regions map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		input  string
+		xr     string
+		want   want
+	}{
+		"InferredAlias": {
+			reason: "The region should be looked up from the provider config name's captured short code",
+			input:  input,
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 1, "providerConfigName": "aws-euc1"}
+			}`,
+			want: want{regions: map[string]string{"vpc-code-0": "eu-central-1"}},
+		},
+		"InferredAsIs": {
+			reason: "A captured value that isn't a known short code should be used as the region",
+			input:  input,
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 1, "providerConfigName": "aws-ap-southeast-2"}
+			}`,
+			want: want{regions: map[string]string{"vpc-code-0": "ap-southeast-2"}},
+		},
+		"ExplicitRegionWins": {
+			reason: "An explicit spec.region should take precedence over the inferred region",
+			input:  input,
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 1, "providerConfigName": "aws-euc1", "region": "us-east-1"}
+			}`,
+			want: want{regions: map[string]string{"vpc-code-0": "us-east-1"}},
+		},
+		"NoMatch": {
+			reason: "A provider config name that doesn't follow the convention should get the default region",
+			input:  input,
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 1, "providerConfigName": "default"}
+			}`,
+			want: want{regions: map[string]string{"vpc-code-0": config.DefaultRegion}},
+		},
+		"NoCaptureGroup": {
+			reason: "A pattern without a capture group should return a fatal result",
+			input: `{
+				"apiVersion": "networks.fn.crossplane.io/v1beta1",
+				"kind": "Input",
+				"providerConfigRegion": {"pattern": "^aws-.+$"}
+			}`,
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 1, "providerConfigName": "aws-euc1"}
+			}`,
+			want: want{
+				regions: map[string]string{},
+				results: []string{`invalid network config: cannot infer region from provider config: pattern "^aws-.+$" has no capture group`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input:    resource.MustStructJSON(tc.input),
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.regions, desiredStrings(t, rsp, "spec.forProvider.region")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want regions, +got regions:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Config{Config: config.Config{ID: "code", Count: 2, CIDRBlock: config.DefaultCIDRBlock}}
+
+	cases := map[string]struct {
+		reason string
+		cfg    func(c Config) Config
+		want   string
+	}{
+		"Valid": {
+			reason: "A valid config should not return an error",
+			cfg:    func(c Config) Config { return c },
+		},
+		"CIDRBlock": {
+			reason: "A VPC CIDR block that isn't IPv4 should be reported against spec.cidrBlock",
+			cfg:    func(c Config) Config { c.CIDRBlock = "2001:db8::/56"; return c },
+			want:   "spec.cidrBlock",
+		},
+		"CIDRBlockTooLarge": {
+			reason: "A VPC CIDR block larger than the /16 AWS allows should be reported against spec.cidrBlock",
+			cfg:    func(c Config) Config { c.CIDRBlock = "10.0.0.0/8"; return c },
+			want:   "spec.cidrBlock",
+		},
+		"CIDRBlockLargerThanLimit": {
+			reason: "A CIDR block larger than the input allows should be reported against spec.cidrBlock, even when it's divided",
+			cfg: func(c Config) Config {
+				c.CIDRBlock, c.DivideCIDRBlock, c.MinCIDRPrefixLength = "10.0.0.0/8", true, 16
+				return c
+			},
+			want: "spec.cidrBlock",
+		},
+		"DividedCIDRBlock": {
+			reason: "A CIDR block larger than /16 is fine when it's divided among the VPCs",
+			cfg:    func(c Config) Config { c.CIDRBlock, c.DivideCIDRBlock = "10.0.0.0/8", true; return c },
+		},
+		"SubnetsDontFit": {
+			reason: "A VPC CIDR block too small for its subnets should be reported against spec.cidrBlock",
+			cfg: func(c Config) Config {
+				c.CIDRBlock, c.PublicSubnets = "10.0.0.0/26", true
+				c.AvailabilityZones = []string{"eu-central-1a"}
+				return c
+			},
+			want: "spec.cidrBlock",
+		},
+		"DividedSubnetsDontFit": {
+			reason: "Subnets that don't fit each VPC's share of a divided CIDR block should be reported against spec.cidrBlock",
+			cfg: func(c Config) Config {
+				c.CIDRBlock, c.DivideCIDRBlock, c.Count = "10.0.0.0/20", true, 4
+				c.PublicSubnets, c.PrivateSubnets = true, true
+				c.AvailabilityZones = []string{"eu-central-1a", "eu-central-1b", "eu-central-1c"}
+				return c
+			},
+			want: "spec.cidrBlock",
+		},
+		"IPAMNetmask": {
+			reason: "An IPAM allocation that's too large should be reported against spec.ipv4NetmaskLength",
+			cfg: func(c Config) Config {
+				c.CIDRBlock, c.IPv4IPAMPoolID, c.IPv4NetmaskLength = "", "ipam-pool-0123", 8
+				return c
+			},
+			want: "spec.ipv4NetmaskLength",
+		},
+		"SubnetTags": {
+			reason: "A reserved tag key should be reported against the field it was set in",
+			cfg:    func(c Config) Config { c.PrivateSubnetTags = map[string]string{"aws:team": "net"}; return c },
+			want:   "spec.privateSubnetTags",
+		},
+		"PrimaryVPCIndex": {
+			reason: "A primary VPC index beyond the count should be reported against spec.primaryVpcIndex",
+			cfg:    func(c Config) Config { c.PrimaryVPCIndex = 2; return c },
+			want:   "spec.primaryVpcIndex",
+		},
+		"PrefixList": {
+			reason: "An invalid prefix list should be reported against spec.prefixList",
+			cfg:    func(c Config) Config { c.PrefixList = &config.PrefixList{Name: "corp"}; return c },
+			want:   "spec.prefixList",
+		},
+		"IPv6Subnets": {
+			reason: "More subnets per VPC than a /56 has /64s should be reported against spec.availabilityZones",
+			cfg: func(c Config) Config {
+				c.EnableIPv6, c.PublicSubnets, c.PrivateSubnets = true, true, true
+				for i := range 129 {
+					c.AvailabilityZones = append(c.AvailabilityZones, fmt.Sprintf("az-%d", i))
+				}
+				return c
+			},
+			want: "spec.availabilityZones",
+		},
+		"VPCIDLabelsHugeCount": {
+			reason: "A vpc-id label override that clashes with a default label should be found without visiting every VPC",
+			cfg: func(c Config) Config {
+				c.Count, c.VPCIDLabels = 1000000000000, map[int64]string{0: "vpc-code-999999999999"}
+				return c
+			},
+			want: "spec.vpcIdLabels[0]",
+		},
+		"DBSubnetGroup": {
+			reason: "A DB subnet group without private subnets should be reported against spec.createDbSubnetGroup",
+			cfg:    func(c Config) Config { c.CreateDBSubnetGroup = true; return c },
+			want:   "spec.createDbSubnetGroup",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg(valid).validate()
+
+			var verr *ValidationError
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("%s\nvalidate(): unexpected error: %v", tc.reason, err)
+				}
+				return
+			}
+			if !errors.As(err, &verr) {
+				t.Fatalf("%s\nvalidate(): want *ValidationError, got %T: %v", tc.reason, err, err)
+			}
+			if diff := cmp.Diff(tc.want, verr.Field); diff != "" {
+				t.Errorf("%s\nvalidate(): -want field, +got field:\n%s", tc.reason, diff)
+			}
+			if verr.Reason == "" {
+				t.Errorf("%s\nvalidate(): want a reason, got none", tc.reason)
+			}
+		})
+	}
+}
+
+func TestRunFunctionDivideCIDRBlock(t *testing.T) {
+	type want struct {
+		cidrs   map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"FourVPCs": {
+			reason: "A /16 should be divided into a /18 for each of four VPCs, with subnets carved from each",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 4,
+					"cidrBlock": "10.0.0.0/16",
+					"divideCidrBlock": true,
+					"availabilityZones": ["eu-central-1a"],
+					"privateSubnets": true
+				}
+			}`,
+			want: want{
+				cidrs: map[string]string{
+					"vpc-code-0":              "10.0.0.0/18",
+					"vpc-code-1":              "10.0.64.0/18",
+					"vpc-code-2":              "10.0.128.0/18",
+					"vpc-code-3":              "10.0.192.0/18",
+					"subnet-code-0-private-0": "10.0.0.0/24",
+					"subnet-code-1-private-0": "10.0.64.0/24",
+					"subnet-code-2-private-0": "10.0.128.0/24",
+					"subnet-code-3-private-0": "10.0.192.0/24",
+				},
+			},
+		},
+		"TooSmall": {
+			reason: "A block too small to divide among the VPCs should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 32,
+					"cidrBlock": "10.0.0.0/24",
+					"divideCidrBlock": true
+				}
+			}`,
+			want: want{
+				cidrs:   map[string]string{},
+				results: []string{`invalid network config: spec.cidrBlock: CIDR block "10.0.0.0/24" is too small to divide among 32 VPCs`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.cidrs, desiredStrings(t, rsp, "spec.forProvider.cidrBlock")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want CIDR blocks, +got CIDR blocks:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionMinCIDRPrefixLength(t *testing.T) {
+	xr := func(cidr string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 2,
+				"cidrBlock": "` + cidr + `",
+				"divideCidrBlock": true
+			}
+		}`
+	}
+
+	type want struct {
+		vpcs    int
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		input  string
+		xr     string
+		want   want
+	}{
+		"AllowedByDefault": {
+			reason: "A /16 should be allowed without any input",
+			xr:     xr("10.0.0.0/16"),
+			want:   want{vpcs: 2},
+		},
+		"TooLargeByDefault": {
+			reason: "A block larger than /16 should return a fatal result without any input",
+			xr:     xr("10.0.0.0/8"),
+			want: want{
+				results: []string{`invalid network config: spec.cidrBlock: CIDR block "10.0.0.0/8" is larger than /16, the largest the Function input allows`},
+			},
+		},
+		"AllowedByInput": {
+			reason: "A block larger than /16 should be allowed when the input lowers the limit",
+			input:  `{"apiVersion": "networks.fn.crossplane.io/v1beta1", "kind": "Input", "minCidrPrefixLength": 8}`,
+			xr:     xr("10.0.0.0/8"),
+			want:   want{vpcs: 2},
+		},
+		"TooLargeForInput": {
+			reason: "A block larger than the input's limit should return a fatal result",
+			input:  `{"apiVersion": "networks.fn.crossplane.io/v1beta1", "kind": "Input", "minCidrPrefixLength": 12}`,
+			xr:     xr("10.0.0.0/8"),
+			want: want{
+				results: []string{`invalid network config: spec.cidrBlock: CIDR block "10.0.0.0/8" is larger than /12, the largest the Function input allows`},
+			},
+		},
+		"InvalidInput": {
+			reason: "A limit that isn't a valid prefix length should return a fatal result",
+			input:  `{"apiVersion": "networks.fn.crossplane.io/v1beta1", "kind": "Input", "minCidrPrefixLength": 0}`,
+			xr:     xr("10.0.0.0/16"),
+			want: want{
+				results: []string{"invalid Function input: minCidrPrefixLength must be between 1 and 28, got 0"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			if tc.input != "" {
+				req.Input = resource.MustStructJSON(tc.input)
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.vpcs, len(rsp.GetDesired().GetResources())); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want VPCs, +got VPCs:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionAWSAPIVersion(t *testing.T) {
+	xr := `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {
+			"id": "code",
+			"count": 1,
+			"includeGateway": true,
+			"region": "us-east-1",
+			"publicSubnets": true,
+			"availabilityZones": ["us-east-1a"],
+			"s3GatewayEndpoint": true
+		}
+	}`
+
+	type want struct {
+		apiVersions  map[string]string
+		destinations map[string]string
+		results      []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		input  string
+		want   want
+	}{
+		"Default": {
+			reason: "Resources should be composed at v1beta1 without any input",
+			want: want{
+				apiVersions: map[string]string{
+					"vpc-code-0":                     "ec2.aws.upbound.io/v1beta1",
+					"gateway-code-0":                 "ec2.aws.upbound.io/v1beta1",
+					"subnet-code-0-public-0":         "ec2.aws.upbound.io/v1beta1",
+					"routetable-code-0-public":       "ec2.aws.upbound.io/v1beta1",
+					"rtassoc-subnet-code-0-public-0": "ec2.aws.upbound.io/v1beta1",
+					"route-code-0-public-0":          "ec2.aws.upbound.io/v1beta1",
+					"s3endpoint-code-0":              "ec2.aws.upbound.io/v1beta1",
+					"s3endpoint-code-0-public":       "ec2.aws.upbound.io/v1beta1",
+				},
+				destinations: map[string]string{"route-code-0-public-0": "0.0.0.0/0"},
+			},
+		},
+		"Pinned": {
+			reason: "Resources should be composed at a supported version the input pins",
+			input:  `{"apiVersion": "networks.fn.crossplane.io/v1beta1", "kind": "Input", "awsApiVersion": "v1beta1"}`,
+			want: want{
+				apiVersions: map[string]string{
+					"vpc-code-0":                     "ec2.aws.upbound.io/v1beta1",
+					"gateway-code-0":                 "ec2.aws.upbound.io/v1beta1",
+					"subnet-code-0-public-0":         "ec2.aws.upbound.io/v1beta1",
+					"routetable-code-0-public":       "ec2.aws.upbound.io/v1beta1",
+					"rtassoc-subnet-code-0-public-0": "ec2.aws.upbound.io/v1beta1",
+					"route-code-0-public-0":          "ec2.aws.upbound.io/v1beta1",
+					"s3endpoint-code-0":              "ec2.aws.upbound.io/v1beta1",
+					"s3endpoint-code-0-public":       "ec2.aws.upbound.io/v1beta1",
+				},
+				destinations: map[string]string{"route-code-0-public-0": "0.0.0.0/0"},
+			},
+		},
+		"Alternate": {
+			reason: "Routes and VPCEndpoints should be composed at v1beta2 when the input pins it, and kinds that exist only at v1beta1 at v1beta1",
+			input:  `{"apiVersion": "networks.fn.crossplane.io/v1beta1", "kind": "Input", "awsApiVersion": "v1beta2"}`,
+			want: want{
+				apiVersions: map[string]string{
+					"vpc-code-0":                     "ec2.aws.upbound.io/v1beta1",
+					"gateway-code-0":                 "ec2.aws.upbound.io/v1beta1",
+					"subnet-code-0-public-0":         "ec2.aws.upbound.io/v1beta1",
+					"routetable-code-0-public":       "ec2.aws.upbound.io/v1beta1",
+					"rtassoc-subnet-code-0-public-0": "ec2.aws.upbound.io/v1beta1",
+					"route-code-0-public-0":          "ec2.aws.upbound.io/v1beta2",
+					"s3endpoint-code-0":              "ec2.aws.upbound.io/v1beta2",
+					"s3endpoint-code-0-public":       "ec2.aws.upbound.io/v1beta1",
+				},
+				destinations: map[string]string{"route-code-0-public-0": "0.0.0.0/0"},
+			},
+		},
+		"Unsupported": {
+			reason: "A version the Function isn't built with should return a fatal result",
+			input:  `{"apiVersion": "networks.fn.crossplane.io/v1beta1", "kind": "Input", "awsApiVersion": "v1beta3"}`,
+			want: want{
+				apiVersions:  map[string]string{},
+				destinations: map[string]string{},
+				results:      []string{`invalid Function input: awsApiVersion "v1beta3" is not supported; must be one of v1beta1, v1beta2`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)}},
+			}
+			if tc.input != "" {
+				req.Input = resource.MustStructJSON(tc.input)
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.apiVersions, desiredStrings(t, rsp, "apiVersion")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want apiVersions, +got apiVersions:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.destinations, desiredStrings(t, rsp, "spec.forProvider.destinationCidrBlock")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want route destinations, +got route destinations:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionRegionCIDRDefaults(t *testing.T) {
+	input := `{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"regionCidrDefaults": {"eu-central-1": "10.20.0.0/16", "us-east-1": "10.30.0.0/16"}
+	}`
+	xr := func(spec string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "code", "count": 1, ` + spec + `}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   map[string]string
+	}{
+		"ConfiguredRegion": {
+			reason: "A VPC in a region with a configured default should use the region's CIDR block",
+			xr:     xr(`"region": "us-east-1"`),
+			want:   map[string]string{"vpc-code-0": "10.30.0.0/16"},
+		},
+		"DefaultRegion": {
+			reason: "The defaulted region should be looked up too",
+			xr:     xr(`"providerConfigName": "default"`),
+			want:   map[string]string{"vpc-code-0": "10.20.0.0/16"},
+		},
+		"UnconfiguredRegion": {
+			reason: "A VPC in a region without a configured default should use the global default",
+			xr:     xr(`"region": "ap-south-1"`),
+			want:   map[string]string{"vpc-code-0": config.DefaultCIDRBlock},
+		},
+		"ExplicitCIDRBlock": {
+			reason: "A VPC's own CIDR block should take precedence over its region's default",
+			xr:     xr(`"region": "us-east-1", "cidrBlock": "172.16.0.0/16"`),
+			want:   map[string]string{"vpc-code-0": "172.16.0.0/16"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input:    resource.MustStructJSON(input),
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, desiredStrings(t, rsp, "spec.forProvider.cidrBlock")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want cidrBlock, +got cidrBlock:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionDisableManagedLabels(t *testing.T) {
+	type want struct {
+		networkIDs map[string]string
+		vpcRefs    map[string]string
+		subnetRefs map[string]string
+		results    []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"NameReferences": {
+			reason: "Without managed labels no resource should be labelled, and resources should reference each other by name",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"includeGateway": true,
+					"availabilityZones": ["eu-central-1a", "eu-central-1b"],
+					"privateSubnets": true,
+					"createDbSubnetGroup": true,
+					"disableManagedLabels": true
+				}
+			}`,
+			want: want{
+				networkIDs: map[string]string{},
+				vpcRefs: map[string]string{
+					"gateway-code-0":          "vpc-code-0",
+					"subnet-code-0-private-0": "vpc-code-0",
+					"subnet-code-0-private-1": "vpc-code-0",
+				},
+				subnetRefs: map[string]string{
+					"dbsubnetgroup-code-0": "subnet-code-0-private-0",
+				},
+			},
+		},
+		"GatewaySelector": {
+			reason: "Asking for the gateway to select its VPC by label without managed labels should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"includeGateway": true,
+					"gatewayRefByName": false,
+					"disableManagedLabels": true
+				}
+			}`,
+			want: want{
+				networkIDs: map[string]string{},
+				vpcRefs:    map[string]string{},
+				subnetRefs: map[string]string{},
+				results:    []string{"invalid network config: spec.gatewayRefByName: must be true when spec.disableManagedLabels is set"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.networkIDs, desiredStrings(t, rsp, "metadata.labels[networks.meta.fn.crossplane.io/network-id]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want network-id labels, +got network-id labels:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.vpcRefs, desiredStrings(t, rsp, "spec.forProvider.vpcIdRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want VPC references, +got VPC references:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.subnetRefs, desiredStrings(t, rsp, "spec.forProvider.subnetIdRefs[0].name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want subnet references, +got subnet references:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionVPCIDLabels(t *testing.T) {
+	type want struct {
+		labels    map[string]string
+		selectors map[string]string
+		results   []string
+	}
+
+	xr := func(labels string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 2,
+				"includeGateway": true,
+				"vpcIdLabels": ` + labels + `
+			}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Override": {
+			reason: "A VPC with an overridden vpc-id label should carry it, and its gateway should select it",
+			xr:     xr(`{"1": "ext-vpc-123"}`),
+			want: want{
+				labels: map[string]string{
+					"vpc-code-0": "vpc-code-0",
+					"vpc-code-1": "ext-vpc-123",
+				},
+				selectors: map[string]string{
+					"gateway-code-0": "vpc-code-0",
+					"gateway-code-1": "ext-vpc-123",
+				},
+			},
+		},
+		"InvalidValue": {
+			reason: "A vpc-id label override that isn't a valid label value should return a fatal result",
+			xr:     xr(`{"0": "not a label"}`),
+			want: want{
+				labels:    map[string]string{},
+				selectors: map[string]string{},
+				results:   []string{`invalid network config: spec.vpcIdLabels[0]: "not a label" is not a valid label value`},
+			},
+		},
+		"OutOfRange": {
+			reason: "A vpc-id label override for a VPC that isn't composed should return a fatal result",
+			xr:     xr(`{"2": "ext-vpc-123"}`),
+			want: want{
+				labels:    map[string]string{},
+				selectors: map[string]string{},
+				results:   []string{"invalid network config: spec.vpcIdLabels[2]: 2 is out of range for spec.count 2"},
+			},
+		},
+		"NotAnIndex": {
+			reason: "A vpc-id label override keyed by something other than a VPC index should return a fatal result",
+			xr:     xr(`{"first": "ext-vpc-123"}`),
+			want: want{
+				labels:    map[string]string{},
+				selectors: map[string]string{},
+				results:   []string{"invalid network config: spec.vpcIdLabels[first]: keys must be VPC indexes"},
+			},
+		},
+		"Duplicate": {
+			reason: "A vpc-id label override that clashes with another VPC's label should return a fatal result",
+			xr:     xr(`{"1": "vpc-code-0"}`),
+			want: want{
+				labels:    map[string]string{},
+				selectors: map[string]string{},
+				results:   []string{`invalid network config: spec.vpcIdLabels[1]: "vpc-code-0" is already the vpc-id label of VPC 0`},
+			},
+		},
+		"SwappedDefaults": {
+			reason: "VPCs may take each other's default vpc-id labels when both are overridden",
+			xr:     xr(`{"0": "vpc-code-1", "1": "vpc-code-0"}`),
+			want: want{
+				labels: map[string]string{
+					"vpc-code-0": "vpc-code-1",
+					"vpc-code-1": "vpc-code-0",
+				},
+				selectors: map[string]string{
+					"gateway-code-0": "vpc-code-1",
+					"gateway-code-1": "vpc-code-0",
+				},
+			},
+		},
+		"OverridesClash": {
+			reason: "Two vpc-id label overrides with the same value should return a fatal result",
+			xr:     xr(`{"0": "ext-vpc-123", "1": "ext-vpc-123"}`),
+			want: want{
+				labels:    map[string]string{},
+				selectors: map[string]string{},
+				results:   []string{`invalid network config: spec.vpcIdLabels[1]: "ext-vpc-123" is already the vpc-id label of VPC 0`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.labels, desiredStrings(t, rsp, "metadata.labels[networks.meta.fn.crossplane.io/vpc-id]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want vpc-id labels, +got vpc-id labels:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.selectors, desiredStrings(t, rsp, "spec.forProvider.vpcIdSelector.matchLabels[networks.meta.fn.crossplane.io/vpc-id]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want VPC selectors, +got VPC selectors:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionCIDRAnnotation(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		xr     string
+	}{
+		"VPCsAndSubnets": {
+			reason: "Each VPC and subnet should be annotated with the CIDR block it's composed with",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 2,
+					"cidrBlock": "10.0.0.0/16",
+					"divideCidrBlock": true,
+					"availabilityZones": ["eu-central-1a", "eu-central-1b"],
+					"publicSubnets": true,
+					"privateSubnets": true
+				}
+			}`,
+		},
+		"IPAM": {
+			reason: "A VPC allocated from an IPAM pool has no CIDR block to annotate",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"ipv4IpamPoolId": "ipam-pool-0123456789abcdef0",
+					"ipv4NetmaskLength": 20
+				}
+			}`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			want := desiredStrings(t, rsp, "spec.forProvider.cidrBlock")
+			got := desiredStrings(t, rsp, "metadata.annotations[networks.meta.fn.crossplane.io/cidr]")
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want CIDR blocks, +got CIDR annotations:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionObservedXR(t *testing.T) {
+	allowMissing := resource.MustStructJSON(`{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"allowMissingXr": true
+	}`)
+
+	type want struct {
+		results  []string
+		severity fnv1.Severity
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *fnv1.RunFunctionRequest
+		want   want
+	}{
+		"Missing": {
+			reason: "A request without an observed XR should return a fatal result by default",
+			req:    &fnv1.RunFunctionRequest{},
+			want: want{
+				results:  []string{"cannot get observed XR: request has no observed composite resource"},
+				severity: fnv1.Severity_SEVERITY_FATAL,
+			},
+		},
+		"MissingAllowed": {
+			reason: "A request without an observed XR should compose nothing, without a fatal result, when the input allows it",
+			req:    &fnv1.RunFunctionRequest{Input: allowMissing},
+			want: want{
+				results:  []string{"There is no observed XR yet, so no resources were composed"},
+				severity: fnv1.Severity_SEVERITY_NORMAL,
+			},
+		},
+		"EmptyAllowed": {
+			reason: "An observed XR that's an empty object, as an initial render may send, should be treated as missing",
+			req: &fnv1.RunFunctionRequest{
+				Input:    allowMissing,
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{}`)}},
+			},
+			want: want{
+				results:  []string{"There is no observed XR yet, so no resources were composed"},
+				severity: fnv1.Severity_SEVERITY_NORMAL,
+			},
+		},
+		"PresentWithoutID": {
+			reason: "An observed XR without an ID isn't missing, so it should return a fatal result even when the input allows a missing XR",
+			req: &fnv1.RunFunctionRequest{
+				Input: allowMissing,
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+					"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+					"kind": "XNetwork",
+					"metadata": {"name": "network-code"},
+					"spec": {"count": 1}
+				}`)}},
+			},
+			want: want{
+				results:  []string{"invalid network config: spec.id: must be set"},
+				severity: fnv1.Severity_SEVERITY_FATAL,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			rsp, err := f.RunFunction(context.Background(), tc.req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if got := rsp.GetResults()[len(rsp.GetResults())-1].GetSeverity(); got != tc.want.severity {
+				t.Errorf("%s\nf.RunFunction(...): want a %s result, got %s", tc.reason, tc.want.severity, got)
+			}
+			if got := rsp.GetDesired().GetResources(); len(got) != 0 {
+				t.Errorf("%s\nf.RunFunction(...): want no desired resources, got %d", tc.reason, len(got))
+			}
+		})
+	}
+}
+
+func TestRunFunctionGenerateName(t *testing.T) {
+	type want struct {
+		generateNames map[string]string
+		names         map[string]string
+		selectors     map[string]string
+		results       []string
+	}
+
+	xr := func(spec string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"includeGateway": true,
+				"useGenerateName": true` + spec + `
+			}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"GenerateName": {
+			reason: "Resources should have a generateName prefix instead of a name, and the gateway should select its VPC by label",
+			xr:     xr(`, "privateSubnets": true, "availabilityZones": ["eu-central-1a"]`),
+			want: want{
+				generateNames: map[string]string{
+					"vpc-code-0":              "vpc-code-0-",
+					"gateway-code-0":          "gateway-code-0-",
+					"subnet-code-0-private-0": "subnet-code-0-private-0-",
+				},
+				names: map[string]string{},
+				selectors: map[string]string{
+					"gateway-code-0":          "vpc-code-0",
+					"subnet-code-0-private-0": "vpc-code-0",
+				},
+			},
+		},
+		"GatewayRefByName": {
+			reason: "A gateway can't reference a VPC whose name is generated",
+			xr:     xr(`, "gatewayRefByName": true`),
+			want: want{
+				generateNames: map[string]string{},
+				names:         map[string]string{},
+				selectors:     map[string]string{},
+				results:       []string{"invalid network config: spec.useGenerateName: cannot be combined with spec.gatewayRefByName, since gateways must select their VPC by label"},
+			},
+		},
+		"DisableManagedLabels": {
+			reason: "Resources can't select each other without managed labels, nor reference generated names",
+			xr:     xr(`, "disableManagedLabels": true`),
+			want: want{
+				generateNames: map[string]string{},
+				names:         map[string]string{},
+				selectors:     map[string]string{},
+				results:       []string{"invalid network config: spec.useGenerateName: cannot be combined with spec.disableManagedLabels, since resources must select each other by label"},
+			},
+		},
+		"PublicRoutes": {
+			reason: "Routes can't reference a gateway and route table whose names are generated",
+			xr:     xr(`, "publicSubnets": true, "availabilityZones": ["eu-central-1a"]`),
+			want: want{
+				generateNames: map[string]string{},
+				names:         map[string]string{},
+				selectors:     map[string]string{},
+				results:       []string{"invalid network config: spec.useGenerateName: cannot be combined with public subnets and an InternetGateway, since their routes reference the gateway and route table by name"},
+			},
+		},
+		"NetworkFirewall": {
+			reason: "A firewall can't reference a policy and subnets whose names are generated",
+			xr:     xr(`, "firewallSubnets": true, "enableNetworkFirewall": true, "availabilityZones": ["eu-central-1a"]`),
+			want: want{
+				generateNames: map[string]string{},
+				names:         map[string]string{},
+				selectors:     map[string]string{},
+				results:       []string{"invalid network config: spec.useGenerateName: cannot be combined with spec.enableNetworkFirewall, since the firewall references its policy and subnets, and the policy its rule group, by name"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.generateNames, desiredStrings(t, rsp, "metadata.generateName")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want generateNames, +got generateNames:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.names, desiredStrings(t, rsp, "metadata.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want names, +got names:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.selectors, desiredStrings(t, rsp, "spec.forProvider.vpcIdSelector.matchLabels[networks.meta.fn.crossplane.io/vpc-id]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want VPC selectors, +got VPC selectors:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionOwnerReferences(t *testing.T) {
+	type want struct {
+		refs    map[string][]metav1.OwnerReference
+		results []string
+	}
+
+	xr := func(metadata string, set bool) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": ` + metadata + `,
+			"spec": {"id": "code", "count": 1, "includeGateway": true, "setOwnerReferences": ` + strconv.FormatBool(set) + `}
+		}`
+	}
+	ref := metav1.OwnerReference{
+		APIVersion:         "xp-layers.crossplane.io/v1alpha1",
+		Kind:               "XNetwork",
+		Name:               "network-code",
+		UID:                "2b4a6e8c-0d1f-4e3a-9b5c-7d6e8f9a0b1c",
+		BlockOwnerDeletion: ptr.To(true),
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Set": {
+			reason: "Every composed resource should be owned by the XR",
+			xr:     xr(`{"name": "network-code", "uid": "2b4a6e8c-0d1f-4e3a-9b5c-7d6e8f9a0b1c"}`, true),
+			want: want{
+				refs: map[string][]metav1.OwnerReference{
+					"vpc-code-0":     {ref},
+					"gateway-code-0": {ref},
+				},
+			},
+		},
+		"Unset": {
+			reason: "Composed resources should have no owner references by default",
+			xr:     xr(`{"name": "network-code", "uid": "2b4a6e8c-0d1f-4e3a-9b5c-7d6e8f9a0b1c"}`, false),
+			want: want{
+				refs: map[string][]metav1.OwnerReference{
+					"vpc-code-0":     nil,
+					"gateway-code-0": nil,
+				},
+			},
+		},
+		"NoUID": {
+			reason: "An XR without a UID can't own anything, so asking for owner references should return a fatal result",
+			xr:     xr(`{"name": "network-code"}`, true),
+			want: want{
+				refs:    map[string][]metav1.OwnerReference{},
+				results: []string{"invalid network config: metadata.uid: must be set when spec.setOwnerReferences is true"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			desired, err := request.GetDesiredComposedResources(&fnv1.RunFunctionRequest{Desired: rsp.GetDesired()})
+			if err != nil {
+				t.Fatalf("request.GetDesiredComposedResources(...): unexpected error: %v", err)
+			}
+			got := map[string][]metav1.OwnerReference{}
+			for name, dc := range desired {
+				got[string(name)] = dc.Resource.GetOwnerReferences()
+			}
+			if diff := cmp.Diff(tc.want.refs, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want owner references, +got owner references:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionStrictDefaults(t *testing.T) {
+	xr := func(labels, spec string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code", "labels": ` + labels + `},
+			"spec": {"id": "code", "count": 1` + spec + `}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   []string
+	}{
+		"Lenient": {
+			reason: "Defaults should be applied silently unless the XR is strict",
+			xr:     xr(`{}`, ``),
+		},
+		"Strict": {
+			reason: "A strict XR should get a warning for each field that took a default",
+			xr:     xr(`{}`, `, "strict": true`),
+			want: []string{
+				"spec.region is unset, so it defaulted to eu-central-1",
+				"spec.cidrBlock is unset, so it defaulted to 192.168.0.0/16",
+				"spec.providerConfigName is unset, so it defaulted to default",
+			},
+		},
+		"StrictAllSet": {
+			reason: "A strict XR that sets every defaultable field should get no warnings",
+			xr:     xr(`{}`, `, "strict": true, "region": "us-east-1", "cidrBlock": "10.0.0.0/16", "providerConfigName": "shared"`),
+		},
+		"StrictRegionLabel": {
+			reason: "A region set by label wasn't defaulted, so shouldn't be warned about",
+			xr:     xr(`{"networks.meta.fn.crossplane.io/region": "us-east-1"}`, `, "strict": true, "cidrBlock": "10.0.0.0/16", "providerConfigName": "shared"`),
+		},
+		"StrictIPAM": {
+			reason: "A VPC that gets its CIDR block from IPAM doesn't use the default CIDR block, so it shouldn't be warned about",
+			xr:     xr(`{}`, `, "strict": true, "region": "us-east-1", "providerConfigName": "shared", "ipv4IpamPoolId": "ipam-pool-0123", "ipv4NetmaskLength": 20`),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionPredictableVPCNames(t *testing.T) {
+	type want struct {
+		nameTags      map[string]string
+		externalNames map[string]string
+		results       []string
+	}
+
+	xr := func(id string, set bool, tags string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "` + id + `", "count": 2, "tags": ` + tags + `, "predictableVpcNames": ` + strconv.FormatBool(set) + `}
+		}`
+	}
+	long := strings.Repeat("x", 251)
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Set": {
+			reason: "Each VPC should get a Name tag derived from the network's ID and the VPC's index, and no external name",
+			xr:     xr("code", true, `{}`),
+			want: want{
+				nameTags: map[string]string{
+					"vpc-code-0": "code-vpc-0",
+					"vpc-code-1": "code-vpc-1",
+				},
+				externalNames: map[string]string{},
+			},
+		},
+		"Unset": {
+			reason: "VPCs should be tagged with their resource name unless spec.predictableVpcNames is set",
+			xr:     xr("code", false, `{}`),
+			want: want{
+				nameTags: map[string]string{
+					"vpc-code-0": "vpc-code-0",
+					"vpc-code-1": "vpc-code-1",
+				},
+				externalNames: map[string]string{},
+			},
+		},
+		"TaggedByUser": {
+			reason: "A Name tag in spec.tags should take precedence over the predictable name",
+			xr:     xr("code", true, `{"Name": "mine"}`),
+			want: want{
+				nameTags: map[string]string{
+					"vpc-code-0": "mine",
+					"vpc-code-1": "mine",
+				},
+				externalNames: map[string]string{},
+			},
+		},
+		"TooLong": {
+			reason: "A Name tag longer than AWS allows should return a fatal result",
+			xr:     xr(long, true, `{}`),
+			want: want{
+				nameTags:      map[string]string{},
+				externalNames: map[string]string{},
+				results:       []string{fmt.Sprintf(`invalid network config: spec.id: VPC Name tags such as "%s-vpc-1" are longer than the 256 characters AWS allows`, long)},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.nameTags, onlyPrefix(desiredStrings(t, rsp, "spec.forProvider.tags.Name"), "vpc-")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want Name tags, +got Name tags:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.externalNames, desiredStrings(t, rsp, "metadata.annotations[crossplane.io/external-name]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want external names, +got external names:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPlanSubnets(t *testing.T) {
+	cfg := Config{Config: config.Config{
+		ID:                "code",
+		CIDRBlock:         config.DefaultCIDRBlock,
+		AvailabilityZones: []string{"eu-central-1a", "eu-central-1b"},
+		PublicSubnets:     true,
+		PrivateSubnets:    true,
+		EnableIPv6:        true,
+	}}
+
+	type want struct {
+		subnets []subnet
+		err     bool
+	}
+
+	cases := map[string]struct {
+		reason    string
+		ipv6Block string
+		want      want
+	}{
+		"Delegated": {
+			reason:    "Each subnet should be delegated the /64 of the VPC's /56 at its index, public tier first",
+			ipv6Block: "2600:1f18:abcd:1200::/56",
+			want: want{
+				subnets: []subnet{
+					{Name: "subnet-code-1-public-0", Tier: tierPublic, AZ: "eu-central-1a", CIDR: "192.168.0.0/24", IPv6CIDR: "2600:1f18:abcd:1200::/64"},
+					{Name: "subnet-code-1-public-1", Tier: tierPublic, AZ: "eu-central-1b", CIDR: "192.168.1.0/24", IPv6CIDR: "2600:1f18:abcd:1201::/64"},
+					{Name: "subnet-code-1-private-0", Tier: tierPrivate, AZ: "eu-central-1a", CIDR: "192.168.2.0/24", IPv6CIDR: "2600:1f18:abcd:1202::/64"},
+					{Name: "subnet-code-1-private-1", Tier: tierPrivate, AZ: "eu-central-1b", CIDR: "192.168.3.0/24", IPv6CIDR: "2600:1f18:abcd:1203::/64"},
+				},
+			},
+		},
+		"TooSmall": {
+			reason:    "An IPv6 block without room for every subnet's /64 should return an error",
+			ipv6Block: "2600:1f18:abcd:1200::/63",
+			want:      want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := planSubnets(cfg, 1, tc.ipv6Block)
+
+			if diff := cmp.Diff(tc.want.subnets, got); diff != "" {
+				t.Errorf("%s\nplanSubnets(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != (err != nil) {
+				t.Errorf("%s\nplanSubnets(...): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+
+			// the delegation must be stable across reconciles
+			again, _ := planSubnets(cfg, 1, tc.ipv6Block)
+			if diff := cmp.Diff(got, again); diff != "" {
+				t.Errorf("%s\nplanSubnets(...): -first, +second:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionSubnetAlignment(t *testing.T) {
+	xr := func(azs, alignment string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"publicSubnets": true,
+				"privateSubnets": true,
+				"availabilityZones": ` + azs + alignment + `
+			}
+		}`
+	}
+
+	type want struct {
+		cidrs   map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Packed": {
+			reason: "Subnets should be packed contiguously by default",
+			xr:     xr(`["eu-central-1a", "eu-central-1b"]`, ""),
+			want: want{
+				cidrs: map[string]string{
+					"subnet-code-0-public-0":  "192.168.0.0/24",
+					"subnet-code-0-public-1":  "192.168.1.0/24",
+					"subnet-code-0-private-0": "192.168.2.0/24",
+					"subnet-code-0-private-1": "192.168.3.0/24",
+				},
+			},
+		},
+		"Aligned": {
+			reason: "Each subnet should start on the next aligned boundary",
+			xr:     xr(`["eu-central-1a", "eu-central-1b"]`, `, "subnetAlignment": 20`),
+			want: want{
+				cidrs: map[string]string{
+					"subnet-code-0-public-0":  "192.168.0.0/24",
+					"subnet-code-0-public-1":  "192.168.16.0/24",
+					"subnet-code-0-private-0": "192.168.32.0/24",
+					"subnet-code-0-private-1": "192.168.48.0/24",
+				},
+			},
+		},
+		"SmallerThanSubnets": {
+			reason: "An alignment smaller than a subnet should return a fatal result",
+			xr:     xr(`["eu-central-1a", "eu-central-1b"]`, `, "subnetAlignment": 26`),
+			want: want{
+				cidrs:   map[string]string{},
+				results: []string{"invalid network config: spec.subnetAlignment: /24 subnets can't be aligned on a /26 boundary; must be between /16 and /24"},
+			},
+		},
+		"NoRoom": {
+			reason: "An alignment that leaves no room for every subnet should return a fatal result",
+			xr:     xr(`["eu-central-1a", "eu-central-1b", "eu-central-1c"]`, `, "subnetAlignment": 18`),
+			want: want{
+				cidrs:   map[string]string{},
+				results: []string{"invalid network config: spec.cidrBlock: a /16 block has room for 4 /18 subnets, not 6"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cidrs, onlyPrefix(desiredStrings(t, rsp, "spec.forProvider.cidrBlock"), "subnet-")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want cidrBlock, +got cidrBlock:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionPublicSubnetAutoAssignIP(t *testing.T) {
+	xr := func(autoAssign string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"publicSubnets": true,
+				"privateSubnets": true,
+				"availabilityZones": ["eu-central-1a"]` + autoAssign + `
+			}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   map[string]bool
+	}{
+		"Default": {
+			reason: "Public subnets should auto-assign public IPs by default",
+			xr:     xr(""),
+			want: map[string]bool{
+				"subnet-code-0-public-0":  true,
+				"subnet-code-0-private-0": false,
+			},
+		},
+		"Enabled": {
+			reason: "Public subnets should auto-assign public IPs when asked to",
+			xr:     xr(`, "publicSubnetAutoAssignIp": true`),
+			want: map[string]bool{
+				"subnet-code-0-public-0":  true,
+				"subnet-code-0-private-0": false,
+			},
+		},
+		"Disabled": {
+			reason: "Public subnets shouldn't auto-assign public IPs when asked not to",
+			xr:     xr(`, "publicSubnetAutoAssignIp": false`),
+			want: map[string]bool{
+				"subnet-code-0-public-0":  false,
+				"subnet-code-0-private-0": false,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want, desiredBools(t, rsp, "spec.forProvider.mapPublicIpOnLaunch")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want mapPublicIpOnLaunch, +got mapPublicIpOnLaunch:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionPrivateVPCs(t *testing.T) {
+	type want struct {
+		kinds   map[string]string
+		roles   map[string]string
+		results []string
+	}
+
+	xr := func(indexes string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 4,
+				"includeGateway": true,
+				"publicSubnets": true,
+				"privateSubnets": true,
+				"availabilityZones": ["eu-central-1a"],
+				"privateVpcIndexes": ` + indexes + `
+			}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Mixed": {
+			reason: "Private VPCs should get neither gateways nor public subnets, and be labelled with the private role",
+			xr:     xr(`[2, 3]`),
+			want: want{
+				kinds: map[string]string{
+					"vpc-code-0":                     "VPC",
+					"gateway-code-0":                 "InternetGateway",
+					"subnet-code-0-public-0":         "Subnet",
+					"subnet-code-0-private-0":        "Subnet",
+					"routetable-code-0-public":       "RouteTable",
+					"route-code-0-public-0":          "Route",
+					"rtassoc-subnet-code-0-public-0": "RouteTableAssociation",
+					"vpc-code-1":                     "VPC",
+					"gateway-code-1":                 "InternetGateway",
+					"subnet-code-1-public-0":         "Subnet",
+					"subnet-code-1-private-0":        "Subnet",
+					"routetable-code-1-public":       "RouteTable",
+					"route-code-1-public-0":          "Route",
+					"rtassoc-subnet-code-1-public-0": "RouteTableAssociation",
+					"vpc-code-2":                     "VPC",
+					"subnet-code-2-private-0":        "Subnet",
+					"vpc-code-3":                     "VPC",
+					"subnet-code-3-private-0":        "Subnet",
+				},
+				roles: map[string]string{
+					"vpc-code-0": rolePrimary,
+					"vpc-code-1": roleSecondary,
+					"vpc-code-2": rolePrivate,
+					"vpc-code-3": rolePrivate,
+				},
+			},
+		},
+		"OutOfRange": {
+			reason: "A private VPC index beyond the count should return a fatal result that says how to reduce the count",
+			xr:     xr(`[4]`),
+			want: want{
+				kinds:   map[string]string{},
+				roles:   map[string]string{},
+				results: []string{"invalid network config: spec.privateVpcIndexes[0]: 4 is out of range for spec.count 4; when reducing spec.count, remove the indexes of the VPCs it drops from spec.privateVpcIndexes too"},
+			},
+		},
+		"Negative": {
+			reason: "A negative private VPC index should return a fatal result",
+			xr:     xr(`[-1]`),
+			want: want{
+				kinds:   map[string]string{},
+				roles:   map[string]string{},
+				results: []string{"invalid network config: spec.privateVpcIndexes[0]: -1 is out of range for spec.count 4"},
+			},
+		},
+		"Duplicate": {
+			reason: "A private VPC index listed twice should return a fatal result",
+			xr:     xr(`[2, 2]`),
+			want: want{
+				kinds:   map[string]string{},
+				roles:   map[string]string{},
+				results: []string{"invalid network config: spec.privateVpcIndexes[1]: 2 is listed more than once"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.kinds, desiredStrings(t, rsp, "kind")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want resources, +got resources:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.roles, desiredStrings(t, rsp, "metadata.labels[networks.meta.fn.crossplane.io/role]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want roles, +got roles:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionPrivateVPCsScaleDown(t *testing.T) {
+	xr := func(count int, indexes string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": ` + strconv.Itoa(count) + `,
+				"privateVpcIndexes": ` + indexes + `
+			}
+		}`
+	}
+	// the network as it was composed before the count was reduced
+	observed := map[string]*fnv1.Resource{}
+	for i := range 4 {
+		name := fmt.Sprintf("vpc-code-%d", i)
+		observed[name] = &fnv1.Resource{Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "VPC",
+			"metadata": {"name": "` + name + `"}
+		}`)}
+	}
+
+	cases := map[string]struct {
+		reason  string
+		xr      string
+		want    []string
+		results []string
+	}{
+		"BothReduced": {
+			reason: "Reducing the count along with the private VPC indexes should compose the remaining VPCs",
+			xr:     xr(2, `[1]`),
+			want:   []string{"vpc-code-0", "vpc-code-1"},
+		},
+		"CountReduced": {
+			reason:  "Reducing the count below a private VPC index should return a fatal result that says to update both fields",
+			xr:      xr(2, `[1, 3]`),
+			results: []string{"invalid network config: spec.privateVpcIndexes[1]: 3 is out of range for spec.count 2; when reducing spec.count, remove the indexes of the VPCs it drops from spec.privateVpcIndexes too"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)},
+					Resources: observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			var got []string
+			for name := range rsp.GetDesired().GetResources() {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want VPCs, +got VPCs:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionGatewayVPCIndexes(t *testing.T) {
+	type want struct {
+		gateways map[string]string
+		results  []string
+	}
+
+	xr := func(gateways, private string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 3,
+				"includeGateway": true,
+				"gatewayVpcIndexes": ` + gateways + `,
+				"privateVpcIndexes": ` + private + `
+			}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Selected": {
+			reason: "Only the listed VPCs should get a gateway",
+			xr:     xr(`[0]`, `[2]`),
+			want: want{
+				gateways: map[string]string{"gateway-code-0": "InternetGateway"},
+			},
+		},
+		"Overlapping": {
+			reason: "A VPC listed as both private and gateway-eligible should return a fatal result naming it",
+			xr:     xr(`[0, 2]`, `[2]`),
+			want: want{
+				gateways: map[string]string{},
+				results:  []string{"invalid network config: spec.gatewayVpcIndexes[1]: VPC 2 is also listed in spec.privateVpcIndexes"},
+			},
+		},
+		"OutOfRange": {
+			reason: "A gateway VPC index beyond the count should return a fatal result",
+			xr:     xr(`[3]`, `[]`),
+			want: want{
+				gateways: map[string]string{},
+				results:  []string{"invalid network config: spec.gatewayVpcIndexes[0]: 3 is out of range for spec.count 3"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			gateways := map[string]string{}
+			for name, kind := range desiredStrings(t, rsp, "kind") {
+				if kind == "InternetGateway" {
+					gateways[name] = kind
+				}
+			}
+			if diff := cmp.Diff(tc.want.gateways, gateways); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want gateways, +got gateways:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import "fmt"
+
+// freeAddressSpace is the part of a VPC's CIDR block that none of its subnets
+// use.
+type freeAddressSpace struct {
+	// Percent of the VPC's CIDR block that is unallocated.
+	Percent float64 `json:"percent"`
+
+	// CIDRs that together cover the unallocated space.
+	CIDRs []string `json:"cidrs"`
+}
+
+// percentString returns the unallocated percentage to one decimal place.
+func (fs freeAddressSpace) percentString() string {
+	return fmt.Sprintf("%.1f%%", fs.Percent)
+}
+
+// vpcFreeAddressSpace returns the part of the supplied VPC CIDR block that the
+// supplied subnets don't use.
+func vpcFreeAddressSpace(block string, subnets []subnet) (freeAddressSpace, error) {
+	used := make([]string, len(subnets))
+	for i, s := range subnets {
+		used[i] = s.CIDR
+	}
+	cidrs, percent, err := freeCIDRs(block, used)
+	if err != nil {
+		return freeAddressSpace{}, err
+	}
+	return freeAddressSpace{Percent: percent, CIDRs: cidrs}, nil
+}
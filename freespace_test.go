@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+)
+
+func TestRunFunctionReportFreeAddressSpace(t *testing.T) {
+	xr := func(report string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 2,
+				"cidrBlock": "10.0.0.0/16",
+				"divideCidrBlock": true,
+				"publicSubnets": true,
+				"privateSubnets": true,
+				"availabilityZones": ["eu-central-1a", "eu-central-1b"],
+				"reportFreeAddressSpace": ` + report + `
+			}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   any
+	}{
+		"Disabled": {
+			reason: "The XR's status should be left alone unless the report is enabled",
+			xr:     xr("false"),
+		},
+		"Enabled": {
+			reason: "Each VPC's unallocated space should be reported in the XR's status",
+			xr:     xr("true"),
+			want: map[string]any{
+				"vpc-code-0": map[string]any{
+					"percent": 96.875,
+					"cidrs":   []any{"10.0.4.0/22", "10.0.8.0/21", "10.0.16.0/20", "10.0.32.0/19", "10.0.64.0/18"},
+				},
+				"vpc-code-1": map[string]any{
+					"percent": 96.875,
+					"cidrs":   []any{"10.0.132.0/22", "10.0.136.0/21", "10.0.144.0/20", "10.0.160.0/19", "10.0.192.0/18"},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			got, _ := fieldpath.Pave(rsp.GetDesired().GetComposite().GetResource().AsMap()).GetValue("status.freeAddressSpace")
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want status.freeAddressSpace, +got status.freeAddressSpace:\n%s", tc.reason, diff)
+			}
+
+			var msgs []string
+			for _, r := range rsp.GetResults() {
+				if r.GetReason() == reasonFreeAddressSpace {
+					msgs = append(msgs, r.GetMessage())
+				}
+			}
+			want := []string{
+				`VPC "vpc-code-0" has 96.9% of 10.0.0.0/17 unallocated: 10.0.4.0/22, 10.0.8.0/21, 10.0.16.0/20, 10.0.32.0/19, 10.0.64.0/18`,
+				`VPC "vpc-code-1" has 96.9% of 10.0.128.0/17 unallocated: 10.0.132.0/22, 10.0.136.0/21, 10.0.144.0/20, 10.0.160.0/19, 10.0.192.0/18`,
+			}
+			if diff := cmp.Diff(want, msgs); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want free address space results, +got free address space results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/names"
+)
+
+// vpcIndexes returns the indexes of the network's VPCs, in order. They're 0
+// to spec.count-1 unless spec.fillIndexGaps resolved them from the observed
+// VPCs.
+func (c Config) vpcIndexes() []int64 {
+	if c.VPCIndexes != nil {
+		return c.VPCIndexes
+	}
+	indexes := make([]int64, 0, c.Count)
+	for i := range c.Count {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// hasVPCIndex returns true if the supplied index is that of one of the
+// network's VPCs.
+func (c Config) hasVPCIndex(i int64) bool {
+	if c.VPCIndexes == nil {
+		return i >= 0 && i < c.Count
+	}
+	return slices.Contains(c.VPCIndexes, i)
+}
+
+// vpcIndexRange describes the indexes of the network's VPCs, for errors about
+// indexes that aren't among them.
+func (c Config) vpcIndexRange() string {
+	if c.VPCIndexes == nil {
+		return fmt.Sprintf("spec.count %d", c.Count)
+	}
+	indexes := make([]string, len(c.VPCIndexes))
+	for j, i := range c.VPCIndexes {
+		indexes[j] = strconv.FormatInt(i, 10)
+	}
+	return fmt.Sprintf("the VPC indexes %s that spec.fillIndexGaps resolved", strings.Join(indexes, ", "))
+}
+
+// filledVPCIndexes returns the indexes of spec.count VPCs, in order, reusing
+// those of the supplied observed VPCs so that existing VPCs are kept where they
+// are. Observed VPCs beyond the count are dropped, highest index first, and any
+// VPCs still to be created fill the lowest indexes that are free. A VPC deleted
+// from the middle of the network is therefore replaced at its old index, rather
+// than at the end.
+func filledVPCIndexes(cfg Config, observed map[resource.Name]resource.ObservedComposed) []int64 {
+	var existing []int64
+	for name := range observed {
+		if i, ok := vpcIndex(cfg.ID, string(name)); ok {
+			existing = append(existing, i)
+		}
+	}
+	slices.Sort(existing)
+	if int64(len(existing)) > cfg.Count {
+		existing = existing[:cfg.Count]
+	}
+
+	indexes := make([]int64, 0, cfg.Count)
+	missing := cfg.Count - int64(len(existing))
+	for i, e := int64(0), 0; int64(len(indexes)) < cfg.Count; i++ {
+		switch {
+		case e < len(existing) && existing[e] == i:
+			e++
+		case missing > 0:
+			missing--
+		default:
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// vpcIndex returns the index of the named VPC of the supplied network, and
+// whether the name is that of one of its VPCs at all.
+func vpcIndex(id, name string) (int64, bool) {
+	s, ok := strings.CutPrefix(name, strings.TrimSuffix(names.VPCName(id, 0), "0"))
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || i < 0 || names.VPCName(id, i) != name {
+		return 0, false
+	}
+	return i, true
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionFillIndexGaps(t *testing.T) {
+	xr := func(fill bool, count int) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": ` + strconv.Itoa(count) + `,
+				"fillIndexGaps": ` + strconv.FormatBool(fill) + `
+			}
+		}`
+	}
+	// observed returns observed VPCs of the network with the supplied indexes.
+	observed := func(indexes ...int) map[string]*fnv1.Resource {
+		vpcs := map[string]*fnv1.Resource{}
+		for _, i := range indexes {
+			name := fmt.Sprintf("vpc-code-%d", i)
+			vpcs[name] = &fnv1.Resource{Resource: resource.MustStructJSON(`{
+				"apiVersion": "ec2.aws.upbound.io/v1beta1",
+				"kind": "VPC",
+				"metadata": {"name": "` + name + `"},
+				"status": {"atProvider": {"id": "vpc-` + strconv.Itoa(i) + `"}}
+			}`)}
+		}
+		return vpcs
+	}
+
+	cases := map[string]struct {
+		reason   string
+		xr       string
+		observed map[string]*fnv1.Resource
+		want     []string
+		results  []string
+	}{
+		"NoneObserved": {
+			reason: "A new network should number its VPCs from 0",
+			xr:     xr(true, 2),
+			want:   []string{"vpc-code-0", "vpc-code-1"},
+		},
+		"BackFill": {
+			reason:   "A new VPC should fill the gap left by a deleted one rather than go after the highest index",
+			xr:       xr(true, 4),
+			observed: observed(0, 2, 3),
+			want:     []string{"vpc-code-0", "vpc-code-1", "vpc-code-2", "vpc-code-3"},
+		},
+		"KeepExisting": {
+			reason:   "Existing VPCs should keep their indexes when the count matches them",
+			xr:       xr(true, 3),
+			observed: observed(0, 2, 3),
+			want:     []string{"vpc-code-0", "vpc-code-2", "vpc-code-3"},
+		},
+		"ScaleDown": {
+			reason:   "Scaling down should keep the existing VPCs with the lowest indexes",
+			xr:       xr(true, 2),
+			observed: observed(0, 2, 3),
+			want:     []string{"vpc-code-0", "vpc-code-2"},
+		},
+		"Disabled": {
+			reason:   "Without spec.fillIndexGaps VPCs should be numbered from 0 to the count",
+			xr:       xr(false, 3),
+			observed: observed(0, 2, 3),
+			want:     []string{"vpc-code-0", "vpc-code-1", "vpc-code-2"},
+		},
+		"PrivateFilledIndex": {
+			reason:   "A private VPC index beyond the count should be accepted when it's one of the filled indexes",
+			xr:       `{"apiVersion": "xp-layers.crossplane.io/v1alpha1", "kind": "XNetwork", "spec": {"id": "code", "count": 3, "fillIndexGaps": true, "privateVpcIndexes": [3]}}`,
+			observed: observed(0, 2, 3),
+			want:     []string{"vpc-code-0", "vpc-code-2", "vpc-code-3"},
+		},
+		"PrivateUnfilledIndex": {
+			reason:   "A private VPC index within the count should be rejected when it isn't one of the filled indexes",
+			xr:       `{"apiVersion": "xp-layers.crossplane.io/v1alpha1", "kind": "XNetwork", "spec": {"id": "code", "count": 3, "fillIndexGaps": true, "privateVpcIndexes": [1]}}`,
+			observed: observed(0, 2, 3),
+			results:  []string{"invalid network config: spec.privateVpcIndexes[0]: 1 is out of range for the VPC indexes 0, 2, 3 that spec.fillIndexGaps resolved; when reducing spec.count, remove the indexes of the VPCs it drops from spec.privateVpcIndexes too"},
+		},
+		"DivideCIDRBlock": {
+			reason:  "Filling gaps should be rejected when each VPC's CIDR block depends on its index",
+			xr:      `{"apiVersion": "xp-layers.crossplane.io/v1alpha1", "kind": "XNetwork", "spec": {"id": "code", "count": 2, "fillIndexGaps": true, "divideCidrBlock": true}}`,
+			results: []string{"invalid network config: spec.fillIndexGaps: cannot be combined with spec.divideCidrBlock"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)},
+					Resources: tc.observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			var got []string
+			for name := range rsp.GetDesired().GetResources() {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want VPCs, +got VPCs:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestVPCIndex(t *testing.T) {
+	type want struct {
+		i  int64
+		ok bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		name   string
+		want   want
+	}{
+		"VPC": {
+			reason: "A VPC of the network should be parsed to its index",
+			name:   "vpc-code-12",
+			want:   want{i: 12, ok: true},
+		},
+		"OtherNetwork": {
+			reason: "A VPC of another network shouldn't be parsed",
+			name:   "vpc-other-1",
+		},
+		"OtherKind": {
+			reason: "A resource that isn't a VPC shouldn't be parsed",
+			name:   "vpc-code-1-public",
+		},
+		"NotCanonical": {
+			reason: "A name that only parses to an index, but isn't the VPC's name, shouldn't be parsed",
+			name:   "vpc-code-01",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			i, ok := vpcIndex("code", tc.name)
+			if diff := cmp.Diff(tc.want, want{i: i, ok: ok}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nvpcIndex(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/jbw976/demo-xfn-network/names"
+)
+
+// Placeholders that spec.gatewayVpcSelector label values may reference.
+const (
+	// placeholderID stands for the network's spec.id.
+	placeholderID = "{id}"
+
+	// placeholderVPC stands for the vpc-id label of the gateway's own VPC.
+	placeholderVPC = "{vpc}"
+)
+
+// gatewayVPCMatchLabels returns the labels an InternetGateway selects its VPC
+// by. By default that's the vpc-id label of the named VPC. A
+// spec.gatewayVpcSelector replaces them, for example to select any VPC of the
+// network in a shared gateway setup.
+func (c Config) gatewayVPCMatchLabels(vpcName string) map[string]string {
+	if c.GatewayVPCSelector == nil {
+		return map[string]string{labelVPCID: c.vpcIDLabel(vpcName)}
+	}
+	r := strings.NewReplacer(placeholderID, c.ID, placeholderVPC, c.vpcIDLabel(vpcName))
+	labels := make(map[string]string, len(c.GatewayVPCSelector))
+	for k, v := range c.GatewayVPCSelector {
+		labels[k] = r.Replace(v)
+	}
+	return labels
+}
+
+// validateGatewayVPCSelector returns a ValidationError if spec.gatewayVpcSelector
+// is set but matches no labels, can't be used because gateways reference their
+// VPC by name, or yields an invalid label for any VPC. A selector must also
+// reference the {vpc} placeholder when more than one gateway is composed, or
+// every gateway would select, and attach to, the same VPC.
+func (c Config) validateGatewayVPCSelector() error {
+	if c.GatewayVPCSelector == nil {
+		return nil
+	}
+	if len(c.GatewayVPCSelector) == 0 {
+		return &ValidationError{Field: "spec.gatewayVpcSelector", Reason: "must match at least one label"}
+	}
+	if c.GatewayRefByName {
+		return &ValidationError{Field: "spec.gatewayVpcSelector", Reason: "cannot be combined with spec.gatewayRefByName, since gateways then reference their VPC by name"}
+	}
+
+	// check in a stable order so the same bad input always reports the same
+	// label
+	keys := make([]string, 0, len(c.GatewayVPCSelector))
+	for k := range c.GatewayVPCSelector {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		field := fmt.Sprintf("spec.gatewayVpcSelector[%s]", k)
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%q is not a valid label key", k)}
+		}
+		for i := range c.Count {
+			v := c.gatewayVPCMatchLabels(names.VPCName(c.ID, i))[k]
+			if errs := validation.IsValidLabelValue(v); v == "" || len(errs) > 0 {
+				return &ValidationError{Field: field, Reason: fmt.Sprintf("%q is not a valid label value for VPC %d", v, i)}
+			}
+		}
+	}
+	if n := c.gatewayCount(); n > 1 && !c.gatewayVPCSelectorPerVPC() {
+		return &ValidationError{Field: "spec.gatewayVpcSelector", Reason: fmt.Sprintf("must reference %s in a label value, since %d gateways would otherwise all select the same VPC", placeholderVPC, n)}
+	}
+	return nil
+}
+
+// gatewayCount returns how many InternetGateways the network composes.
+func (c Config) gatewayCount() int {
+	n := 0
+	for _, i := range c.vpcIndexes() {
+		if c.forVPC(i).IncludeGateway {
+			n++
+		}
+	}
+	return n
+}
+
+// gatewayVPCSelectorPerVPC returns true if spec.gatewayVpcSelector selects
+// each gateway's own VPC, by referencing its vpc-id label.
+func (c Config) gatewayVPCSelectorPerVPC() bool {
+	for _, v := range c.GatewayVPCSelector {
+		if strings.Contains(v, placeholderVPC) {
+			return true
+		}
+	}
+	return false
+}
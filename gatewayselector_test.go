@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+)
+
+func TestRunFunctionGatewayVPCSelector(t *testing.T) {
+	xr := func(spec string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 2,
+				"includeGateway": true` + spec + `
+			}
+		}`
+	}
+
+	type want struct {
+		selectors map[string]any
+		results   []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Default": {
+			reason: "Each gateway should select its own VPC by default",
+			xr:     xr(""),
+			want: want{
+				selectors: map[string]any{
+					"gateway-code-0": map[string]any{"networks.meta.fn.crossplane.io/vpc-id": "vpc-code-0"},
+					"gateway-code-1": map[string]any{"networks.meta.fn.crossplane.io/vpc-id": "vpc-code-1"},
+				},
+			},
+		},
+		"Broadened": {
+			reason: "A single shared gateway should select any VPC of the network given a broadened selector",
+			xr:     xr(`, "gatewayVpcIndexes": [0], "gatewayVpcSelector": {"networks.meta.fn.crossplane.io/network-id": "{id}"}`),
+			want: want{
+				selectors: map[string]any{
+					"gateway-code-0": map[string]any{"networks.meta.fn.crossplane.io/network-id": "code"},
+				},
+			},
+		},
+		"BroadenedPerVPC": {
+			reason: "Each gateway should select its own VPC given a broadened selector that references it",
+			xr:     xr(`, "gatewayVpcSelector": {"networks.meta.fn.crossplane.io/network-id": "{id}", "example.org/shared-with": "{vpc}-peers"}`),
+			want: want{
+				selectors: map[string]any{
+					"gateway-code-0": map[string]any{"networks.meta.fn.crossplane.io/network-id": "code", "example.org/shared-with": "vpc-code-0-peers"},
+					"gateway-code-1": map[string]any{"networks.meta.fn.crossplane.io/network-id": "code", "example.org/shared-with": "vpc-code-1-peers"},
+				},
+			},
+		},
+		"BroadenedManyGateways": {
+			reason: "A selector without the {vpc} placeholder should return a fatal result when several gateways would all select the same VPC",
+			xr:     xr(`, "gatewayVpcSelector": {"networks.meta.fn.crossplane.io/network-id": "{id}"}`),
+			want: want{
+				selectors: map[string]any{},
+				results:   []string{"invalid network config: spec.gatewayVpcSelector: must reference {vpc} in a label value, since 2 gateways would otherwise all select the same VPC"},
+			},
+		},
+		"Empty": {
+			reason: "A selector that matches no labels should return a fatal result",
+			xr:     xr(`, "gatewayVpcSelector": {}`),
+			want: want{
+				selectors: map[string]any{},
+				results:   []string{"invalid network config: spec.gatewayVpcSelector: must match at least one label"},
+			},
+		},
+		"InvalidValue": {
+			reason: "A selector value that isn't a valid label value should return a fatal result",
+			xr:     xr(`, "gatewayVpcSelector": {"networks.meta.fn.crossplane.io/network-id": "{id} shared"}`),
+			want: want{
+				selectors: map[string]any{},
+				results:   []string{`invalid network config: spec.gatewayVpcSelector[networks.meta.fn.crossplane.io/network-id]: "code shared" is not a valid label value for VPC 0`},
+			},
+		},
+		"RefByName": {
+			reason: "A selector can't be used when gateways reference their VPC by name",
+			xr:     xr(`, "gatewayRefByName": true, "gatewayVpcSelector": {"networks.meta.fn.crossplane.io/network-id": "{id}"}`),
+			want: want{
+				selectors: map[string]any{},
+				results:   []string{"invalid network config: spec.gatewayVpcSelector: cannot be combined with spec.gatewayRefByName, since gateways then reference their VPC by name"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			desired, err := request.GetDesiredComposedResources(&fnv1.RunFunctionRequest{Desired: rsp.GetDesired()})
+			if err != nil {
+				t.Fatalf("%s\nrequest.GetDesiredComposedResources(...): unexpected error: %v", tc.reason, err)
+			}
+			got := map[string]any{}
+			for name, dc := range desired {
+				if v, err := dc.Resource.GetValue("spec.forProvider.vpcIdSelector.matchLabels"); err == nil && dc.Resource.GetKind() == "InternetGateway" {
+					got[string(name)] = v
+				}
+			}
+			if diff := cmp.Diff(tc.want.selectors, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want matchLabels, +got matchLabels:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
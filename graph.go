@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/graph"
+)
+
+// resourceGraph returns a DOT digraph of the supplied desired composed
+// resources. Each resource is a node, with an edge to it from every resource
+// it references by name or selects by label.
+func resourceGraph(id string, desired map[resource.Name]*resource.DesiredComposed) string {
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "digraph %q {\n", id)
+	for _, name := range names {
+		fmt.Fprintf(b, "  %q [label=\"%s\\n%s\"];\n", name, name, desired[resource.Name(name)].Resource.GetKind())
+	}
+	for _, e := range graph.Edges(desired) {
+		fmt.Fprintf(b, "  %q -> %q;\n", e.From, e.To)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
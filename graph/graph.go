@@ -0,0 +1,190 @@
+// Package graph derives the dependencies between the resources the function
+// composes for a network from the references and selectors in their specs.
+// Tools that apply the resources without Crossplane can use it to apply them
+// in a safe order.
+package graph
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+)
+
+// referenceKinds maps the prefix of each reference field of a composed
+// resource's spec.forProvider, such as vpcIdRef or subnetIdSelector, to the
+// kind of resource it references.
+var referenceKinds = map[string]string{
+	"vpcId":             "VPC",
+	"gatewayId":         "InternetGateway",
+	"subnetId":          "Subnet",
+	"routeTableId":      "RouteTable",
+	"vpcEndpointId":     "VPCEndpoint",
+	"natGatewayId":      "NATGateway",
+	"allocationId":      "EIP",
+	"firewallPolicyArn": "FirewallPolicy",
+}
+
+// An Edge of the resource graph, from a resource to one that depends on it.
+type Edge struct {
+	From string
+	To   string
+}
+
+// A NamedResource is a desired composed resource and the name it is keyed by
+// in a RunFunctionResponse.
+type NamedResource struct {
+	Name     string
+	Resource *fnv1.Resource
+}
+
+// DesiredResourcesInDependencyOrder returns the desired composed resources of
+// the supplied RunFunctionResponse sorted so that each resource follows every
+// resource it references or selects, for example a VPC before its gateway and
+// subnets, and a gateway before the routes through it. Tools that apply the
+// resources without Crossplane can apply them in this order. Resources that
+// don't depend on each other are sorted by name. It returns an error if the
+// resources depend on each other in a cycle.
+func DesiredResourcesInDependencyOrder(rsp *fnv1.RunFunctionResponse) ([]NamedResource, error) {
+	resources := rsp.GetDesired().GetResources()
+	desired := make(map[resource.Name]*resource.DesiredComposed, len(resources))
+	byName := make(map[string]string, len(resources))
+	for name, r := range resources {
+		dc := composed.New()
+		if err := resource.AsObject(r.GetResource(), dc); err != nil {
+			return nil, errors.Wrapf(err, "cannot convert desired resource %q to %T", name, dc)
+		}
+		desired[resource.Name(name)] = &resource.DesiredComposed{Resource: dc}
+		if n := dc.GetName(); n != "" {
+			byName[n] = name
+		}
+	}
+
+	// resources referenced by name are named by their metadata.name, which
+	// differs from their key when it's overridden
+	dependents := map[string][]string{}
+	waiting := make(map[string]int, len(resources))
+	for _, e := range Edges(desired) {
+		from := e.From
+		if _, ok := resources[from]; !ok {
+			from = byName[from]
+		}
+		if from == "" || from == e.To {
+			continue
+		}
+		dependents[from] = append(dependents[from], e.To)
+		waiting[e.To]++
+	}
+
+	var ready []string
+	for name := range resources {
+		if waiting[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+	out := make([]NamedResource, 0, len(resources))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		name := ready[0]
+		ready = ready[1:]
+		out = append(out, NamedResource{Name: name, Resource: resources[name]})
+		for _, d := range dependents[name] {
+			waiting[d]--
+			if waiting[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	if len(out) < len(resources) {
+		var cycle []string
+		for name := range resources {
+			if waiting[name] > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, errors.Errorf("cannot order desired resources %s, because some of them depend on each other in a cycle", strings.Join(cycle, ", "))
+	}
+	return out, nil
+}
+
+// Edges returns the edges between the supplied desired composed resources,
+// from each resource to every resource that references it by name or selects
+// it by label, sorted.
+func Edges(desired map[resource.Name]*resource.DesiredComposed) []Edge {
+	var edges []Edge
+	for name, dc := range desired {
+		fp, _ := dc.Resource.GetValue("spec.forProvider")
+		params, _ := fp.(map[string]any)
+		for field, v := range params {
+			for _, from := range referencedResources(desired, field, v) {
+				edges = append(edges, Edge{From: from, To: string(name)})
+			}
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
+
+// referencedResources returns the names of the desired composed resources
+// referenced by the supplied spec.forProvider field. Fields that aren't
+// references return nothing.
+func referencedResources(desired map[resource.Name]*resource.DesiredComposed, field string, v any) []string {
+	switch {
+	case strings.HasSuffix(field, "Ref"):
+		if name := referenceName(v); name != "" {
+			return []string{name}
+		}
+	case strings.HasSuffix(field, "Refs"):
+		refs, _ := v.([]any)
+		names := make([]string, 0, len(refs))
+		for _, r := range refs {
+			if name := referenceName(r); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names
+	case strings.HasSuffix(field, "Selector"):
+		kind, ok := referenceKinds[strings.TrimSuffix(field, "Selector")]
+		if !ok {
+			return nil
+		}
+		sel, _ := v.(map[string]any)
+		match, _ := sel["matchLabels"].(map[string]any)
+		var names []string
+		for name, dc := range desired {
+			if dc.Resource.GetKind() == kind && hasLabels(dc.Resource.GetLabels(), match) {
+				names = append(names, string(name))
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// referenceName returns the name of the supplied unstructured reference.
+func referenceName(v any) string {
+	ref, _ := v.(map[string]any)
+	name, _ := ref["name"].(string)
+	return name
+}
+
+// hasLabels returns true if the supplied labels include all of the supplied
+// unstructured match labels.
+func hasLabels(labels map[string]string, match map[string]any) bool {
+	for k, v := range match {
+		if s, _ := v.(string); labels[k] != s {
+			return false
+		}
+	}
+	return true
+}
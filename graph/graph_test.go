@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestDesiredResourcesInDependencyOrder(t *testing.T) {
+	rsp := &fnv1.RunFunctionResponse{Desired: &fnv1.State{Resources: map[string]*fnv1.Resource{
+		"route": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "Route",
+			"metadata": {"name": "route"},
+			"spec": {"forProvider": {"gatewayIdRef": {"name": "gateway"}, "routeTableIdRef": {"name": "routetable"}}}
+		}`)},
+		"routetable": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "RouteTable",
+			"metadata": {"name": "routetable"},
+			"spec": {"forProvider": {"vpcIdRef": {"name": "vpc-override"}}}
+		}`)},
+		"gateway": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "InternetGateway",
+			"metadata": {"name": "gateway"},
+			"spec": {"forProvider": {"vpcIdSelector": {"matchLabels": {"networks.meta.fn.crossplane.io/vpc-id": "vpc"}}}}
+		}`)},
+		"vpc": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "VPC",
+			"metadata": {"name": "vpc-override", "labels": {"networks.meta.fn.crossplane.io/vpc-id": "vpc"}},
+			"spec": {"forProvider": {"cidrBlock": "192.168.0.0/16"}}
+		}`)},
+	}}}
+
+	sorted, err := DesiredResourcesInDependencyOrder(rsp)
+	if err != nil {
+		t.Fatalf("DesiredResourcesInDependencyOrder(...): unexpected error: %v", err)
+	}
+	got := make([]string, 0, len(sorted))
+	for _, r := range sorted {
+		got = append(got, r.Name)
+	}
+
+	// the route table references the VPC by its overridden metadata.name, and
+	// the gateway selects it by label
+	want := []string{"vpc", "gateway", "routetable", "route"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DesiredResourcesInDependencyOrder(...): each resource should follow those it references or selects: -want, +got:\n%s", diff)
+	}
+}
+
+func TestDesiredResourcesInDependencyOrderCycle(t *testing.T) {
+	rsp := &fnv1.RunFunctionResponse{Desired: &fnv1.State{Resources: map[string]*fnv1.Resource{
+		"a": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "Route",
+			"metadata": {"name": "a"},
+			"spec": {"forProvider": {"routeTableIdRef": {"name": "b"}}}
+		}`)},
+		"b": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "RouteTable",
+			"metadata": {"name": "b"},
+			"spec": {"forProvider": {"gatewayIdRef": {"name": "a"}}}
+		}`)},
+	}}}
+
+	var got string
+	if _, err := DesiredResourcesInDependencyOrder(rsp); err != nil {
+		got = err.Error()
+	}
+	want := "cannot order desired resources a, b, because some of them depend on each other in a cycle"
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DesiredResourcesInDependencyOrder(...): -want error, +got error:\n%s", diff)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/jbw976/demo-xfn-network/graph"
+	"github.com/jbw976/demo-xfn-network/names"
+)
+
+func TestRunFunctionEmitGraph(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   []string
+	}{
+		"Graph": {
+			reason: "The graph should hold every composed resource, with edges to each from the resources it references",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"includeGateway": true,
+					"publicSubnets": true,
+					"availabilityZones": ["eu-central-1a"],
+					"emitGraph": true
+				}
+			}`,
+			want: []string{`digraph "code" {
+  "gateway-code-0" [label="gateway-code-0\nInternetGateway"];
+  "route-code-0-public-0" [label="route-code-0-public-0\nRoute"];
+  "routetable-code-0-public" [label="routetable-code-0-public\nRouteTable"];
+  "rtassoc-subnet-code-0-public-0" [label="rtassoc-subnet-code-0-public-0\nRouteTableAssociation"];
+  "subnet-code-0-public-0" [label="subnet-code-0-public-0\nSubnet"];
+  "vpc-code-0" [label="vpc-code-0\nVPC"];
+  "gateway-code-0" -> "route-code-0-public-0";
+  "routetable-code-0-public" -> "route-code-0-public-0";
+  "routetable-code-0-public" -> "rtassoc-subnet-code-0-public-0";
+  "subnet-code-0-public-0" -> "rtassoc-subnet-code-0-public-0";
+  "vpc-code-0" -> "gateway-code-0";
+  "vpc-code-0" -> "routetable-code-0-public";
+  "vpc-code-0" -> "subnet-code-0-public-0";
+}
+`},
+		},
+		"Disabled": {
+			reason: "No graph should be emitted unless spec.emitGraph is set",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1
+				}
+			}`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			var got []string
+			for _, r := range rsp.GetResults() {
+				if r.GetReason() == reasonResourceGraph {
+					got = append(got, r.GetMessage())
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want graph, +got graph:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestDesiredResourcesInDependencyOrder(t *testing.T) {
+	rsp := runXR(t, `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {
+			"id": "code",
+			"count": 2,
+			"includeGateway": true,
+			"publicSubnets": true,
+			"privateSubnets": true,
+			"availabilityZones": ["eu-central-1a", "eu-central-1b"]
+		}
+	}`)
+
+	sorted, err := graph.DesiredResourcesInDependencyOrder(rsp)
+	if err != nil {
+		t.Fatalf("DesiredResourcesInDependencyOrder(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(len(rsp.GetDesired().GetResources()), len(sorted)); diff != "" {
+		t.Errorf("DesiredResourcesInDependencyOrder(...): every desired resource should be returned once: -want, +got:\n%s", diff)
+	}
+	pos := map[string]int{}
+	for i, r := range sorted {
+		pos[r.Name] = i
+	}
+
+	// each pair is a resource and one that depends on it
+	var before [][2]string
+	for i := int64(0); i < 2; i++ {
+		vpc, gateway := names.VPCName("code", i), names.GatewayName("code", i)
+		route := names.RouteName("code", i, tierPublic, 0)
+		before = append(before,
+			[2]string{vpc, gateway},
+			[2]string{gateway, route},
+			[2]string{names.RouteTableName("code", i, tierPublic), route},
+		)
+		for j := 0; j < 2; j++ {
+			before = append(before,
+				[2]string{vpc, names.SubnetName("code", i, tierPublic, j)},
+				[2]string{vpc, names.SubnetName("code", i, tierPrivate, j)},
+			)
+		}
+	}
+	for _, b := range before {
+		from, ok := pos[b[0]]
+		if !ok {
+			t.Fatalf("DesiredResourcesInDependencyOrder(...): no %s", b[0])
+		}
+		to, ok := pos[b[1]]
+		if !ok {
+			t.Fatalf("DesiredResourcesInDependencyOrder(...): no %s", b[1])
+		}
+		if from > to {
+			t.Errorf("DesiredResourcesInDependencyOrder(...): %s at %d should precede %s at %d", b[0], from, b[1], to)
+		}
+	}
+}
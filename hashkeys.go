@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// hashedKeyPrefix prefixes the hashed composition resource names, so they're
+// recognizable in the composite's resourceRefs.
+const hashedKeyPrefix = "resource-"
+
+// hashResourceKey returns the composition resource name of the composed
+// resource with the supplied key. It's a hash of the key, which encodes the
+// resource's logical identity: the network ID, what the resource is, and the
+// index or availability zone it's for.
+func hashResourceKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashedKeyPrefix + hex.EncodeToString(sum[:8])
+}
+
+// hashedResourceKeys returns the hashed composition resource name of each of
+// the supplied composed resources, keyed by its current name.
+func hashedResourceKeys(composedNames map[resource.Name]bool) map[string]string {
+	keys := make(map[string]string, len(composedNames))
+	for name := range composedNames {
+		keys[string(name)] = hashResourceKey(string(name))
+	}
+	return keys
+}
+
+// observedByHashedKey returns the supplied observed composed resources keyed
+// by the names the function generates, rather than their hashed keys. A hash
+// can't be reversed, so it recovers the generated name from the resource's
+// generateName prefix and checks that it hashes to the resource's key. The
+// supplied overrides are those applied before hashing.
+func observedByHashedKey(observed map[resource.Name]resource.ObservedComposed, overrides map[string]string) map[resource.Name]resource.ObservedComposed {
+	out := make(map[resource.Name]resource.ObservedComposed, len(observed))
+	for name, oc := range observed {
+		generated := strings.TrimSuffix(oc.Resource.GetGenerateName(), "-")
+		key := generated
+		if override, ok := overrides[generated]; ok {
+			key = override
+		}
+		if generated != "" && hashResourceKey(key) == string(name) {
+			name = resource.Name(generated)
+		}
+		out[name] = oc
+	}
+	return out
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/names"
+)
+
+func TestRunFunctionHashResourceKeys(t *testing.T) {
+	xr := `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {
+			"id": "code",
+			"count": 1,
+			"region": "us-west-2",
+			"availabilityZones": ["us-west-2a", "us-west-2b"],
+			"privateSubnets": true,
+			"stableResourceKeys": true,
+			"useGenerateName": true,
+			"hashResourceKeys": true
+		}
+	}`
+	run := func(t *testing.T, observed map[string]*fnv1.Resource) *fnv1.RunFunctionResponse {
+		t.Helper()
+		f := &Function{log: logging.NewNopLogger()}
+		req := &fnv1.RunFunctionRequest{
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: observed,
+			},
+		}
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("f.RunFunction(...): unexpected error: %v", err)
+		}
+		return rsp
+	}
+	keysOf := func(rsp *fnv1.RunFunctionResponse) []string {
+		keys := make([]string, 0, len(rsp.GetDesired().GetResources()))
+		for key := range rsp.GetDesired().GetResources() {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	first := run(t, nil)
+	if diff := cmp.Diff([]string(nil), resultMessages(first)); diff != "" {
+		t.Fatalf("first f.RunFunction(...): -want results, +got results:\n%s", diff)
+	}
+	want := []string{
+		hashResourceKey(names.VPCName("code", 0)),
+		hashResourceKey(strings.TrimSuffix(names.SubnetName("code", 0, tierPrivate, 0), "-0") + "-us-west-2a"),
+		hashResourceKey(strings.TrimSuffix(names.SubnetName("code", 0, tierPrivate, 1), "-1") + "-us-west-2b"),
+	}
+	sort.Strings(want)
+	if diff := cmp.Diff(want, keysOf(first)); diff != "" {
+		t.Errorf("first f.RunFunction(...): resources should be keyed by a hash of their stable key: -want, +got:\n%s", diff)
+	}
+
+	// observe the first run's resources as the API server would create
+	// them, with generated names
+	observed := map[string]*fnv1.Resource{}
+	for key, r := range first.GetDesired().GetResources() {
+		p := fieldpath.Pave(r.GetResource().AsMap())
+		gn, _ := p.GetString("metadata.generateName")
+		if !strings.HasSuffix(gn, "-") {
+			t.Fatalf("first f.RunFunction(...): %s has generateName %q, want a prefix ending in -", key, gn)
+		}
+		_ = p.SetValue("metadata.name", gn+"x7k2p")
+		if gn == names.VPCName("code", 0)+"-" {
+			_ = p.SetValue("status.atProvider.id", "vpc-0123456789abcdef0")
+		}
+		s, err := structpb.NewStruct(p.UnstructuredContent())
+		if err != nil {
+			t.Fatalf("structpb.NewStruct(...): unexpected error: %v", err)
+		}
+		observed[key] = &fnv1.Resource{Resource: s}
+	}
+
+	second := run(t, observed)
+	if diff := cmp.Diff(keysOf(first), keysOf(second)); diff != "" {
+		t.Errorf("second f.RunFunction(...): keys should be stable across runs: -want, +got:\n%s", diff)
+	}
+	for key, r := range second.GetDesired().GetResources() {
+		got, _ := fieldpath.Pave(r.GetResource().AsMap()).GetString("metadata.annotations[crossplane.io/composition-resource-name]")
+		if got != key {
+			t.Errorf("second f.RunFunction(...): %s is annotated as %q, want its key", key, got)
+		}
+	}
+
+	// each observed resource should be matched with the one the function
+	// composes despite its hashed key and generated name
+	if diff := cmp.Diff([]string{"0/3 synced, 0/3 ready"}, resultMessages(second)); diff != "" {
+		t.Errorf("second f.RunFunction(...): -want results, +got results:\n%s", diff)
+	}
+	var linked bool
+	for _, r := range second.GetResults() {
+		if r.GetReason() == reasonConsoleLink {
+			linked = true
+		}
+	}
+	if !linked {
+		t.Errorf("second f.RunFunction(...): observed VPC should be matched by its hashed key")
+	}
+}
+
+func TestRunFunctionHashResourceKeysRequiresGenerateName(t *testing.T) {
+	rsp := runXR(t, `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 1, "hashResourceKeys": true}
+	}`)
+	want := []string{"invalid network config: spec.hashResourceKeys: requires spec.useGenerateName"}
+	if diff := cmp.Diff(want, resultMessages(rsp)); diff != "" {
+		t.Errorf("f.RunFunction(...): -want results, +got results:\n%s", diff)
+	}
+}
@@ -0,0 +1,178 @@
+// Package v1beta1 contains the input type for this Function
+// +kubebuilder:object:generate=true
+// +groupName=networks.fn.crossplane.io
+// +versionName=v1beta1
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// This isn't a custom resource, in the sense that we never install its CRD.
+// It is a KRM-like object, so we generate a CRD to describe its schema.
+
+// Input configures this Function. Unlike the XR's spec, which is set by the
+// user requesting a network, Input is set by the platform team authoring the
+// Composition.
+// +kubebuilder:object:root=true
+// +kubebuilder:storageversion
+// +kubebuilder:resource:categories=crossplane
+type Input struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// MaxTotalResources is the most composed resources the Function will
+	// produce for a single XR. The Function returns a fatal result rather
+	// than exceed it. Defaults to 200.
+	// +optional
+	MaxTotalResources *int64 `json:"maxTotalResources,omitempty"`
+
+	// MinCIDRPrefixLength is the prefix length of the largest CIDR block an
+	// XR may set as its spec.cidrBlock. This guards against mistakes like
+	// 10.0.0.0/8. Lower it for networks that divide a larger block among
+	// their VPCs. Each VPC's block is still limited to /16. Defaults to 16.
+	// +optional
+	MinCIDRPrefixLength *int64 `json:"minCidrPrefixLength,omitempty"`
+
+	// AWSAPIVersion pins the API version of the ec2.aws.upbound.io resources
+	// the Function composes, for compositions that must keep targeting a
+	// version across provider upgrades. Only versions the Function is built
+	// with are supported, currently v1beta1 and v1beta2. VPCs, Subnets, and
+	// InternetGateways exist only at v1beta1, so v1beta2 composes only Routes
+	// and VPCEndpoints at v1beta2. Defaults to v1beta1.
+	// +optional
+	AWSAPIVersion *string `json:"awsApiVersion,omitempty"`
+
+	// StripStatus removes status blocks that hold only default values, like
+	// observedGeneration: 0, from desired composed resources. Desired state
+	// shouldn't carry status. Defaults to true.
+	// +optional
+	StripStatus *bool `json:"stripStatus,omitempty"`
+
+	// EmitResourceGroups records which network each composed resource
+	// belongs to in the pipeline context, under the key
+	// networks.fn.crossplane.io/resource-groups, so that later functions in
+	// the pipeline can filter this Function's output. Defaults to false.
+	// +optional
+	EmitResourceGroups *bool `json:"emitResourceGroups,omitempty"`
+
+	// DefaultTagsContextKey is the pipeline context key of a map of tags,
+	// such as a cost center or team, that an earlier function in the pipeline
+	// supplies for every network. Each composed resource gets these tags
+	// beneath the XR's spec.tags, which take precedence. Networks get no
+	// default tags when the key is unset or absent from the context.
+	// +optional
+	DefaultTagsContextKey *string `json:"defaultTagsContextKey,omitempty"`
+
+	// MaxVPCsPerRun is the most VPCs the Function creates at once. VPCs beyond
+	// it, and the resources within them, are deferred until earlier VPCs
+	// have been created. This keeps large networks within provider rate
+	// limits. VPCs that already exist are always composed. Unlimited by
+	// default.
+	// +optional
+	MaxVPCsPerRun *int64 `json:"maxVpcsPerRun,omitempty"`
+
+	// AllowMissingXR tolerates a request without an observed XR, or with an
+	// empty one as an initial render may send, returning without composing
+	// anything rather than a fatal result. An observed XR that can't be
+	// parsed, or that has no ID, is always fatal. Defaults to false.
+	// +optional
+	AllowMissingXR *bool `json:"allowMissingXr,omitempty"`
+
+	// CIDRPlan reads each network's VPC CIDR block from a centrally
+	// maintained allocation plan. It takes precedence over the XR's
+	// spec.cidrBlock. Networks the plan doesn't list fall back to
+	// spec.cidrBlock or its default.
+	// +optional
+	CIDRPlan *CIDRPlan `json:"cidrPlan,omitempty"`
+
+	// CountFrom reads the number of VPCs from a ConfigMap, such as one
+	// updated by an autoscaler, rather than the XR's spec.count. The XR's
+	// count is only used until Crossplane supplies the ConfigMap.
+	// +optional
+	CountFrom *CountFrom `json:"countFrom,omitempty"`
+
+	// ProviderConfigRegion infers the region from the name of the provider
+	// config when the XR doesn't specify one.
+	// +optional
+	ProviderConfigRegion *ProviderConfigRegion `json:"providerConfigRegion,omitempty"`
+
+	// RegionAliases maps friendly region names, like prod-eu, to the AWS
+	// regions they stand for, like eu-central-1. XRs may then use an alias
+	// wherever they'd use a region. When set, a region that isn't an alias
+	// must look like an AWS region.
+	// +optional
+	RegionAliases map[string]string `json:"regionAliases,omitempty"`
+
+	// EnvironmentCIDRPools maps environments, like dev and prod, to the CIDR
+	// pool of XRs in that environment, so networks of different environments
+	// never overlap. An XR that sets spec.environment takes its CIDR block
+	// from the environment's pool, and one that sets spec.cidrBlock too must
+	// stay within it.
+	// +optional
+	EnvironmentCIDRPools map[string]string `json:"environmentCidrPools,omitempty"`
+
+	// RegionCIDRDefaults maps regions to the CIDR block of XRs in that region
+	// that don't set spec.cidrBlock, for organizations that assign each
+	// region its own address range. XRs in other regions use the default
+	// CIDR block.
+	// +optional
+	RegionCIDRDefaults map[string]string `json:"regionCidrDefaults,omitempty"`
+
+	// VPCQuota checks the XR's count against an AWS VPC quota before
+	// composing anything. The Function warns when the count exceeds the
+	// quota, or returns a fatal result if the XR is strict.
+	// +optional
+	VPCQuota *VPCQuota `json:"vpcQuota,omitempty"`
+}
+
+// CIDRPlan is a ConfigMap, keyed by network ID, of VPC CIDR blocks. The
+// Function requires it as an extra resource.
+type CIDRPlan struct {
+	// ConfigMapName is the name of the ConfigMap.
+	ConfigMapName string `json:"configMapName"`
+}
+
+// CountFrom is a key of a ConfigMap that holds a network's count. The Function
+// requires the ConfigMap as an extra resource.
+type CountFrom struct {
+	// ConfigMapName is the name of the ConfigMap.
+	ConfigMapName string `json:"configMapName"`
+
+	// Key of the ConfigMap's data that holds the count, as a non-negative
+	// integer.
+	Key string `json:"key"`
+}
+
+// ProviderConfigRegion infers a region from a provider config name that
+// follows a naming convention, like aws-euc1.
+type ProviderConfigRegion struct {
+	// Pattern is a regular expression matched against the provider config
+	// name. Its first capture group is the region, or a key of Regions.
+	Pattern string `json:"pattern"`
+
+	// Regions maps captured values to regions, for example euc1 to
+	// eu-central-1. Captured values that aren't in the map are used as the
+	// region as is.
+	// +optional
+	Regions map[string]string `json:"regions,omitempty"`
+}
+
+// VPCQuota identifies a resource, such as a provider-aws ServiceQuota, that
+// reports how many VPCs a region allows. The Function requires it as an extra
+// resource.
+type VPCQuota struct {
+	// APIVersion of the quota resource.
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the quota resource.
+	Kind string `json:"kind"`
+
+	// Name of the quota resource.
+	Name string `json:"name"`
+
+	// ValuePath is the field path of the quota's value within the resource.
+	// Defaults to status.atProvider.value.
+	// +optional
+	ValuePath *string `json:"valuePath,omitempty"`
+}
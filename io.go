@@ -0,0 +1,90 @@
+package main
+
+import (
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/response"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// errNoObservedXR is returned by an IO asked for the observed XR of a request
+// that doesn't have one.
+var errNoObservedXR = errors.New("request has no observed composite resource")
+
+// An IO reads state from a RunFunctionRequest and writes desired state to a
+// RunFunctionResponse.
+type IO interface {
+	GetObservedCompositeResource(req *fnv1.RunFunctionRequest) (*resource.Composite, error)
+	GetInput(req *fnv1.RunFunctionRequest, into runtime.Object) error
+	GetDesiredComposedResources(req *fnv1.RunFunctionRequest) (map[resource.Name]*resource.DesiredComposed, error)
+	GetObservedComposedResources(req *fnv1.RunFunctionRequest) (map[resource.Name]resource.ObservedComposed, error)
+	GetExtraResources(req *fnv1.RunFunctionRequest) (map[string][]resource.Extra, error)
+	GetDesiredCompositeResource(req *fnv1.RunFunctionRequest) (*resource.Composite, error)
+	GetContextKey(req *fnv1.RunFunctionRequest, key string) (*structpb.Value, bool)
+	SetDesiredComposedResources(rsp *fnv1.RunFunctionResponse, dcds map[resource.Name]*resource.DesiredComposed) error
+	SetDesiredCompositeResource(rsp *fnv1.RunFunctionResponse, xr *resource.Composite) error
+	SetContextKey(rsp *fnv1.RunFunctionResponse, key string, v *structpb.Value)
+}
+
+// An SDKIO is an IO backed by the function SDK's request and response
+// packages.
+type SDKIO struct{}
+
+// GetObservedCompositeResource from the supplied request. It returns
+// errNoObservedXR if the request has none, or only an empty object, which is
+// what an initial render without observed state may send.
+func (SDKIO) GetObservedCompositeResource(req *fnv1.RunFunctionRequest) (*resource.Composite, error) {
+	if len(req.GetObserved().GetComposite().GetResource().GetFields()) == 0 {
+		return nil, errNoObservedXR
+	}
+	return request.GetObservedCompositeResource(req)
+}
+
+// GetInput from the supplied request.
+func (SDKIO) GetInput(req *fnv1.RunFunctionRequest, into runtime.Object) error {
+	return request.GetInput(req, into)
+}
+
+// GetDesiredComposedResources from the supplied request.
+func (SDKIO) GetDesiredComposedResources(req *fnv1.RunFunctionRequest) (map[resource.Name]*resource.DesiredComposed, error) {
+	return request.GetDesiredComposedResources(req)
+}
+
+// GetObservedComposedResources from the supplied request.
+func (SDKIO) GetObservedComposedResources(req *fnv1.RunFunctionRequest) (map[resource.Name]resource.ObservedComposed, error) {
+	return request.GetObservedComposedResources(req)
+}
+
+// GetExtraResources from the supplied request.
+func (SDKIO) GetExtraResources(req *fnv1.RunFunctionRequest) (map[string][]resource.Extra, error) {
+	return request.GetExtraResources(req)
+}
+
+// GetDesiredCompositeResource from the supplied request.
+func (SDKIO) GetDesiredCompositeResource(req *fnv1.RunFunctionRequest) (*resource.Composite, error) {
+	return request.GetDesiredCompositeResource(req)
+}
+
+// GetContextKey from the pipeline context of the supplied request.
+func (SDKIO) GetContextKey(req *fnv1.RunFunctionRequest, key string) (*structpb.Value, bool) {
+	return request.GetContextKey(req, key)
+}
+
+// SetDesiredComposedResources of the supplied response.
+func (SDKIO) SetDesiredComposedResources(rsp *fnv1.RunFunctionResponse, dcds map[resource.Name]*resource.DesiredComposed) error {
+	return response.SetDesiredComposedResources(rsp, dcds)
+}
+
+// SetDesiredCompositeResource of the supplied response.
+func (SDKIO) SetDesiredCompositeResource(rsp *fnv1.RunFunctionResponse, xr *resource.Composite) error {
+	return response.SetDesiredCompositeResource(rsp, xr)
+}
+
+// SetContextKey in the pipeline context of the supplied response.
+func (SDKIO) SetContextKey(rsp *fnv1.RunFunctionResponse, key string, v *structpb.Value) {
+	response.SetContextKey(rsp, key, v)
+}
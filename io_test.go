@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+
+	"github.com/jbw976/demo-xfn-network/input/v1beta1"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+)
+
+// fakeIO is an in-memory IO. It serves the supplied state and pipeline context,
+// and records the desired composed resources and context keys set on the
+// response.
+type fakeIO struct {
+	oxr      *resource.Composite
+	in       *v1beta1.Input
+	observed map[resource.Name]resource.ObservedComposed
+	context  map[string]*structpb.Value
+	err      error
+	setErr   error
+
+	set        map[resource.Name]*resource.DesiredComposed
+	setContext map[string]*structpb.Value
+}
+
+func (f *fakeIO) GetObservedCompositeResource(_ *fnv1.RunFunctionRequest) (*resource.Composite, error) {
+	return f.oxr, f.err
+}
+
+func (f *fakeIO) GetInput(_ *fnv1.RunFunctionRequest, into runtime.Object) error {
+	if f.in != nil {
+		f.in.DeepCopyInto(into.(*v1beta1.Input))
+	}
+	return nil
+}
+
+func (f *fakeIO) GetDesiredComposedResources(_ *fnv1.RunFunctionRequest) (map[resource.Name]*resource.DesiredComposed, error) {
+	return map[resource.Name]*resource.DesiredComposed{}, nil
+}
+
+func (f *fakeIO) GetObservedComposedResources(_ *fnv1.RunFunctionRequest) (map[resource.Name]resource.ObservedComposed, error) {
+	return f.observed, nil
+}
+
+func (f *fakeIO) GetExtraResources(_ *fnv1.RunFunctionRequest) (map[string][]resource.Extra, error) {
+	return map[string][]resource.Extra{}, nil
+}
+
+func (f *fakeIO) GetDesiredCompositeResource(_ *fnv1.RunFunctionRequest) (*resource.Composite, error) {
+	return &resource.Composite{Resource: composite.New()}, nil
+}
+
+func (f *fakeIO) GetContextKey(_ *fnv1.RunFunctionRequest, key string) (*structpb.Value, bool) {
+	v, ok := f.context[key]
+	return v, ok
+}
+
+func (f *fakeIO) SetContextKey(_ *fnv1.RunFunctionResponse, key string, v *structpb.Value) {
+	if f.setContext == nil {
+		f.setContext = map[string]*structpb.Value{}
+	}
+	f.setContext[key] = v
+}
+
+func (f *fakeIO) SetDesiredCompositeResource(_ *fnv1.RunFunctionResponse, _ *resource.Composite) error {
+	return nil
+}
+
+func (f *fakeIO) SetDesiredComposedResources(_ *fnv1.RunFunctionResponse, dcds map[resource.Name]*resource.DesiredComposed) error {
+	f.set = dcds
+	return f.setErr
+}
+
+func TestRunFunctionIO(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	xr := func() *resource.Composite {
+		oxr := &resource.Composite{Resource: composite.New()}
+		oxr.Resource.SetName("network-code")
+		_ = oxr.Resource.SetValue("spec", map[string]any{
+			"id":             "code",
+			"count":          int64(2),
+			"includeGateway": true,
+		})
+		return oxr
+	}
+
+	type want struct {
+		set     []string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		io     *fakeIO
+		want   want
+	}{
+		"InMemory": {
+			reason: "The function should read its XR from and set its desired resources on the supplied IO",
+			io:     &fakeIO{oxr: xr()},
+			want: want{
+				set: []string{"gateway-code-0", "gateway-code-1", "vpc-code-0", "vpc-code-1"},
+			},
+		},
+		"GetXRError": {
+			reason: "An XR the IO can't get should return a fatal result",
+			io:     &fakeIO{err: errBoom},
+			want: want{
+				results: []string{"cannot get observed XR: boom"},
+			},
+		},
+		"MalformedXR": {
+			reason: "An XR the IO can't parse should return a fatal result, even when the input allows a missing XR",
+			io:     &fakeIO{err: errBoom, in: &v1beta1.Input{AllowMissingXR: ptr.To(true)}},
+			want: want{
+				results: []string{"cannot get observed XR: boom"},
+			},
+		},
+		"SetDesiredError": {
+			reason: "Desired resources the IO can't set should return a fatal result",
+			io:     &fakeIO{oxr: xr(), setErr: errBoom},
+			want: want{
+				set:     []string{"gateway-code-0", "gateway-code-1", "vpc-code-0", "vpc-code-1"},
+				results: []string{"cannot set desired composed resources in *v1.RunFunctionResponse: boom"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), io: tc.io}
+			rsp, err := f.RunFunction(context.Background(), &fnv1.RunFunctionRequest{})
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var set []string
+			for name := range tc.io.set {
+				set = append(set, string(name))
+			}
+			sort.Strings(set)
+			if diff := cmp.Diff(tc.want.set, set); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want set desired resources, +got set desired resources:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionIOContext(t *testing.T) {
+	oxr := &resource.Composite{Resource: composite.New()}
+	oxr.Resource.SetName("network-code")
+	_ = oxr.Resource.SetValue("spec", map[string]any{"id": "code", "count": int64(1)})
+
+	groups, _ := structpb.NewStruct(map[string]any{"vpc-other-0": "other"})
+	io := &fakeIO{
+		oxr:     oxr,
+		in:      &v1beta1.Input{EmitResourceGroups: ptr.To(true)},
+		context: map[string]*structpb.Value{contextKeyResourceGroups: structpb.NewStructValue(groups)},
+	}
+	f := &Function{log: logging.NewNopLogger(), io: io}
+	rsp, err := f.RunFunction(context.Background(), &fnv1.RunFunctionRequest{})
+	if err != nil {
+		t.Fatalf("f.RunFunction(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string(nil), resultMessages(rsp)); diff != "" {
+		t.Errorf("f.RunFunction(...): -want results, +got results:\n%s", diff)
+	}
+
+	want, _ := structpb.NewStruct(map[string]any{"vpc-other-0": "other", "vpc-code-0": "code"})
+	if diff := cmp.Diff(map[string]*structpb.Value{contextKeyResourceGroups: structpb.NewStructValue(want)}, io.setContext, protocmp.Transform()); diff != "" {
+		t.Errorf("f.RunFunction(...): resource groups should be read from and written to the IO's context: -want, +got:\n%s", diff)
+	}
+}
+
+func TestRunFunctionIODefaultTags(t *testing.T) {
+	oxr := &resource.Composite{Resource: composite.New()}
+	oxr.Resource.SetName("network-code")
+	_ = oxr.Resource.SetValue("spec", map[string]any{"id": "code", "count": int64(1)})
+
+	tags, _ := structpb.NewStruct(map[string]any{"cost-center": "1234"})
+	io := &fakeIO{
+		oxr:     oxr,
+		in:      &v1beta1.Input{DefaultTagsContextKey: ptr.To("example.org/tags")},
+		context: map[string]*structpb.Value{"example.org/tags": structpb.NewStructValue(tags)},
+	}
+	f := &Function{log: logging.NewNopLogger(), io: io}
+	rsp, err := f.RunFunction(context.Background(), &fnv1.RunFunctionRequest{})
+	if err != nil {
+		t.Fatalf("f.RunFunction(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string(nil), resultMessages(rsp)); diff != "" {
+		t.Errorf("f.RunFunction(...): -want results, +got results:\n%s", diff)
+	}
+
+	vpc, ok := io.set["vpc-code-0"]
+	if !ok {
+		t.Fatalf("f.RunFunction(...): want desired VPC vpc-code-0")
+	}
+	got, _ := vpc.Resource.GetString("spec.forProvider.tags[cost-center]")
+	if diff := cmp.Diff("1234", got); diff != "" {
+		t.Errorf("f.RunFunction(...): default tags should be read from the IO's context: -want, +got:\n%s", diff)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/input/v1beta1"
+)
+
+// resourceCount is the number of resources of a kind the function plans to
+// compose.
+type resourceCount struct {
+	Kind  string
+	Count int64
+}
+
+// plannedResources returns how many resources of each kind the function will
+// compose for the supplied config. Kinds that won't be composed are omitted.
+func plannedResources(cfg Config) []resourceCount {
+	gateways, subnets, groups, prefixLists, securityGroups := int64(0), int64(0), int64(0), int64(0), int64(0)
+	routeTables, routes, assocs := int64(0), int64(0), int64(0)
+	endpoints, endpointAssocs := int64(0), int64(0)
+	eips, natGateways := int64(0), int64(0)
+	firewalls := int64(0)
+	for i := range cfg.Count {
+		// private VPCs compose fewer resources than the others
+		c := cfg.forVPC(i)
+		if c.IncludeGateway {
+			gateways++
+		}
+		subnets += int64(len(c.subnetTiers()) * len(c.AvailabilityZones))
+		if c.CreateDBSubnetGroup {
+			groups++
+		}
+		if c.LockdownDefaultSG {
+			securityGroups++
+		}
+		if c.routesPublicSubnets() {
+			routeTables++
+			routes += int64(len(c.igwRouteCIDRs()))
+			assocs += int64(len(c.AvailabilityZones))
+			if c.S3GatewayEndpoint {
+				endpoints++
+				endpointAssocs++
+			}
+		}
+		if c.routesPrivateSubnetsPerAZ() {
+			routeTables += int64(len(c.AvailabilityZones))
+			assocs += int64(len(c.AvailabilityZones))
+		}
+		if c.deploysNetworkFirewall() {
+			firewalls++
+		}
+		if azs := int64(len(c.natGatewayAZs())); azs > 0 {
+			eips += azs
+			natGateways += azs
+			routes += int64(len(c.AvailabilityZones))
+		}
+	}
+	if cfg.PrefixList != nil {
+		prefixLists = 1
+	}
+
+	all := []resourceCount{
+		{Kind: "VPC", Count: cfg.Count},
+		{Kind: "InternetGateway", Count: gateways},
+		{Kind: "Subnet", Count: subnets},
+		{Kind: "SubnetGroup", Count: groups},
+		{Kind: "RouteTable", Count: routeTables},
+		{Kind: "Route", Count: routes},
+		{Kind: "RouteTableAssociation", Count: assocs},
+		{Kind: "DefaultSecurityGroup", Count: securityGroups},
+		{Kind: "EIP", Count: eips},
+		{Kind: "NATGateway", Count: natGateways},
+		{Kind: "RuleGroup", Count: firewalls},
+		{Kind: "FirewallPolicy", Count: firewalls},
+		{Kind: "Firewall", Count: firewalls},
+		{Kind: "VPCEndpoint", Count: endpoints},
+		{Kind: "VPCEndpointRouteTableAssociation", Count: endpointAssocs},
+		{Kind: "ManagedPrefixList", Count: prefixLists},
+	}
+
+	counts := make([]resourceCount, 0, len(all))
+	for _, rc := range all {
+		if rc.Count > 0 {
+			counts = append(counts, rc)
+		}
+	}
+	return counts
+}
+
+// checkResourceLimit returns an error if the supplied config would compose
+// more resources than the input allows.
+func checkResourceLimit(cfg Config, in *v1beta1.Input) error {
+	limit := resourceLimit(in)
+
+	// plannedResources visits every VPC, which takes too long for a huge
+	// count, and the VPCs alone are already too many
+	if cfg.Count > limit {
+		return errors.Errorf("refusing to compose %d VPCs, more than the maximum of %d resources", cfg.Count, limit)
+	}
+
+	counts := plannedResources(cfg)
+	total := int64(0)
+	for _, rc := range counts {
+		total += rc.Count
+	}
+	if total <= limit {
+		return nil
+	}
+
+	parts := make([]string, len(counts))
+	for i, rc := range counts {
+		parts[i] = fmt.Sprintf("%d %s", rc.Count, rc.Kind)
+	}
+	return errors.Errorf("refusing to compose %d resources, more than the maximum of %d (%s)", total, limit, strings.Join(parts, ", "))
+}
+
+// checkUsageLimit returns an error if the supplied config's resources, plus
+// the supplied number of Usages between them, are more than the input allows.
+// Usages are derived from the built resources, so they can only be counted
+// once those are.
+func checkUsageLimit(cfg Config, in *v1beta1.Input, usages int) error {
+	limit := resourceLimit(in)
+	total := int64(usages)
+	for _, rc := range plannedResources(cfg) {
+		total += rc.Count
+	}
+	if total > limit {
+		return errors.Errorf("refusing to compose %d resources, including %d Usages, more than the maximum of %d", total, usages, limit)
+	}
+	return nil
+}
+
+// resourceLimit returns the most composed resources the input allows.
+func resourceLimit(in *v1beta1.Input) int64 {
+	if in.MaxTotalResources != nil {
+		return *in.MaxTotalResources
+	}
+	return defaultMaxTotalResources
+}
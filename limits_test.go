@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionResourceLimit(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		input  string
+		xr     string
+		want   []string
+	}{
+		"DefaultLimitExceeded": {
+			reason: "A high count with every feature enabled should trip the default limit, with a breakdown by kind",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 40,
+					"includeGateway": true,
+					"availabilityZones": ["eu-central-1a", "eu-central-1b"],
+					"publicSubnets": true,
+					"privateSubnets": true,
+					"createDbSubnetGroup": true
+				}
+			}`,
+			want: []string{"refusing to compose 440 resources, more than the maximum of 200 (40 VPC, 40 InternetGateway, 160 Subnet, 40 SubnetGroup, 40 RouteTable, 40 Route, 80 RouteTableAssociation)"},
+		},
+		"WithinDefaultLimit": {
+			reason: "A config within the default limit should be composed",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 100, "includeGateway": true}
+			}`,
+		},
+		"InputLimitExceeded": {
+			reason: "A limit set in the Function's input should override the default",
+			input: `{
+				"apiVersion": "networks.fn.crossplane.io/v1beta1",
+				"kind": "Input",
+				"maxTotalResources": 3
+			}`,
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {"id": "code", "count": 2, "includeGateway": true}
+			}`,
+			want: []string{"refusing to compose 4 resources, more than the maximum of 3 (2 VPC, 2 InternetGateway)"},
+		},
+		"TooManyVPCs": {
+			reason: "A count far above the limit should be refused without overflowing the planned total",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1000000000000000000,
+					"includeGateway": true,
+					"availabilityZones": ["eu-central-1a", "eu-central-1b"],
+					"publicSubnets": true,
+					"privateSubnets": true
+				}
+			}`,
+			want: []string{"refusing to compose 1000000000000000000 VPCs, more than the maximum of 200 resources"},
+		},
+		"PrivateVPCs": {
+			reason: "Private VPCs' gateways and public subnets shouldn't count toward the limit",
+			input: `{
+				"apiVersion": "networks.fn.crossplane.io/v1beta1",
+				"kind": "Input",
+				"maxTotalResources": 7
+			}`,
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 2,
+					"includeGateway": true,
+					"publicSubnets": true,
+					"privateSubnets": true,
+					"availabilityZones": ["eu-central-1a"],
+					"privateVpcIndexes": [1]
+				}
+			}`,
+			want: []string{"refusing to compose 9 resources, more than the maximum of 7 (2 VPC, 1 InternetGateway, 3 Subnet, 1 RouteTable, 1 Route, 1 RouteTableAssociation)"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			if tc.input != "" {
+				req.Input = resource.MustStructJSON(tc.input)
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -2,11 +2,21 @@
 package main
 
 import (
+	"context"
+	"os"
+
 	"github.com/alecthomas/kong"
 
 	"github.com/crossplane/function-sdk-go"
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/config"
 )
 
+// Version of this Function. It's set at build time, e.g. with
+// -ldflags "-X main.Version=v0.1.0".
+var Version = "dev"
+
 // CLI of this Function.
 type CLI struct {
 	Debug bool `short:"d" help:"Emit debug logs in addition to info logs."`
@@ -15,6 +25,14 @@ type CLI struct {
 	Address     string `help:"Address at which to listen for gRPC connections." default:":9443"`
 	TLSCertsDir string `help:"Directory containing server certs (tls.key, tls.crt) and the CA used to verify client certificates (ca.crt)" env:"TLS_SERVER_CERTS_DIR"`
 	Insecure    bool   `help:"Run without mTLS credentials. If you supply this flag --tls-server-certs-dir will be ignored."`
+
+	DefaultRegion         string `help:"Region to use for XRs that don't specify one." env:"XFN_DEFAULT_REGION"`
+	DefaultProviderConfig string `help:"ProviderConfig to use for XRs that don't specify one." env:"XFN_DEFAULT_PROVIDER_CONFIG"`
+	DefaultCIDR           string `help:"VPC CIDR block to use for XRs that don't specify one." env:"XFN_DEFAULT_CIDR"`
+
+	DumpRequests string `help:"Write each RunFunctionRequest as JSON to a new file in this directory before processing it, for reproducing issues. Requests can hold connection details, so never set this in production." env:"XFN_DUMP_REQUEST" type:"existingdir" placeholder:"DIR"`
+
+	Render string `help:"Instead of serving gRPC, run once against the RunFunctionRequest in this YAML or JSON file and print the desired resources to stdout." type:"existingfile" placeholder:"REQUEST"`
 }
 
 // Run this Function.
@@ -24,12 +42,40 @@ func (c *CLI) Run() error {
 		return err
 	}
 
-	return function.Serve(&Function{log: log},
+	d, err := c.defaults()
+	if err != nil {
+		return err
+	}
+	f := &Function{log: log, defaults: d, dumpDir: c.DumpRequests}
+	if c.DumpRequests != "" {
+		log.Info("Writing every request to disk; don't do this in production", "dir", c.DumpRequests)
+	}
+
+	if c.Render != "" {
+		return render(context.Background(), f, c.Render, os.Stdout)
+	}
+
+	return function.Serve(f,
 		function.Listen(c.Network, c.Address),
 		function.MTLSCertificates(c.TLSCertsDir),
 		function.Insecure(c.Insecure))
 }
 
+// defaults returns the deployment-wide defaults configured by flags or
+// environment variables, failing fast if any are invalid.
+func (c *CLI) defaults() (config.Defaults, error) {
+	if c.DefaultCIDR != "" {
+		if err := validateVPCCIDR(c.DefaultCIDR); err != nil {
+			return config.Defaults{}, errors.Wrap(err, "invalid default CIDR block")
+		}
+	}
+	return config.Defaults{
+		Region:             c.DefaultRegion,
+		ProviderConfigName: c.DefaultProviderConfig,
+		CIDRBlock:          c.DefaultCIDR,
+	}, nil
+}
+
 func main() {
 	ctx := kong.Parse(&CLI{}, kong.Description("A Crossplane Composition Function."))
 	ctx.FatalIfErrorf(ctx.Run())
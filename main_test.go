@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/jbw976/demo-xfn-network/config"
+)
+
+func TestCLIDefaults(t *testing.T) {
+	type want struct {
+		d   config.Defaults
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		env    map[string]string
+		want   want
+	}{
+		"Unset": {
+			reason: "Without any environment variables there should be no deployment-wide defaults",
+			want:   want{d: config.Defaults{}},
+		},
+		"FromEnvironment": {
+			reason: "Defaults should be read from the environment",
+			env: map[string]string{
+				"XFN_DEFAULT_CIDR":            "10.0.0.0/16",
+				"XFN_DEFAULT_REGION":          "us-east-1",
+				"XFN_DEFAULT_PROVIDER_CONFIG": "shared",
+			},
+			want: want{d: config.Defaults{Region: "us-east-1", ProviderConfigName: "shared", CIDRBlock: "10.0.0.0/16"}},
+		},
+		"InvalidCIDR": {
+			reason: "A default CIDR that doesn't parse should return an error",
+			env:    map[string]string{"XFN_DEFAULT_CIDR": "10.0.0.0"},
+			want:   want{err: true},
+		},
+		"CIDROutOfRange": {
+			reason: "A default CIDR larger than AWS allows for a VPC should return an error",
+			env:    map[string]string{"XFN_DEFAULT_CIDR": "10.0.0.0/8"},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			c := &CLI{}
+			p, err := kong.New(c)
+			if err != nil {
+				t.Fatalf("kong.New(...): unexpected error: %v", err)
+			}
+			if _, err := p.Parse([]string{"--insecure"}); err != nil {
+				t.Fatalf("p.Parse(...): unexpected error: %v", err)
+			}
+
+			d, err := c.defaults()
+			if diff := cmp.Diff(tc.want.d, d); diff != "" {
+				t.Errorf("%s\nc.defaults(): -want, +got:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != (err != nil) {
+				t.Errorf("%s\nc.defaults(): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+		})
+	}
+}
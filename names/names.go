@@ -0,0 +1,134 @@
+// Package names is the single source of truth for the names of the resources
+// the function composes for a network. Downstream functions can use it to
+// find, for example, the gateway of a network's third VPC without re-deriving
+// the naming scheme.
+package names
+
+import "fmt"
+
+// VPCName returns the name of the i'th VPC of the supplied network.
+func VPCName(id string, i int64) string {
+	return fmt.Sprintf("vpc-%s-%d", id, i)
+}
+
+// GatewayName returns the name of the InternetGateway of the i'th VPC of the
+// supplied network.
+func GatewayName(id string, i int64) string {
+	return fmt.Sprintf("gateway-%s-%d", id, i)
+}
+
+// SubnetName returns the name of the j'th subnet of the supplied tier, such as
+// public, in the i'th VPC of the supplied network.
+func SubnetName(id string, i int64, tier string, j int) string {
+	return fmt.Sprintf("subnet-%s-%d-%s-%d", id, i, tier, j)
+}
+
+// RouteTableName returns the name of the route table of the supplied subnet
+// tier in the i'th VPC of the supplied network.
+func RouteTableName(id string, i int64, tier string) string {
+	return fmt.Sprintf("routetable-%s-%d-%s", id, i, tier)
+}
+
+// AZRouteTableName returns the name of the route table of the supplied subnet
+// tier in the j'th availability zone of the i'th VPC of the supplied network.
+func AZRouteTableName(id string, i int64, tier string, j int) string {
+	return fmt.Sprintf("routetable-%s-%d-%s-%d", id, i, tier, j)
+}
+
+// RouteName returns the name of the j'th route of the supplied subnet tier's
+// route table in the i'th VPC of the supplied network.
+func RouteName(id string, i int64, tier string, j int) string {
+	return fmt.Sprintf("route-%s-%d-%s-%d", id, i, tier, j)
+}
+
+// RouteTableAssociationName returns the name of the association between the
+// named subnet and its route table.
+func RouteTableAssociationName(subnet string) string {
+	return fmt.Sprintf("rtassoc-%s", subnet)
+}
+
+// DefaultSecurityGroupName returns the name of the default security group of
+// the i'th VPC of the supplied network.
+func DefaultSecurityGroupName(id string, i int64) string {
+	return fmt.Sprintf("defaultsg-%s-%d", id, i)
+}
+
+// DBSubnetGroupName returns the name of the DB subnet group of the i'th VPC of
+// the supplied network.
+func DBSubnetGroupName(id string, i int64) string {
+	return fmt.Sprintf("dbsubnetgroup-%s-%d", id, i)
+}
+
+// PrefixListName returns the name of the managed prefix list of the supplied
+// network.
+func PrefixListName(id string) string {
+	return fmt.Sprintf("prefixlist-%s", id)
+}
+
+// EIPName returns the name of the Elastic IP of the NAT gateway in the j'th
+// availability zone of the i'th VPC of the supplied network.
+func EIPName(id string, i int64, j int) string {
+	return fmt.Sprintf("eip-%s-%d-%d", id, i, j)
+}
+
+// NATGatewayName returns the name of the NAT gateway in the j'th availability
+// zone of the i'th VPC of the supplied network.
+func NATGatewayName(id string, i int64, j int) string {
+	return fmt.Sprintf("natgateway-%s-%d-%d", id, i, j)
+}
+
+// NATRouteName returns the name of the route to a NAT gateway from the private
+// route table of the j'th availability zone of the i'th VPC of the supplied
+// network.
+func NATRouteName(id string, i int64, j int) string {
+	return fmt.Sprintf("natroute-%s-%d-%d", id, i, j)
+}
+
+// FirewallName returns the name of the Network Firewall of the i'th VPC of the
+// supplied network.
+func FirewallName(id string, i int64) string {
+	return fmt.Sprintf("firewall-%s-%d", id, i)
+}
+
+// FirewallPolicyName returns the name of the policy of the Network Firewall of
+// the i'th VPC of the supplied network.
+func FirewallPolicyName(id string, i int64) string {
+	return fmt.Sprintf("firewallpolicy-%s-%d", id, i)
+}
+
+// FirewallRuleGroupName returns the name of the stateless rule group of the
+// Network Firewall of the i'th VPC of the supplied network.
+func FirewallRuleGroupName(id string, i int64) string {
+	return fmt.Sprintf("firewallrulegroup-%s-%d", id, i)
+}
+
+// S3EndpointName returns the name of the S3 gateway endpoint of the i'th VPC of
+// the supplied network.
+func S3EndpointName(id string, i int64) string {
+	return fmt.Sprintf("s3endpoint-%s-%d", id, i)
+}
+
+// S3EndpointAssociationName returns the name of the association between the
+// S3 gateway endpoint of the i'th VPC of the supplied network and the route
+// table of the supplied subnet tier.
+func S3EndpointAssociationName(id string, i int64, tier string) string {
+	return fmt.Sprintf("s3endpoint-%s-%d-%s", id, i, tier)
+}
+
+// UsageName returns the name of the Usage that marks the named resource as used
+// by the named dependent resource.
+func UsageName(of, by string) string {
+	return fmt.Sprintf("usage-%s-by-%s", of, by)
+}
+
+// VPCNameTag returns the deterministic Name tag of the i'th VPC of the
+// supplied network.
+func VPCNameTag(id string, i int64) string {
+	return fmt.Sprintf("%s-vpc-%d", id, i)
+}
+
+// ConnectionSecretName returns the name of the secret the named resource writes
+// its connection details to.
+func ConnectionSecretName(resource string) string {
+	return fmt.Sprintf("%s-connection", resource)
+}
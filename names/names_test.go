@@ -0,0 +1,131 @@
+package names
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// These formats are relied on by downstream functions and by the names of
+// resources that already exist, so they must never change.
+func TestNames(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		got    string
+		want   string
+	}{
+		"VPC": {
+			reason: "VPCs should be named for their network and index",
+			got:    VPCName("code", 2),
+			want:   "vpc-code-2",
+		},
+		"VPCNameTag": {
+			reason: "VPC Name tags should be derived from their network and index",
+			got:    VPCNameTag("code", 2),
+			want:   "code-vpc-2",
+		},
+		"Gateway": {
+			reason: "InternetGateways should be named for their VPC's network and index",
+			got:    GatewayName("code", 2),
+			want:   "gateway-code-2",
+		},
+		"Subnet": {
+			reason: "Subnets should be named for their VPC, tier, and index within the tier",
+			got:    SubnetName("code", 2, "public", 1),
+			want:   "subnet-code-2-public-1",
+		},
+		"RouteTable": {
+			reason: "Route tables should be named for their VPC and tier",
+			got:    RouteTableName("code", 2, "public"),
+			want:   "routetable-code-2-public",
+		},
+		"EIP": {
+			reason: "Elastic IPs should be named for their VPC and AZ index",
+			got:    EIPName("code", 2, 1),
+			want:   "eip-code-2-1",
+		},
+		"NATGateway": {
+			reason: "NAT gateways should be named for their VPC and AZ index",
+			got:    NATGatewayName("code", 2, 1),
+			want:   "natgateway-code-2-1",
+		},
+		"NATRoute": {
+			reason: "Routes to a NAT gateway should be named for their VPC and AZ index",
+			got:    NATRouteName("code", 2, 1),
+			want:   "natroute-code-2-1",
+		},
+		"Firewall": {
+			reason: "Network Firewalls should be named for their VPC",
+			got:    FirewallName("code", 2),
+			want:   "firewall-code-2",
+		},
+		"FirewallPolicy": {
+			reason: "Firewall policies should be named for their VPC",
+			got:    FirewallPolicyName("code", 2),
+			want:   "firewallpolicy-code-2",
+		},
+		"FirewallRuleGroup": {
+			reason: "Firewall rule groups should be named for their VPC",
+			got:    FirewallRuleGroupName("code", 2),
+			want:   "firewallrulegroup-code-2",
+		},
+		"Usage": {
+			reason: "Usages should be named for the resource they're of and the resource they're by",
+			got:    UsageName("vpc-code-2", "subnet-code-2-public-1"),
+			want:   "usage-vpc-code-2-by-subnet-code-2-public-1",
+		},
+		"AZRouteTable": {
+			reason: "Per-AZ route tables should be named for their VPC, tier, and AZ index",
+			got:    AZRouteTableName("code", 2, "private", 1),
+			want:   "routetable-code-2-private-1",
+		},
+		"Route": {
+			reason: "Routes should be named for their route table and index",
+			got:    RouteName("code", 2, "public", 1),
+			want:   "route-code-2-public-1",
+		},
+		"RouteTableAssociation": {
+			reason: "Route table associations should be named for their subnet",
+			got:    RouteTableAssociationName("subnet-code-2-public-1"),
+			want:   "rtassoc-subnet-code-2-public-1",
+		},
+		"DefaultSecurityGroup": {
+			reason: "Default security groups should be named for their VPC",
+			got:    DefaultSecurityGroupName("code", 2),
+			want:   "defaultsg-code-2",
+		},
+		"DBSubnetGroup": {
+			reason: "DB subnet groups should be named for their VPC",
+			got:    DBSubnetGroupName("code", 2),
+			want:   "dbsubnetgroup-code-2",
+		},
+		"S3Endpoint": {
+			reason: "S3 gateway endpoints should be named for their VPC",
+			got:    S3EndpointName("code", 2),
+			want:   "s3endpoint-code-2",
+		},
+		"S3EndpointAssociation": {
+			reason: "S3 gateway endpoint associations should be named for their endpoint and route table's tier",
+			got:    S3EndpointAssociationName("code", 2, "public"),
+			want:   "s3endpoint-code-2-public",
+		},
+		"PrefixList": {
+			reason: "The prefix list should be named for its network",
+			got:    PrefixListName("code"),
+			want:   "prefixlist-code",
+		},
+		"ConnectionSecret": {
+			reason: "Connection secrets should be named for their resource",
+			got:    ConnectionSecretName("vpc-code-2"),
+			want:   "vpc-code-2-connection",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.got); diff != "" {
+				t.Errorf("%s\n-want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+
+	"github.com/jbw976/demo-xfn-network/config"
+
+	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+)
+
+// natDestination is the destination routed from private subnets to their NAT
+// gateway.
+const natDestination = "0.0.0.0/0"
+
+// validateNATGatewayStrategy returns a ValidationError if the NAT gateway
+// strategy is unknown, or the config lacks the subnets it needs. NAT gateways
+// are placed in public subnets, which need an InternetGateway to reach the
+// internet, and only private subnets are routed to them.
+func (c Config) validateNATGatewayStrategy() error {
+	switch c.NATGatewayStrategy {
+	case "":
+		return nil
+	case config.NATStrategySingle, config.NATStrategyPerAZ:
+	default:
+		return &ValidationError{Field: "spec.natGatewayStrategy", Reason: fmt.Sprintf("must be %q or %q, got %q", config.NATStrategySingle, config.NATStrategyPerAZ, c.NATGatewayStrategy)}
+	}
+	if !c.routesPublicSubnets() || !c.PrivateSubnets {
+		return &ValidationError{Field: "spec.natGatewayStrategy", Reason: "requires spec.includeGateway, spec.publicSubnets, spec.privateSubnets, and at least one availability zone"}
+	}
+	return nil
+}
+
+// natGatewayAZs returns the indexes of the availability zones that get a NAT
+// gateway, or none if the config places no NAT gateways.
+func (c Config) natGatewayAZs() []int {
+	if c.NATGatewayStrategy == "" || !c.routesPublicSubnets() || !c.PrivateSubnets {
+		return nil
+	}
+	if c.NATGatewayStrategy == config.NATStrategySingle {
+		return []int{0}
+	}
+	azs := make([]int, len(c.AvailabilityZones))
+	for j := range azs {
+		azs[j] = j
+	}
+	return azs
+}
+
+// natGatewayAZ returns the index of the availability zone of the NAT gateway
+// that the private subnets of the j'th availability zone are routed to.
+func (c Config) natGatewayAZ(j int) int {
+	if c.NATGatewayStrategy == config.NATStrategySingle {
+		return 0
+	}
+	return j
+}
+
+// newEIP returns an Elastic IP with the supplied name, for a NAT gateway.
+func newEIP(cfg Config, name string) *awsv1beta1.EIP {
+	return &awsv1beta1.EIP{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+			}),
+		},
+		Spec: awsv1beta1.EIPSpec{
+			ForProvider: awsv1beta1.EIPParameters{
+				Region: ptr.To(cfg.Region),
+				Domain: ptr.To("vpc"),
+				Tags:   tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+}
+
+// newNATGateway returns a public NATGateway with the supplied name, in the
+// named public subnet, using the named Elastic IP.
+func newNATGateway(cfg Config, name, eipName, subnetName string) *awsv1beta1.NATGateway {
+	return &awsv1beta1.NATGateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+			}),
+		},
+		Spec: awsv1beta1.NATGatewaySpec{
+			ForProvider: awsv1beta1.NATGatewayParameters_2{
+				Region:          ptr.To(cfg.Region),
+				AllocationIDRef: &v1.Reference{Name: eipName},
+				SubnetIDRef:     &v1.Reference{Name: subnetName},
+				Tags:            tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+}
+
+// newNATRoute returns a Route with the supplied name that sends private
+// subnets' internet traffic from the named route table to the named NAT
+// gateway. It's composed at v1beta2 when the Function input pins that version.
+func newNATRoute(cfg Config, name, routeTableName, natGatewayName string) runtime.Object {
+	return routeAtVersion(cfg, &awsv1beta1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+			}),
+		},
+		Spec: awsv1beta1.RouteSpec{
+			ForProvider: awsv1beta1.RouteParameters_2{
+				Region:               ptr.To(cfg.Region),
+				RouteTableIDRef:      &v1.Reference{Name: routeTableName},
+				NATGatewayIDRef:      &v1.Reference{Name: natGatewayName},
+				DestinationCidrBlock: ptr.To(natDestination),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunFunctionNATGatewayStrategy(t *testing.T) {
+	xr := func(strategy string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"includeGateway": true,
+				"publicSubnets": true,
+				"privateSubnets": true,
+				"availabilityZones": ["eu-central-1a", "eu-central-1b"],
+				"natGatewayStrategy": "` + strategy + `"
+			}
+		}`
+	}
+
+	type want struct {
+		eips        map[string]string
+		natSubnets  map[string]string
+		natRoutes   map[string]string
+		routeTables map[string]string
+		results     []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Single": {
+			reason: "One NAT gateway should be placed in the first AZ, with every AZ's private route table routed to it",
+			xr:     xr("single"),
+			want: want{
+				eips:       map[string]string{"natgateway-code-0-0": "eip-code-0-0"},
+				natSubnets: map[string]string{"natgateway-code-0-0": "subnet-code-0-public-0"},
+				natRoutes: map[string]string{
+					"natroute-code-0-0": "natgateway-code-0-0",
+					"natroute-code-0-1": "natgateway-code-0-0",
+				},
+				routeTables: map[string]string{
+					"natroute-code-0-0": "routetable-code-0-private-0",
+					"natroute-code-0-1": "routetable-code-0-private-1",
+				},
+			},
+		},
+		"PerAZ": {
+			reason: "A NAT gateway should be placed in each AZ, with each AZ's private route table routed to its own",
+			xr:     xr("per-az"),
+			want: want{
+				eips: map[string]string{
+					"natgateway-code-0-0": "eip-code-0-0",
+					"natgateway-code-0-1": "eip-code-0-1",
+				},
+				natSubnets: map[string]string{
+					"natgateway-code-0-0": "subnet-code-0-public-0",
+					"natgateway-code-0-1": "subnet-code-0-public-1",
+				},
+				natRoutes: map[string]string{
+					"natroute-code-0-0": "natgateway-code-0-0",
+					"natroute-code-0-1": "natgateway-code-0-1",
+				},
+				routeTables: map[string]string{
+					"natroute-code-0-0": "routetable-code-0-private-0",
+					"natroute-code-0-1": "routetable-code-0-private-1",
+				},
+			},
+		},
+		"UnknownStrategy": {
+			reason: "An unknown strategy should return a fatal result",
+			xr:     xr("per-vpc"),
+			want: want{
+				eips:        map[string]string{},
+				natSubnets:  map[string]string{},
+				natRoutes:   map[string]string{},
+				routeTables: map[string]string{},
+				results:     []string{`invalid network config: spec.natGatewayStrategy: must be "single" or "per-az", got "per-vpc"`},
+			},
+		},
+		"NoPublicSubnets": {
+			reason: "NAT gateways without public subnets to place them in should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"privateSubnets": true,
+					"availabilityZones": ["eu-central-1a"],
+					"natGatewayStrategy": "single"
+				}
+			}`,
+			want: want{
+				eips:        map[string]string{},
+				natSubnets:  map[string]string{},
+				natRoutes:   map[string]string{},
+				routeTables: map[string]string{},
+				results:     []string{"invalid network config: spec.natGatewayStrategy: requires spec.includeGateway, spec.publicSubnets, spec.privateSubnets, and at least one availability zone"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.eips, desiredStrings(t, rsp, "spec.forProvider.allocationIdRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want Elastic IPs, +got Elastic IPs:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.natSubnets, onlyPrefix(desiredStrings(t, rsp, "spec.forProvider.subnetIdRef.name"), "natgateway-")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want NAT gateway subnets, +got NAT gateway subnets:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.natRoutes, desiredStrings(t, rsp, "spec.forProvider.natGatewayIdRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want route targets, +got route targets:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.routeTables, onlyPrefix(desiredStrings(t, rsp, "spec.forProvider.routeTableIdRef.name"), "natroute-")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want route tables, +got route tables:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// onlyPrefix returns the entries of the supplied map whose keys have the
+// supplied prefix.
+func onlyPrefix(m map[string]string, prefix string) map[string]string {
+	out := map[string]string{}
+	for k, v := range m {
+		if strings.HasPrefix(k, prefix) {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// health summarizes the conditions of the observed resources of a network.
+type health struct {
+	Total  int
+	Synced int
+	Ready  int
+}
+
+// networkHealth summarizes the Synced and Ready conditions of the observed
+// composed resources labelled as belonging to the supplied network.
+func networkHealth(observed map[resource.Name]resource.ObservedComposed, id string) health {
+	h := health{}
+	for _, oc := range observed {
+		if oc.Resource.GetLabels()[labelNetworkID] != id {
+			continue
+		}
+		h.Total++
+		if oc.Resource.GetCondition(xpv1.TypeSynced).Status == corev1.ConditionTrue {
+			h.Synced++
+		}
+		if oc.Resource.GetCondition(xpv1.TypeReady).Status == corev1.ConditionTrue {
+			h.Ready++
+		}
+	}
+	return h
+}
+
+// syncError is the error an observed resource's provider reported when it
+// failed to sync the resource.
+type syncError struct {
+	Name    string
+	Kind    string
+	Message string
+}
+
+// syncErrors returns the errors of the observed composed resources of the
+// supplied network whose Synced condition is False with a message, sorted by
+// resource name.
+func syncErrors(observed map[resource.Name]resource.ObservedComposed, id string) []syncError {
+	var errs []syncError
+	for name, oc := range observed {
+		if oc.Resource.GetLabels()[labelNetworkID] != id {
+			continue
+		}
+		c := oc.Resource.GetCondition(xpv1.TypeSynced)
+		if c.Status != corev1.ConditionFalse || c.Message == "" {
+			continue
+		}
+		errs = append(errs, syncError{Name: string(name), Kind: oc.Resource.GetKind(), Message: c.Message})
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Name < errs[j].Name })
+	return errs
+}
+
+// stalledResources returns the names of the observed composed resources of the
+// supplied network that haven't been Ready for longer than the supplied
+// timeout, sorted by name. A resource that has never reported a Ready
+// condition has been unready since it was created.
+func stalledResources(observed map[resource.Name]resource.ObservedComposed, id string, timeout time.Duration, now time.Time) []string {
+	var stalled []string
+	for name, oc := range observed {
+		if oc.Resource.GetLabels()[labelNetworkID] != id {
+			continue
+		}
+		c := oc.Resource.GetCondition(xpv1.TypeReady)
+		if c.Status == corev1.ConditionTrue {
+			continue
+		}
+		since := c.LastTransitionTime.Time
+		if since.IsZero() {
+			since = oc.Resource.GetCreationTimestamp().Time
+		}
+		if since.IsZero() || now.Sub(since) <= timeout {
+			continue
+		}
+		stalled = append(stalled, string(name))
+	}
+	sort.Strings(stalled)
+	return stalled
+}
+
+// attachedGateway is an observed InternetGateway that's attached to a VPC.
+type attachedGateway struct {
+	Name  string
+	VPCID string
+}
+
+// observedGatewayAttached returns true if the named InternetGateway has been
+// observed attached to a VPC.
+func observedGatewayAttached(observed map[resource.Name]resource.ObservedComposed, gatewayName string) bool {
+	oc, ok := observed[resource.Name(gatewayName)]
+	if !ok {
+		return false
+	}
+	vpcID, _ := oc.Resource.GetString("status.atProvider.vpcId")
+	return vpcID != ""
+}
+
+// orphanedGateways returns the observed InternetGateways of the supplied
+// network that are still attached to a VPC but are no longer desired, sorted
+// by name.
+func orphanedGateways(observed map[resource.Name]resource.ObservedComposed, desired map[resource.Name]*resource.DesiredComposed, id string) []attachedGateway {
+	var orphans []attachedGateway
+	for name, oc := range observed {
+		if oc.Resource.GetKind() != "InternetGateway" || oc.Resource.GetLabels()[labelNetworkID] != id {
+			continue
+		}
+		if _, ok := desired[name]; ok {
+			continue
+		}
+		vpcID, _ := oc.Resource.GetString("status.atProvider.vpcId")
+		if vpcID == "" {
+			continue
+		}
+		orphans = append(orphans, attachedGateway{Name: string(name), VPCID: vpcID})
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Name < orphans[j].Name })
+	return orphans
+}
+
+// observedVPCIPv6 returns the AWS id and IPv6 CIDR block of the named VPC, if
+// it has been observed. Either is empty if AWS hasn't assigned it yet.
+func observedVPCIPv6(observed map[resource.Name]resource.ObservedComposed, vpcName string) (id, block string) {
+	oc, ok := observed[resource.Name(vpcName)]
+	if !ok {
+		return "", ""
+	}
+	id, _ = oc.Resource.GetString("status.atProvider.id")
+	block, _ = oc.Resource.GetString("status.atProvider.ipv6CidrBlock")
+	return id, block
+}
+
+// observedVPCID returns the AWS id of the named VPC, or an empty string if AWS
+// hasn't created it yet.
+func observedVPCID(observed map[resource.Name]resource.ObservedComposed, vpcName string) string {
+	id, _ := observedVPCIPv6(observed, vpcName)
+	return id
+}
+
+// vpcConsoleURL returns a link to the AWS console page of the VPC with the
+// supplied id, in the supplied region.
+func vpcConsoleURL(region, id string) string {
+	host := region + ".console.aws.amazon.com"
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		host = region + ".console.amazonaws.cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		host = "console.amazonaws-us-gov.com"
+	}
+	return fmt.Sprintf("https://%s/vpcconsole/home?region=%s#VpcDetails:VpcId=%s", host, url.QueryEscape(region), url.QueryEscape(id))
+}
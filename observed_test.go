@@ -0,0 +1,612 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"k8s.io/utils/ptr"
+)
+
+func TestRunFunctionHealthSummary(t *testing.T) {
+	xr := resource.MustStructJSON(`{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 0}
+	}`)
+
+	cases := map[string]struct {
+		reason   string
+		observed map[string]*fnv1.Resource
+		want     []string
+	}{
+		"NoObservedResources": {
+			reason: "No summary should be emitted before any resources exist",
+			want:   nil,
+		},
+		"Mixed": {
+			reason: "The summary should count the Synced and Ready resources of this network, ignoring others",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {"name": "vpc-code-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}},
+					"status": {"conditions": [
+						{"type": "Synced", "status": "True"},
+						{"type": "Ready", "status": "True"}
+					]}
+				}`)},
+				"gateway-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "InternetGateway",
+					"metadata": {"name": "gateway-code-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}},
+					"status": {"conditions": [
+						{"type": "Synced", "status": "True"},
+						{"type": "Ready", "status": "False"}
+					]}
+				}`)},
+				"subnet-code-0-private-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "Subnet",
+					"metadata": {"name": "subnet-code-0-private-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}}
+				}`)},
+				"vpc-other-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {"name": "vpc-other-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "other"}},
+					"status": {"conditions": [
+						{"type": "Synced", "status": "True"},
+						{"type": "Ready", "status": "True"}
+					]}
+				}`)},
+			},
+			want: []string{"2/3 synced, 1/3 ready"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: xr},
+					Resources: tc.observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionSyncErrors(t *testing.T) {
+	xr := resource.MustStructJSON(`{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 0}
+	}`)
+
+	cases := map[string]struct {
+		reason   string
+		observed map[string]*fnv1.Resource
+		want     []*fnv1.Result
+	}{
+		"Synced": {
+			reason: "No warning should be emitted for resources that are synced",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {"name": "vpc-code-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}},
+					"status": {"conditions": [{"type": "Synced", "status": "True", "reason": "ReconcileSuccess"}]}
+				}`)},
+			},
+		},
+		"ProviderError": {
+			reason: "The provider's error should be relayed for each resource of the network that failed to sync",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {"name": "vpc-code-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}},
+					"status": {"conditions": [{
+						"type": "Synced",
+						"status": "False",
+						"reason": "ReconcileError",
+						"message": "create failed: InvalidVpc.Range: The CIDR '10.0.0.0/8' is invalid."
+					}]}
+				}`)},
+				"gateway-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "InternetGateway",
+					"metadata": {"name": "gateway-code-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}},
+					"status": {"conditions": [{"type": "Synced", "status": "False", "reason": "ReconcileError"}]}
+				}`)},
+				"vpc-other-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {"name": "vpc-other-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "other"}},
+					"status": {"conditions": [{"type": "Synced", "status": "False", "message": "not this network's"}]}
+				}`)},
+			},
+			want: []*fnv1.Result{{
+				Severity: fnv1.Severity_SEVERITY_WARNING,
+				Message:  `VPC "vpc-code-0" is not synced: create failed: InvalidVpc.Range: The CIDR '10.0.0.0/8' is invalid.`,
+				Reason:   ptr.To(reasonSyncFailed),
+				Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: xr},
+					Resources: tc.observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var got []*fnv1.Result
+			for _, r := range rsp.GetResults() {
+				if r.GetReason() == reasonSyncFailed {
+					got = append(got, r)
+				}
+			}
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want sync failed results, +got sync failed results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionOrphanedGateways(t *testing.T) {
+	observed := map[string]*fnv1.Resource{
+		"vpc-code-0": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "VPC",
+			"metadata": {"name": "vpc-code-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}},
+			"status": {"atProvider": {"id": "vpc-0123"}}
+		}`)},
+		"gateway-code-0": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "InternetGateway",
+			"metadata": {"name": "gateway-code-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}},
+			"status": {"atProvider": {"vpcId": "vpc-0123"}}
+		}`)},
+	}
+
+	cases := map[string]struct {
+		reason string
+		spec   string
+		want   []string
+	}{
+		"FlippedToFalse": {
+			reason: "Turning off includeGateway while a gateway is attached should warn about the teardown order",
+			spec:   `{"id": "code", "count": 1, "includeGateway": false}`,
+			want: []string{
+				"0/2 synced, 0/2 ready",
+				`InternetGateway "gateway-code-0" is no longer desired and will be deleted, but it is still attached to VPC "vpc-0123"; detach it from the VPC first, or delete the VPC and its gateway together`,
+			},
+		},
+		"StillDesired": {
+			reason: "No warning should be emitted while the gateway is still desired",
+			spec:   `{"id": "code", "count": 1, "includeGateway": true}`,
+			want:   []string{"0/2 synced, 0/2 ready"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+						"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+						"kind": "XNetwork",
+						"metadata": {"name": "network-code"},
+						"spec": ` + tc.spec + `
+					}`)},
+					Resources: observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionDualStackSubnets(t *testing.T) {
+	xr := resource.MustStructJSON(`{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {
+			"id": "code",
+			"count": 1,
+			"enableIpv6": true,
+			"availabilityZones": ["eu-central-1a", "eu-central-1b"],
+			"publicSubnets": true
+		}
+	}`)
+
+	type want struct {
+		ipv6    map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason   string
+		observed map[string]*fnv1.Resource
+		want     want
+	}{
+		"VPCNotYetCreated": {
+			reason: "Subnets should be IPv4 only until the VPC's IPv6 block is known",
+			want:   want{ipv6: map[string]string{}},
+		},
+		"VPCWithoutIPv6Block": {
+			reason: "A warning should be emitted if the VPC exists without an IPv6 block",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {"name": "vpc-code-0"},
+					"status": {"atProvider": {"id": "vpc-0123"}}
+				}`)},
+			},
+			want: want{
+				ipv6:    map[string]string{},
+				results: []string{`VPC "vpc-code-0" has no IPv6 CIDR block yet; its subnets will be dual-stack once it does`},
+			},
+		},
+		"VPCWithIPv6Block": {
+			reason: "Each subnet should get a /64 of the VPC's IPv6 block",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {"name": "vpc-code-0"},
+					"status": {"atProvider": {"id": "vpc-0123", "ipv6CidrBlock": "2600:1f18:abcd:1200::/56"}}
+				}`)},
+			},
+			want: want{
+				ipv6: map[string]string{
+					"subnet-code-0-public-0": "2600:1f18:abcd:1200::/64",
+					"subnet-code-0-public-1": "2600:1f18:abcd:1201::/64",
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: xr},
+					Resources: tc.observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.ipv6, desiredStrings(t, rsp, "spec.forProvider.ipv6CidrBlock")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want IPv6 CIDR blocks, +got IPv6 CIDR blocks:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestVPCConsoleURL(t *testing.T) {
+	type args struct {
+		region string
+		id     string
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   string
+	}{
+		"Commercial": {
+			reason: "Commercial regions should link to their regional console",
+			args:   args{region: "eu-central-1", id: "vpc-0123456789abcdef0"},
+			want:   "https://eu-central-1.console.aws.amazon.com/vpcconsole/home?region=eu-central-1#VpcDetails:VpcId=vpc-0123456789abcdef0",
+		},
+		"China": {
+			reason: "China regions should link to the China console",
+			args:   args{region: "cn-north-1", id: "vpc-0123"},
+			want:   "https://cn-north-1.console.amazonaws.cn/vpcconsole/home?region=cn-north-1#VpcDetails:VpcId=vpc-0123",
+		},
+		"GovCloud": {
+			reason: "GovCloud regions should link to the GovCloud console",
+			args:   args{region: "us-gov-west-1", id: "vpc-0123"},
+			want:   "https://console.amazonaws-us-gov.com/vpcconsole/home?region=us-gov-west-1#VpcDetails:VpcId=vpc-0123",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := vpcConsoleURL(tc.args.region, tc.args.id)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nvpcConsoleURL(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionConsoleLinks(t *testing.T) {
+	xr := resource.MustStructJSON(`{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 2, "region": "us-west-2"}
+	}`)
+
+	f := &Function{log: logging.NewNopLogger()}
+	req := &fnv1.RunFunctionRequest{
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: xr},
+			Resources: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {"name": "vpc-code-0"},
+					"status": {"atProvider": {"id": "vpc-0123456789abcdef0"}}
+				}`)},
+				"vpc-code-1": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {"name": "vpc-code-1"}
+				}`)},
+			},
+		},
+	}
+	rsp, err := f.RunFunction(context.Background(), req)
+	if err != nil {
+		t.Fatalf("f.RunFunction(...): unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, r := range rsp.GetResults() {
+		if r.GetReason() == reasonConsoleLink {
+			got = append(got, r.GetMessage())
+		}
+	}
+	want := []string{`VPC "vpc-code-0" is vpc-0123456789abcdef0: https://us-west-2.console.aws.amazon.com/vpcconsole/home?region=us-west-2#VpcDetails:VpcId=vpc-0123456789abcdef0`}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("f.RunFunction(...): only VPCs with an observed id should be linked: -want, +got:\n%s", diff)
+	}
+}
+
+func TestRunFunctionReadyTimeout(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	xr := resource.MustStructJSON(`{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 1, "includeGateway": true, "readyTimeoutSeconds": 600}
+	}`)
+	vpc := resource.MustStructJSON(`{
+		"apiVersion": "ec2.aws.upbound.io/v1beta1",
+		"kind": "VPC",
+		"metadata": {"name": "vpc-code-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}},
+		"status": {"conditions": [
+			{"type": "Ready", "status": "True", "lastTransitionTime": "2024-06-01T10:00:00Z"}
+		]}
+	}`)
+
+	type condition struct {
+		Status  fnv1.Status
+		Reason  string
+		Message string
+	}
+
+	cases := map[string]struct {
+		reason   string
+		observed map[string]*fnv1.Resource
+		want     []condition
+	}{
+		"Stalled": {
+			reason: "A resource that has been unready for longer than the timeout should mark the network stalled",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: vpc},
+				"gateway-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "InternetGateway",
+					"metadata": {"name": "gateway-code-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}},
+					"status": {"conditions": [
+						{"type": "Ready", "status": "False", "lastTransitionTime": "2024-06-01T11:00:00Z"}
+					]}
+				}`)},
+			},
+			want: []condition{{Status: fnv1.Status_STATUS_CONDITION_FALSE, Reason: reasonNetworkStalled, Message: "gateway-code-0 not ready after 10m0s"}},
+		},
+		"NeverReady": {
+			reason: "A resource created longer ago than the timeout that has never been Ready should mark the network stalled",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: vpc},
+				"gateway-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "InternetGateway",
+					"metadata": {
+						"name": "gateway-code-0",
+						"labels": {"networks.meta.fn.crossplane.io/network-id": "code"},
+						"creationTimestamp": "2024-06-01T11:00:00Z"
+					}
+				}`)},
+			},
+			want: []condition{{Status: fnv1.Status_STATUS_CONDITION_FALSE, Reason: reasonNetworkStalled, Message: "gateway-code-0 not ready after 10m0s"}},
+		},
+		"Pending": {
+			reason: "A resource that has been unready for less than the timeout should leave the network progressing",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: vpc},
+				"gateway-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "InternetGateway",
+					"metadata": {"name": "gateway-code-0", "labels": {"networks.meta.fn.crossplane.io/network-id": "code"}},
+					"status": {"conditions": [
+						{"type": "Ready", "status": "False", "lastTransitionTime": "2024-06-01T11:55:00Z"}
+					]}
+				}`)},
+			},
+			want: []condition{{Status: fnv1.Status_STATUS_CONDITION_TRUE, Reason: reasonResourcesPending, Message: "1/2 ready"}},
+		},
+		"Ready": {
+			reason: "A network whose resources are all Ready should be progressing with every resource ready",
+			observed: map[string]*fnv1.Resource{
+				"vpc-code-0": {Resource: vpc},
+			},
+			want: []condition{{Status: fnv1.Status_STATUS_CONDITION_TRUE, Reason: reasonResourcesReady}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), clock: func() time.Time { return now }}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: xr},
+					Resources: tc.observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var got []condition
+			for _, c := range rsp.GetConditions() {
+				if c.GetType() == conditionNetworkProgressing {
+					got = append(got, condition{Status: c.GetStatus(), Reason: c.GetReason(), Message: c.GetMessage()})
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want conditions, +got conditions:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionGatewayChanges(t *testing.T) {
+	xr := resource.MustStructJSON(`{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {"id": "code", "count": 2, "includeGateway": true}
+	}`)
+
+	cases := map[string]struct {
+		reason   string
+		observed map[string]*fnv1.Resource
+		want     []string
+	}{
+		"AllNew": {
+			reason: "Gateways that haven't been observed should be reported as new",
+			want:   []string{"InternetGateways: 2 new, 0 already attached (new: gateway-code-0, gateway-code-1)"},
+		},
+		"OneAlreadyAttached": {
+			reason: "A gateway observed attached to its VPC should be reported as steady-state, not new",
+			observed: map[string]*fnv1.Resource{
+				"gateway-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "InternetGateway",
+					"metadata": {"name": "gateway-code-0"},
+					"status": {"atProvider": {"vpcId": "vpc-0123"}}
+				}`)},
+				"gateway-code-1": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "InternetGateway",
+					"metadata": {"name": "gateway-code-1"}
+				}`)},
+			},
+			want: []string{"InternetGateways: 1 new, 1 already attached (new: gateway-code-1)"},
+		},
+		"AllAttached": {
+			reason: "No gateway should be reported new once they're all attached",
+			observed: map[string]*fnv1.Resource{
+				"gateway-code-0": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "InternetGateway",
+					"metadata": {"name": "gateway-code-0"},
+					"status": {"atProvider": {"vpcId": "vpc-0123"}}
+				}`)},
+				"gateway-code-1": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "InternetGateway",
+					"metadata": {"name": "gateway-code-1"},
+					"status": {"atProvider": {"vpcId": "vpc-4567"}}
+				}`)},
+			},
+			want: []string{"InternetGateways: 0 new, 2 already attached"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: xr},
+					Resources: tc.observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var got []string
+			for _, r := range rsp.GetResults() {
+				if r.GetReason() == reasonGatewayChanges {
+					got = append(got, r.GetMessage())
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want gateway changes, +got gateway changes:\n%s", tc.reason, diff)
+			}
+			gateways := 0
+			for _, r := range rsp.GetDesired().GetResources() {
+				if r.GetResource().GetFields()["kind"].GetStringValue() == "InternetGateway" {
+					gateways++
+				}
+			}
+			if diff := cmp.Diff(2, gateways); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): every gateway should stay desired: -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
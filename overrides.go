@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/names"
+)
+
+// annotationCompositionResourceName is the annotation Crossplane uses to tell
+// which entry of the desired composed resources a composed resource is.
+const annotationCompositionResourceName = "crossplane.io/composition-resource-name"
+
+// validateResourceNameOverrides returns an error if spec.resourceNameOverrides
+// would give two composed resources the same composition resource name.
+func (c Config) validateResourceNameOverrides() error {
+	logical := make([]string, 0, len(c.ResourceNameOverrides))
+	for name := range c.ResourceNameOverrides {
+		logical = append(logical, name)
+	}
+	sort.Strings(logical)
+
+	seen := map[string]string{}
+	for _, name := range logical {
+		field := fmt.Sprintf("spec.resourceNameOverrides[%s]", name)
+		override := c.ResourceNameOverrides[name]
+		if override == "" {
+			return &ValidationError{Field: field, Reason: "must not be empty"}
+		}
+		if other, ok := seen[override]; ok {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%q is also the override of %s", override, other)}
+		}
+		seen[override] = name
+	}
+	return nil
+}
+
+// resourceKeys returns the composition resource names to use instead of the
+// names the function generates, keyed by generated name. These are the stable
+// keys of the per-AZ resources when spec.stableResourceKeys is set, and the
+// overrides from spec.resourceNameOverrides, which take precedence.
+func (c Config) resourceKeys() map[string]string {
+	if !c.StableResourceKeys {
+		return c.ResourceNameOverrides
+	}
+	keys := c.stableResourceKeys()
+	for name, override := range c.ResourceNameOverrides {
+		keys[name] = override
+	}
+	return keys
+}
+
+// stableResourceKeys returns a composition resource name for each resource the
+// function composes per availability zone, keyed by generated name. Generated
+// names number these resources by their AZ's slot, which is its index in
+// spec.availabilityZones unless it was resolved from the observed subnets. The
+// stable names use the AZ itself instead, for example
+// subnet-code-0-public-us-west-2b rather than subnet-code-0-public-1.
+func (c Config) stableResourceKeys() map[string]string {
+	keys := map[string]string{}
+	for _, i := range c.vpcIndexes() {
+		for j, az := range c.AvailabilityZones {
+			slot := c.azSlot(j)
+			byAZ := func(name string) string {
+				key := strings.TrimSuffix(name, "-"+strconv.Itoa(slot)) + "-" + az
+				keys[name] = key
+				return key
+			}
+			for _, tier := range subnetTierSlots {
+				subnet := names.SubnetName(c.ID, i, tier, slot)
+				keys[names.RouteTableAssociationName(subnet)] = names.RouteTableAssociationName(byAZ(subnet))
+				byAZ(names.AZRouteTableName(c.ID, i, tier, slot))
+			}
+			byAZ(names.EIPName(c.ID, i, slot))
+			byAZ(names.NATGatewayName(c.ID, i, slot))
+			byAZ(names.NATRouteName(c.ID, i, slot))
+		}
+	}
+	return keys
+}
+
+// observedByLogicalName returns the supplied observed composed resources keyed
+// by the names the function generates, rather than their overrides, so that
+// they can be matched with the resources the function composes.
+func observedByLogicalName(observed map[resource.Name]resource.ObservedComposed, overrides map[string]string) map[resource.Name]resource.ObservedComposed {
+	if len(overrides) == 0 {
+		return observed
+	}
+	logical := make(map[string]string, len(overrides))
+	for name, override := range overrides {
+		logical[override] = name
+	}
+	out := make(map[resource.Name]resource.ObservedComposed, len(observed))
+	for name, oc := range observed {
+		if l, ok := logical[string(name)]; ok {
+			name = resource.Name(l)
+		}
+		out[name] = oc
+	}
+	return out
+}
+
+// overrideResourceNames returns the supplied desired composed resources with
+// each composed resource that has an override keyed by it instead of its
+// generated name, and annotated with it as its composition resource name.
+// Resources composed by earlier steps of the pipeline keep their names. It
+// also returns the names of the composed resources as renamed.
+func overrideResourceNames(desired map[resource.Name]*resource.DesiredComposed, composedNames map[resource.Name]bool, overrides map[string]string) (map[resource.Name]*resource.DesiredComposed, map[resource.Name]bool, error) {
+	if len(overrides) == 0 {
+		return desired, composedNames, nil
+	}
+	sorted := make([]string, 0, len(desired))
+	for name := range desired {
+		sorted = append(sorted, string(name))
+	}
+	sort.Strings(sorted)
+
+	out := make(map[resource.Name]*resource.DesiredComposed, len(desired))
+	from := make(map[resource.Name]resource.Name, len(desired))
+	renamed := make(map[resource.Name]bool, len(composedNames))
+	for _, n := range sorted {
+		name, dc := resource.Name(n), desired[resource.Name(n)]
+		key := name
+		if override, ok := overrides[string(name)]; ok && composedNames[name] {
+			key = resource.Name(override)
+			annotations := dc.Resource.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[annotationCompositionResourceName] = override
+			dc.Resource.SetAnnotations(annotations)
+		}
+		if other, ok := from[key]; ok {
+			return nil, nil, errors.Errorf("desired composed resources %q and %q would both be named %q", other, name, key)
+		}
+		out[key], from[key] = dc, name
+		if composedNames[name] {
+			renamed[key] = true
+		}
+	}
+	return out, renamed, nil
+}
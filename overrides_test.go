@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionResourceNameOverrides(t *testing.T) {
+	xr := func(overrides string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"includeGateway": true,
+				"emitDiff": true,
+				"resourceNameOverrides": ` + overrides + `
+			}
+		}`
+	}
+
+	type want struct {
+		names       map[string]string
+		annotations map[string]string
+		results     []string
+	}
+
+	cases := map[string]struct {
+		reason   string
+		xr       string
+		observed map[string]*fnv1.Resource
+		want     want
+	}{
+		"Overridden": {
+			reason: "An overridden resource should be keyed and annotated with its override, and others keep their names",
+			xr:     xr(`{"vpc-code-0": "vpc"}`),
+			want: want{
+				names: map[string]string{
+					"vpc":            "vpc-code-0",
+					"gateway-code-0": "gateway-code-0",
+				},
+				annotations: map[string]string{"vpc": "vpc"},
+			},
+		},
+		"ObservedByOverride": {
+			reason: "An observed resource keyed by its override should be matched with the resource the function composes",
+			xr:     xr(`{"vpc-code-0": "vpc"}`),
+			observed: map[string]*fnv1.Resource{
+				"vpc": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "VPC",
+					"metadata": {"name": "vpc-code-0"},
+					"spec": {"forProvider": {
+						"cidrBlock": "10.0.0.0/16",
+						"enableDnsHostnames": true,
+						"enableDnsSupport": true,
+						"region": "eu-central-1",
+						"tags": {"Name": "vpc-code-0"}
+					}}
+				}`)},
+			},
+			want: want{
+				names: map[string]string{
+					"vpc":            "vpc-code-0",
+					"gateway-code-0": "gateway-code-0",
+				},
+				annotations: map[string]string{"vpc": "vpc"},
+				results:     []string{`VPC "vpc-code-0" will change: cidrBlock: "10.0.0.0/16" -> "192.168.0.0/16"`},
+			},
+		},
+		"Duplicate": {
+			reason: "Two resources overridden with the same name should return a fatal result",
+			xr:     xr(`{"vpc-code-0": "network", "gateway-code-0": "network"}`),
+			want: want{
+				names:       map[string]string{},
+				annotations: map[string]string{},
+				results:     []string{`invalid network config: spec.resourceNameOverrides[vpc-code-0]: "network" is also the override of gateway-code-0`},
+			},
+		},
+		"CollidesWithGenerated": {
+			reason: "An override that's another resource's generated name should return a fatal result",
+			xr:     xr(`{"vpc-code-0": "gateway-code-0"}`),
+			want: want{
+				names:       map[string]string{},
+				annotations: map[string]string{},
+				results:     []string{`desired composed resources "gateway-code-0" and "vpc-code-0" would both be named "gateway-code-0"`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)},
+					Resources: tc.observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.names, desiredStrings(t, rsp, "metadata.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want names, +got names:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.annotations, desiredStrings(t, rsp, `metadata.annotations["crossplane.io/composition-resource-name"]`)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want annotations, +got annotations:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionStableResourceKeys(t *testing.T) {
+	xr := func(stable bool, azs, overrides string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"includeGateway": true,
+				"publicSubnets": true,
+				"privateSubnets": true,
+				"natGatewayStrategy": "per-az",
+				"availabilityZones": ` + azs + `,
+				"stableResourceKeys": ` + strconv.FormatBool(stable) + `,
+				"resourceNameOverrides": ` + overrides + `
+			}
+		}`
+	}
+	run := func(t *testing.T, xr string, observed map[string]*fnv1.Resource) *fnv1.RunFunctionResponse {
+		t.Helper()
+		f := &Function{log: logging.NewNopLogger()}
+		req := &fnv1.RunFunctionRequest{
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: observed,
+			},
+		}
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("f.RunFunction(...): unexpected error: %v", err)
+		}
+		// observed resources are reported as not yet synced or ready
+		want := []string(nil)
+		if len(observed) > 0 {
+			want = []string{fmt.Sprintf("0/%d synced, 0/%d ready", len(observed), len(observed))}
+		}
+		if diff := cmp.Diff(want, resultMessages(rsp)); diff != "" {
+			t.Fatalf("f.RunFunction(...): -want results, +got results:\n%s", diff)
+		}
+		return rsp
+	}
+
+	t.Run("Keys", func(t *testing.T) {
+		rsp := run(t, xr(true, `["eu-central-1a", "eu-central-1c"]`, `{}`), nil)
+		want := map[string]string{
+			"subnet-code-0-public-eu-central-1a":          "subnet-code-0-public-0",
+			"subnet-code-0-public-eu-central-1c":          "subnet-code-0-public-1",
+			"subnet-code-0-private-eu-central-1a":         "subnet-code-0-private-0",
+			"subnet-code-0-private-eu-central-1c":         "subnet-code-0-private-1",
+			"rtassoc-subnet-code-0-public-eu-central-1a":  "rtassoc-subnet-code-0-public-0",
+			"rtassoc-subnet-code-0-public-eu-central-1c":  "rtassoc-subnet-code-0-public-1",
+			"rtassoc-subnet-code-0-private-eu-central-1a": "rtassoc-subnet-code-0-private-0",
+			"rtassoc-subnet-code-0-private-eu-central-1c": "rtassoc-subnet-code-0-private-1",
+			"routetable-code-0-private-eu-central-1a":     "routetable-code-0-private-0",
+			"routetable-code-0-private-eu-central-1c":     "routetable-code-0-private-1",
+			"eip-code-0-eu-central-1a":                    "eip-code-0-0",
+			"eip-code-0-eu-central-1c":                    "eip-code-0-1",
+			"natgateway-code-0-eu-central-1a":             "natgateway-code-0-0",
+			"natgateway-code-0-eu-central-1c":             "natgateway-code-0-1",
+			"natroute-code-0-eu-central-1a":               "natroute-code-0-0",
+			"natroute-code-0-eu-central-1c":               "natroute-code-0-1",
+			"vpc-code-0":                                  "vpc-code-0",
+			"gateway-code-0":                              "gateway-code-0",
+			"routetable-code-0-public":                    "routetable-code-0-public",
+			"route-code-0-public-0":                       "route-code-0-public-0",
+		}
+		if diff := cmp.Diff(want, desiredStrings(t, rsp, "metadata.name")); diff != "" {
+			t.Errorf("f.RunFunction(...): -want names, +got names:\n%s", diff)
+		}
+		annotations := desiredStrings(t, rsp, `metadata.annotations["crossplane.io/composition-resource-name"]`)
+		if diff := cmp.Diff("subnet-code-0-public-eu-central-1c", annotations["subnet-code-0-public-eu-central-1c"]); diff != "" {
+			t.Errorf("f.RunFunction(...): -want annotation, +got annotation:\n%s", diff)
+		}
+	})
+
+	cases := map[string]struct {
+		reason string
+		stable bool
+		want   []string
+	}{
+		"Stable": {
+			reason: "Inserting an AZ should leave every existing subnet keyed, named, and addressed as before",
+			stable: true,
+		},
+		"Unstable": {
+			reason: "Without stable keys inserting an AZ should shift the subnets after it, and re-address every later tier",
+			stable: false,
+			want:   []string{"subnet-code-0-private-0", "subnet-code-0-private-1", "subnet-code-0-public-1"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			first := run(t, xr(tc.stable, `["eu-central-1a", "eu-central-1c"]`, `{}`), nil)
+			second := run(t, xr(tc.stable, `["eu-central-1a", "eu-central-1b", "eu-central-1c"]`, `{}`), first.GetDesired().GetResources())
+
+			// each subnet's name, AZ, and CIDR block, by key
+			subnets := func(rsp *fnv1.RunFunctionResponse) map[string]string {
+				names := desiredStrings(t, rsp, "metadata.name")
+				azs := desiredStrings(t, rsp, "spec.forProvider.availabilityZone")
+				cidrs := desiredStrings(t, rsp, "spec.forProvider.cidrBlock")
+				out := map[string]string{}
+				for key := range onlyPrefix(azs, "subnet-") {
+					out[key] = names[key] + " " + azs[key] + " " + cidrs[key]
+				}
+				return out
+			}
+			before, after := subnets(first), subnets(second)
+
+			// the keys of subnets that were renamed, moved to another AZ,
+			// or re-addressed
+			var shifted []string
+			for key, s := range before {
+				if after[key] != s {
+					shifted = append(shifted, key)
+				}
+			}
+			sort.Strings(shifted)
+			if diff := cmp.Diff(tc.want, shifted); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want shifted keys, +got shifted keys:\n%s", tc.reason, diff)
+			}
+			if got, want := len(after), len(before)+2; got != want {
+				t.Errorf("%s\nf.RunFunction(...): want %d subnets after inserting an AZ, got %d", tc.reason, want, got)
+			}
+		})
+	}
+
+	t.Run("Overridden", func(t *testing.T) {
+		rsp := run(t, xr(true, `["eu-central-1a"]`, `{"subnet-code-0-public-0": "public"}`), nil)
+		names := desiredStrings(t, rsp, "metadata.name")
+		got := map[string]string{
+			"public":                              names["public"],
+			"subnet-code-0-public-eu-central-1a":  names["subnet-code-0-public-eu-central-1a"],
+			"subnet-code-0-private-eu-central-1a": names["subnet-code-0-private-eu-central-1a"],
+		}
+		want := map[string]string{
+			"public":                              "subnet-code-0-public-0",
+			"subnet-code-0-public-eu-central-1a":  "",
+			"subnet-code-0-private-eu-central-1a": "subnet-code-0-private-0",
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("An override should take precedence over the stable key\nf.RunFunction(...): -want names, +got names:\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/netip"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/config"
+
+	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// Address families of a managed prefix list.
+const (
+	addressFamilyIPv4 = "IPv4"
+	addressFamilyIPv6 = "IPv6"
+)
+
+// prefixList is the managed prefix list of spec.prefixList.
+type prefixList config.PrefixList
+
+// maxEntries returns the most entries the prefix list may hold. It defaults to
+// the number of entries it has.
+func (pl prefixList) maxEntries() int64 {
+	if pl.MaxEntries != 0 {
+		return pl.MaxEntries
+	}
+	return int64(len(pl.Entries))
+}
+
+// addressFamily returns the address family of the prefix list's entries.
+// validate ensures every entry has the same one.
+func (pl prefixList) addressFamily() string {
+	if len(pl.Entries) > 0 {
+		if p, err := netip.ParsePrefix(pl.Entries[0].CIDR); err == nil {
+			return addressFamilyOf(p)
+		}
+	}
+	return addressFamilyIPv4
+}
+
+// addressFamilyOf returns the address family of the supplied CIDR block.
+func addressFamilyOf(p netip.Prefix) string {
+	if p.Addr().Is6() {
+		return addressFamilyIPv6
+	}
+	return addressFamilyIPv4
+}
+
+// validate returns an error if AWS would reject the prefix list.
+func (pl prefixList) validate() error {
+	if pl.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(pl.Entries) == 0 {
+		return errors.New("at least one entry is required")
+	}
+	if pl.MaxEntries < 0 || int64(len(pl.Entries)) > pl.maxEntries() {
+		return errors.Errorf("%d entries exceed maxEntries %d", len(pl.Entries), pl.MaxEntries)
+	}
+	family := pl.addressFamily()
+	for i, e := range pl.Entries {
+		p, err := netip.ParsePrefix(e.CIDR)
+		if err != nil {
+			return errors.Wrapf(err, "invalid entry %d", i)
+		}
+		if f := addressFamilyOf(p); f != family {
+			return errors.Errorf("entry %d is %s but the first entry is %s", i, f, family)
+		}
+	}
+	return nil
+}
+
+// newPrefixList returns a ManagedPrefixList with the supplied name, holding the
+// configured prefix list's entries.
+func newPrefixList(cfg Config, name string) *awsv1beta1.ManagedPrefixList {
+	entries := make([]awsv1beta1.EntryParameters, len(cfg.PrefixList.Entries))
+	for i, e := range cfg.PrefixList.Entries {
+		entries[i] = awsv1beta1.EntryParameters{Cidr: ptr.To(e.CIDR)}
+		if e.Description != "" {
+			entries[i].Description = ptr.To(e.Description)
+		}
+	}
+
+	return &awsv1beta1.ManagedPrefixList{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+			}),
+		},
+		Spec: awsv1beta1.ManagedPrefixListSpec{
+			ForProvider: awsv1beta1.ManagedPrefixListParameters{
+				Region:        ptr.To(cfg.Region),
+				Name:          ptr.To(cfg.PrefixList.Name),
+				AddressFamily: ptr.To(prefixList(*cfg.PrefixList).addressFamily()),
+				MaxEntries:    ptr.To(float64(prefixList(*cfg.PrefixList).maxEntries())),
+				Entry:         entries,
+				Tags:          tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+}
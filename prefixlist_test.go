@@ -0,0 +1,194 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionPrefixList(t *testing.T) {
+	type want struct {
+		prefixList *fnv1.Resource
+		results    []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"TwoEntries": {
+			reason: "A managed prefix list holding the supplied entries should be created",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"prefixList": {
+						"name": "corp",
+						"maxEntries": 5,
+						"entries": [
+							{"cidr": "10.0.0.0/8", "description": "Corporate network"},
+							{"cidr": "172.16.0.0/12"}
+						]
+					}
+				}
+			}`,
+			want: want{
+				prefixList: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "ManagedPrefixList",
+					"metadata": {
+						"labels": {
+							"networks.meta.fn.crossplane.io/network-id": "code"
+						},
+						"name": "prefixlist-code"
+					},
+					"spec": {
+						"forProvider": {
+							"addressFamily": "IPv4",
+							"entry": [
+								{"cidr": "10.0.0.0/8", "description": "Corporate network"},
+								{"cidr": "172.16.0.0/12"}
+							],
+							"maxEntries": 5,
+							"name": "corp",
+							"region": "eu-central-1",
+							"tags": {
+								"Name": "prefixlist-code"
+							}
+						},
+						"providerConfigRef": {
+							"name": "default"
+						}
+					}
+				}`)},
+			},
+		},
+		"DefaultMaxEntries": {
+			reason: "The most entries a prefix list may hold should default to the number of entries",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 0,
+					"tags": {"team": "net"},
+					"prefixList": {
+						"name": "corp-v6",
+						"entries": [{"cidr": "2001:db8::/32"}]
+					}
+				}
+			}`,
+			want: want{
+				prefixList: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+					"apiVersion": "ec2.aws.upbound.io/v1beta1",
+					"kind": "ManagedPrefixList",
+					"metadata": {
+						"labels": {
+							"networks.meta.fn.crossplane.io/network-id": "code"
+						},
+						"name": "prefixlist-code"
+					},
+					"spec": {
+						"forProvider": {
+							"addressFamily": "IPv6",
+							"entry": [
+								{"cidr": "2001:db8::/32"}
+							],
+							"maxEntries": 1,
+							"name": "corp-v6",
+							"region": "eu-central-1",
+							"tags": {
+								"Name": "prefixlist-code",
+								"team": "net"
+							}
+						},
+						"providerConfigRef": {
+							"name": "default"
+						}
+					}
+				}`)},
+			},
+		},
+		"TooManyEntries": {
+			reason: "More entries than maxEntries should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"prefixList": {
+						"name": "corp",
+						"maxEntries": 1,
+						"entries": [{"cidr": "10.0.0.0/8"}, {"cidr": "172.16.0.0/12"}]
+					}
+				}
+			}`,
+			want: want{
+				results: []string{"invalid network config: spec.prefixList: 2 entries exceed maxEntries 1"},
+			},
+		},
+		"InvalidCIDR": {
+			reason: "An entry that isn't a CIDR block should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"prefixList": {
+						"name": "corp",
+						"entries": [{"cidr": "10.0.0.0/8"}, {"cidr": "10.0.0.0"}]
+					}
+				}
+			}`,
+			want: want{
+				results: []string{`invalid network config: spec.prefixList: invalid entry 1: netip.ParsePrefix("10.0.0.0"): no '/'`},
+			},
+		},
+		"MixedFamilies": {
+			reason: "Entries of different address families should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"prefixList": {
+						"name": "corp",
+						"entries": [{"cidr": "10.0.0.0/8"}, {"cidr": "2001:db8::/32"}]
+					}
+				}
+			}`,
+			want: want{
+				results: []string{"invalid network config: spec.prefixList: entry 1 is IPv6 but the first entry is IPv4"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			got := rsp.GetDesired().GetResources()["prefixlist-code"]
+			if diff := cmp.Diff(tc.want.prefixList, got, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want prefix list, +got prefix list:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// providerConfigAssignments returns the names of the supplied composed
+// resources keyed by the provider config each of them references, sorted by
+// name. Resources without a provider config, like Usages, are omitted.
+func providerConfigAssignments(desired map[resource.Name]*resource.DesiredComposed, composedNames map[resource.Name]bool) map[string][]string {
+	assigned := map[string][]string{}
+	for name := range composedNames {
+		dc, ok := desired[name]
+		if !ok {
+			continue
+		}
+		pc, _ := dc.Resource.GetString("spec.providerConfigRef.name")
+		if pc == "" {
+			continue
+		}
+		assigned[pc] = append(assigned[pc], string(name))
+	}
+	for _, names := range assigned {
+		sort.Strings(names)
+	}
+	return assigned
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunFunctionProviderConfigAssignment(t *testing.T) {
+	xr := func(spec string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "code", "includeGateway": true, ` + spec + `}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   []string
+	}{
+		"Default": {
+			reason: "Nothing should be listed when every resource uses the default ProviderConfig",
+			xr:     xr(`"count": 2, "providerConfigName": "default"`),
+		},
+		"RoundRobin": {
+			reason: "Resources assigned another ProviderConfig round-robin should be listed under it",
+			xr:     xr(`"count": 2, "providerConfigs": ["default", "prod"]`),
+			want:   []string{`ProviderConfig "prod" is used by gateway-code-1, vpc-code-1`},
+		},
+		"Gateways": {
+			reason: "Each non-default ProviderConfig should be listed, in order, with the resources resolved to it",
+			xr:     xr(`"count": 1, "providerConfigName": "shared", "gatewayProviderConfigName": "edge"`),
+			want: []string{
+				`ProviderConfig "edge" is used by gateway-code-0`,
+				`ProviderConfig "shared" is used by vpc-code-0`,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			var got []string
+			for _, r := range rsp.GetResults() {
+				if r.GetReason() == reasonProviderConfigAssignment {
+					got = append(got, r.GetMessage())
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/input/v1beta1"
+)
+
+// extraResourceVPCQuota is the key of the VPC quota among the extra resources
+// the function requires.
+const extraResourceVPCQuota = "vpc-quota"
+
+// defaultQuotaValuePath is where a provider-aws ServiceQuota reports its value.
+const defaultQuotaValuePath = "status.atProvider.value"
+
+// requireVPCQuota asks Crossplane to supply the VPC quota resource as an extra
+// resource. Crossplane calls the function again once it's done so.
+func requireVPCQuota(rsp *fnv1.RunFunctionResponse, q v1beta1.VPCQuota) {
+	requireResource(rsp, extraResourceVPCQuota, q.APIVersion, q.Kind, q.Name)
+}
+
+// vpcQuota returns the VPC quota reported by the supplied extra resources. It
+// returns false if Crossplane hasn't supplied the quota resource yet.
+func vpcQuota(q v1beta1.VPCQuota, extra map[string][]resource.Extra) (int64, bool, error) {
+	items, ok := extra[extraResourceVPCQuota]
+	if !ok {
+		return 0, false, nil
+	}
+	if len(items) == 0 {
+		return 0, false, errors.Errorf("%s %q doesn't exist", q.Kind, q.Name)
+	}
+
+	path := defaultQuotaValuePath
+	if q.ValuePath != nil {
+		path = *q.ValuePath
+	}
+	v, err := fieldpath.Pave(items[0].Resource.Object).GetValue(path)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "cannot get %s of %s %q", path, q.Kind, q.Name)
+	}
+	// quotas are reported as floats, which unmarshal as int64 when whole
+	switch v := v.(type) {
+	case int64:
+		return v, true, nil
+	case float64:
+		return int64(v), true, nil
+	}
+	return 0, false, errors.Errorf("%s of %s %q is not a number", path, q.Kind, q.Name)
+}
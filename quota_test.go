@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionVPCQuota(t *testing.T) {
+	input := `{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"vpcQuota": {
+			"apiVersion": "servicequotas.aws.upbound.io/v1beta1",
+			"kind": "ServiceQuota",
+			"name": "vpcs-per-region"
+		}
+	}`
+	xr := func(strict bool) string {
+		s := "false"
+		if strict {
+			s = "true"
+		}
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 3,
+				"region": "eu-central-1",
+				"cidrBlock": "192.168.0.0/16",
+				"providerConfigName": "default",
+				"strict": ` + s + `
+			}
+		}`
+	}
+	quota := func(value string) *fnv1.Resources {
+		return &fnv1.Resources{Items: []*fnv1.Resource{{Resource: resource.MustStructJSON(`{
+			"apiVersion": "servicequotas.aws.upbound.io/v1beta1",
+			"kind": "ServiceQuota",
+			"metadata": {"name": "vpcs-per-region"},
+			"status": {"atProvider": {"value": ` + value + `}}
+		}`)}}}
+	}
+
+	type want struct {
+		results []string
+		desired int
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		extra  map[string]*fnv1.Resources
+		want   want
+	}{
+		"NotYetSupplied": {
+			reason: "The quota should be required, and the VPCs composed, before Crossplane supplies it",
+			xr:     xr(false),
+			want:   want{desired: 3},
+		},
+		"Sufficient": {
+			reason: "A count within the quota should be composed without a warning",
+			xr:     xr(false),
+			extra:  map[string]*fnv1.Resources{extraResourceVPCQuota: quota("5")},
+			want:   want{desired: 3},
+		},
+		"Insufficient": {
+			reason: "A count beyond the quota should be composed with a warning",
+			xr:     xr(false),
+			extra:  map[string]*fnv1.Resources{extraResourceVPCQuota: quota("2")},
+			want: want{
+				results: []string{"spec.count 3 exceeds the VPC quota of 2 in region eu-central-1"},
+				desired: 3,
+			},
+		},
+		"InsufficientStrict": {
+			reason: "A count beyond the quota should return a fatal result when the XR is strict",
+			xr:     xr(true),
+			extra:  map[string]*fnv1.Resources{extraResourceVPCQuota: quota("2.0")},
+			want: want{
+				results: []string{"spec.count 3 exceeds the VPC quota of 2 in region eu-central-1"},
+			},
+		},
+		"Missing": {
+			reason: "A quota resource that doesn't exist should be warned about, but not stop the VPCs being composed",
+			xr:     xr(true),
+			extra:  map[string]*fnv1.Resources{extraResourceVPCQuota: {}},
+			want: want{
+				results: []string{`cannot check the VPC quota: ServiceQuota "vpcs-per-region" doesn't exist`},
+				desired: 3,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input:          resource.MustStructJSON(input),
+				Observed:       &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+				ExtraResources: tc.extra,
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			wantReq := &fnv1.Requirements{ExtraResources: map[string]*fnv1.ResourceSelector{
+				extraResourceVPCQuota: {
+					ApiVersion: "servicequotas.aws.upbound.io/v1beta1",
+					Kind:       "ServiceQuota",
+					Match:      &fnv1.ResourceSelector_MatchName{MatchName: "vpcs-per-region"},
+				},
+			}}
+			if diff := cmp.Diff(wantReq, rsp.GetRequirements(), protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want requirements, +got requirements:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.desired, len(rsp.GetDesired().GetResources())); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want desired resources, +got desired resources:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/config"
+
+	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	nfv1beta1 "github.com/upbound/provider-aws/apis/networkfirewall/v1beta1"
+	rdsv1beta1 "github.com/upbound/provider-aws/apis/rds/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// inRegion returns true if the supplied availability zone belongs to the
+// supplied region. Zones of regions whose zones the function doesn't know
+// belong to the region if they're its name followed by a zone letter.
+func inRegion(region, az string) bool {
+	if azs, ok := config.RegionAZs(region); ok {
+		return slices.Contains(azs, az)
+	}
+	zone, ok := strings.CutPrefix(az, region)
+	return ok && len(zone) == 1 && zone[0] >= 'a' && zone[0] <= 'z'
+}
+
+// kindReferences maps each kind of resource the function composes to the kinds
+// of the resources it references or selects. A resource can only reference
+// resources in its own region.
+var kindReferences = map[string][]string{
+	"Subnet":                           {"VPC"},
+	"InternetGateway":                  {"VPC"},
+	"RouteTable":                       {"VPC"},
+	"Route":                            {"RouteTable", "InternetGateway", "NATGateway"},
+	"RouteTableAssociation":            {"Subnet", "RouteTable"},
+	"NATGateway":                       {"Subnet", "EIP"},
+	"DefaultSecurityGroup":             {"VPC"},
+	"SubnetGroup":                      {"Subnet"},
+	"VPCEndpoint":                      {"VPC"},
+	"VPCEndpointRouteTableAssociation": {"VPCEndpoint", "RouteTable"},
+	"Firewall":                         {"VPC", "Subnet", "FirewallPolicy"},
+	"FirewallPolicy":                   {"RuleGroup"},
+}
+
+// validateRegionOverrides returns a ValidationError if any of
+// spec.regionOverrides isn't keyed by the kind of a resource the function can
+// compose, or doesn't map it to an AWS region. Subnets must stay in the region
+// of spec.availabilityZones, and an override mustn't separate a kind from the
+// kinds it references, or that reference it, since AWS resources can't
+// reference resources in another region.
+func (c Config) validateRegionOverrides() error {
+	kinds := make([]string, 0, len(c.RegionOverrides))
+	for kind := range c.RegionOverrides {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		field := fmt.Sprintf("spec.regionOverrides[%s]", kind)
+		if !isComposedKind(kind) {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%s is not a kind of resource the function composes", kind)}
+		}
+		region := c.RegionOverrides[kind]
+		if !config.LooksLikeRegion(region) {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%q is not an AWS region", region)}
+		}
+		// subnets are placed in spec.availabilityZones, so they must be in
+		// the region of the zones
+		for _, az := range c.AvailabilityZones {
+			if kind == "Subnet" && !inRegion(region, az) {
+				return &ValidationError{Field: field, Reason: fmt.Sprintf("availability zone %s is not in region %s", az, region)}
+			}
+		}
+	}
+
+	referrers := make([]string, 0, len(kindReferences))
+	for kind := range kindReferences {
+		referrers = append(referrers, kind)
+	}
+	sort.Strings(referrers)
+	regionOf := func(kind string) string {
+		if region, ok := c.RegionOverrides[kind]; ok {
+			return region
+		}
+		return c.Region
+	}
+	for _, kind := range referrers {
+		for _, ref := range kindReferences[kind] {
+			if regionOf(kind) == regionOf(ref) {
+				continue
+			}
+			// blame the override, of whichever of the two is overridden
+			overridden := kind
+			if _, ok := c.RegionOverrides[kind]; !ok {
+				overridden = ref
+			}
+			return &ValidationError{Field: fmt.Sprintf("spec.regionOverrides[%s]", overridden), Reason: fmt.Sprintf("would put %s resources in region %s, but the %s resources they reference are in region %s; override both to move them together", kind, regionOf(kind), ref, regionOf(ref))}
+		}
+	}
+	return nil
+}
+
+// isComposedKind returns true if the supplied kind is the kind of one of the
+// managed resources the function composes, such as VPC.
+func isComposedKind(kind string) bool {
+	for _, gv := range []schema.GroupVersion{awsv1beta1.CRDGroupVersion, rdsv1beta1.CRDGroupVersion, nfv1beta1.CRDGroupVersion} {
+		if _, ok := composed.Scheme.KnownTypes(gv)[kind]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// overrideRegion sets the region of the supplied desired composed resource to
+// the one spec.regionOverrides maps the supplied kind to, if any. Resources
+// without a spec.forProvider.region are left as they are.
+func overrideRegion(dc *composed.Unstructured, overrides map[string]string, kind string) error {
+	region, ok := overrides[kind]
+	if !ok {
+		return nil
+	}
+	if _, err := dc.GetValue("spec.forProvider.region"); err == nil {
+		return errors.Wrap(dc.SetValue("spec.forProvider.region", region), "cannot set spec.forProvider.region")
+	}
+	return nil
+}
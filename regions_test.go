@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/graph"
+)
+
+func TestInRegion(t *testing.T) {
+	type args struct {
+		region string
+		az     string
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   bool
+	}{
+		"KnownRegion": {
+			reason: "An availability zone listed for a known region should be in it",
+			args:   args{region: "eu-central-1", az: "eu-central-1b"},
+			want:   true,
+		},
+		"UnlistedAZ": {
+			reason: "An availability zone that isn't listed for a known region shouldn't be in it, even if it looks like it",
+			args:   args{region: "ap-northeast-1", az: "ap-northeast-1b"},
+			want:   false,
+		},
+		"WrongRegion": {
+			reason: "An availability zone of another region shouldn't be in the region",
+			args:   args{region: "eu-central-1", az: "us-west-2a"},
+			want:   false,
+		},
+		"UnknownRegion": {
+			reason: "An availability zone of a region that isn't listed should be matched by prefix",
+			args:   args{region: "me-central-1", az: "me-central-1a"},
+			want:   true,
+		},
+		"UnknownRegionMismatch": {
+			reason: "An availability zone that doesn't start with an unlisted region's name shouldn't be in it",
+			args:   args{region: "me-central-1", az: "me-south-1a"},
+			want:   false,
+		},
+		"UnknownRegionPrefixOnly": {
+			reason: "An availability zone must be its region's name followed by a single zone letter",
+			args:   args{region: "me-central-1", az: "me-central-12a"},
+			want:   false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := inRegion(tc.args.region, tc.args.az)
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\ninRegion(%q, %q): -want, +got:\n%s", tc.reason, tc.args.region, tc.args.az, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionRegionAZs(t *testing.T) {
+	type want struct {
+		azs     map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Valid": {
+			reason: "Availability zones in the region should get subnets",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"region": "us-west-2",
+					"privateSubnets": true,
+					"availabilityZones": ["us-west-2a", "us-west-2d"]
+				}
+			}`,
+			want: want{
+				azs: map[string]string{
+					"subnet-code-0-private-0": "us-west-2a",
+					"subnet-code-0-private-1": "us-west-2d",
+				},
+			},
+		},
+		"WrongRegion": {
+			reason: "An availability zone of another region should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"region": "us-west-2",
+					"privateSubnets": true,
+					"availabilityZones": ["us-west-2a", "eu-central-1a"]
+				}
+			}`,
+			want: want{
+				azs:     map[string]string{},
+				results: []string{"invalid network config: spec.availabilityZones[1]: eu-central-1a is not in region us-west-2"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.azs, desiredStrings(t, rsp, "spec.forProvider.availabilityZone")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want availability zones, +got availability zones:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionRegionAliases(t *testing.T) {
+	input := `{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"regionAliases": {"prod-eu": "eu-central-1"}
+	}`
+	xr := func(region string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"region": "` + region + `",
+				"privateSubnets": true,
+				"availabilityZones": ["eu-central-1a"]
+			}
+		}`
+	}
+
+	type want struct {
+		regions map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Alias": {
+			reason: "An alias should resolve to its region before the region is used",
+			xr:     xr("prod-eu"),
+			want: want{
+				regions: map[string]string{
+					"vpc-code-0":              "eu-central-1",
+					"subnet-code-0-private-0": "eu-central-1",
+				},
+			},
+		},
+		"Region": {
+			reason: "A region that isn't an alias should pass through",
+			xr:     xr("eu-central-1"),
+			want: want{
+				regions: map[string]string{
+					"vpc-code-0":              "eu-central-1",
+					"subnet-code-0-private-0": "eu-central-1",
+				},
+			},
+		},
+		"UnknownAlias": {
+			reason: "An unknown alias that doesn't look like a region should return a fatal result",
+			xr:     xr("prod-us"),
+			want: want{
+				regions: map[string]string{},
+				results: []string{`invalid network config: spec.region: "prod-us" is neither a region alias nor an AWS region`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input:    resource.MustStructJSON(input),
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.regions, desiredStrings(t, rsp, "spec.forProvider.region")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want regions, +got regions:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionRegionOverrides(t *testing.T) {
+	input := `{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"regionAliases": {"prod-us": "us-east-1"}
+	}`
+	xr := func(overrides string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"region": "eu-central-1",
+				"includeGateway": true,
+				"privateSubnets": true,
+				"availabilityZones": ["eu-central-1a"],
+				"prefixList": {"name": "corp", "maxEntries": 1, "entries": [{"cidr": "10.0.0.0/8", "description": "corp"}]},
+				"regionOverrides": ` + overrides + `
+			}
+		}`
+	}
+
+	type want struct {
+		regions map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Override": {
+			reason: "Resources of an overridden kind should use its region, and others the base region",
+			xr:     xr(`{"ManagedPrefixList": "us-west-2"}`),
+			want: want{
+				regions: map[string]string{
+					"vpc-code-0":              "eu-central-1",
+					"gateway-code-0":          "eu-central-1",
+					"subnet-code-0-private-0": "eu-central-1",
+					"prefixlist-code":         "us-west-2",
+				},
+			},
+		},
+		"Alias": {
+			reason: "An override should resolve region aliases like spec.region does",
+			xr:     xr(`{"ManagedPrefixList": "prod-us"}`),
+			want: want{
+				regions: map[string]string{
+					"vpc-code-0":              "eu-central-1",
+					"gateway-code-0":          "eu-central-1",
+					"subnet-code-0-private-0": "eu-central-1",
+					"prefixlist-code":         "us-east-1",
+				},
+			},
+		},
+		"SeparatedFromVPC": {
+			reason: "An override that moves a kind away from the VPC it references should return a fatal result",
+			xr:     xr(`{"InternetGateway": "us-west-2"}`),
+			want: want{
+				regions: map[string]string{},
+				results: []string{"invalid network config: spec.regionOverrides[InternetGateway]: would put InternetGateway resources in region us-west-2, but the VPC resources they reference are in region eu-central-1; override both to move them together"},
+			},
+		},
+		"SeparatedFromReferrers": {
+			reason: "An override that moves a kind away from the kinds that reference it should return a fatal result",
+			xr:     xr(`{"VPC": "eu-central-1", "EIP": "us-west-2"}`),
+			want: want{
+				regions: map[string]string{},
+				results: []string{"invalid network config: spec.regionOverrides[EIP]: would put NATGateway resources in region eu-central-1, but the EIP resources they reference are in region us-west-2; override both to move them together"},
+			},
+		},
+		"UnknownKind": {
+			reason: "An override of a kind the function doesn't compose should return a fatal result",
+			xr:     xr(`{"Bucket": "us-west-2"}`),
+			want: want{
+				regions: map[string]string{},
+				results: []string{"invalid network config: spec.regionOverrides[Bucket]: Bucket is not a kind of resource the function composes"},
+			},
+		},
+		"NotARegion": {
+			reason: "An override to something that isn't a region should return a fatal result",
+			xr:     xr(`{"InternetGateway": "us-west"}`),
+			want: want{
+				regions: map[string]string{},
+				results: []string{`invalid network config: spec.regionOverrides[InternetGateway]: "us-west" is neither a region alias nor an AWS region`},
+			},
+		},
+		"SubnetOutsideAZs": {
+			reason: "Subnets moved away from the region of their availability zones should return a fatal result",
+			xr:     xr(`{"Subnet": "us-west-2"}`),
+			want: want{
+				regions: map[string]string{},
+				results: []string{"invalid network config: spec.regionOverrides[Subnet]: availability zone eu-central-1a is not in region us-west-2"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input:    resource.MustStructJSON(input),
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.regions, desiredStrings(t, rsp, "spec.forProvider.region")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want regions, +got regions:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestKindReferences(t *testing.T) {
+	// a network composing every kind the function can reference
+	rsp := runXR(t, `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {
+			"id": "code",
+			"count": 1,
+			"region": "us-west-2",
+			"includeGateway": true,
+			"publicSubnets": true,
+			"privateSubnets": true,
+			"firewallSubnets": true,
+			"enableNetworkFirewall": true,
+			"natGatewayStrategy": "per-az",
+			"createDbSubnetGroup": true,
+			"s3GatewayEndpoint": true,
+			"lockdownDefaultSg": true,
+			"availabilityZones": ["us-west-2a", "us-west-2b"]
+		}
+	}`)
+	if msgs := resultMessages(rsp); len(msgs) > 0 {
+		t.Fatalf("f.RunFunction(...): unexpected results: %v", msgs)
+	}
+	desired, err := request.GetDesiredComposedResources(&fnv1.RunFunctionRequest{Desired: rsp.GetDesired()})
+	if err != nil {
+		t.Fatalf("request.GetDesiredComposedResources(...): unexpected error: %v", err)
+	}
+
+	// every reference between the composed resources should be between
+	// kinds that kindReferences keeps in the same region
+	for _, e := range graph.Edges(desired) {
+		from, to := desired[resource.Name(e.From)].Resource.GetKind(), desired[resource.Name(e.To)].Resource.GetKind()
+		if !slices.Contains(kindReferences[to], from) {
+			t.Errorf("%s references %s, but kindReferences[%s] doesn't list %s", e.To, e.From, to, from)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"sigs.k8s.io/yaml"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/pkg/errors"
+)
+
+// render runs the supplied Function against the RunFunctionRequest read from
+// the supplied YAML or JSON file, bypassing the gRPC server. It writes the
+// desired composed resources to w as a stream of YAML documents, sorted by
+// name.
+func render(ctx context.Context, f *Function, path string, w io.Writer) error {
+	b, err := os.ReadFile(path) //nolint:gosec // Reading a user supplied file is the point.
+	if err != nil {
+		return errors.Wrapf(err, "cannot read request file %q", path)
+	}
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return errors.Wrapf(err, "cannot convert request file %q to JSON", path)
+	}
+	req := &fnv1.RunFunctionRequest{}
+	if err := protojson.Unmarshal(j, req); err != nil {
+		return errors.Wrapf(err, "cannot unmarshal request file %q", path)
+	}
+
+	rsp, err := f.RunFunction(ctx, req)
+	if err != nil {
+		return errors.Wrap(err, "cannot run function")
+	}
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			return errors.Errorf("function returned a fatal result: %s", r.GetMessage())
+		}
+	}
+
+	for _, r := range DesiredResourcesSorted(rsp) {
+		j, err := protojson.Marshal(r.Resource.GetResource())
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal desired resource %q", r.Name)
+		}
+		y, err := yaml.JSONToYAML(j)
+		if err != nil {
+			return errors.Wrapf(err, "cannot convert desired resource %q to YAML", r.Name)
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", y); err != nil {
+			return errors.Wrap(err, "cannot write desired resource")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+)
+
+func TestRender(t *testing.T) {
+	type want struct {
+		out string
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		path   string
+		want   want
+	}{
+		"SampleRequest": {
+			reason: "The desired resources for the sample request should be printed as YAML documents sorted by name",
+			path:   "testdata/request.yaml",
+			want: want{
+				out: `---
+apiVersion: ec2.aws.upbound.io/v1beta1
+kind: InternetGateway
+metadata:
+  labels:
+    networks.meta.fn.crossplane.io/network-id: code
+  name: gateway-code-0
+spec:
+  forProvider:
+    region: eu-central-1
+    tags:
+      Name: gateway-code-0
+    vpcIdSelector:
+      matchControllerRef: true
+      matchLabels:
+        networks.meta.fn.crossplane.io/vpc-id: vpc-code-0
+  providerConfigRef:
+    name: default
+---
+apiVersion: ec2.aws.upbound.io/v1beta1
+kind: VPC
+metadata:
+  annotations:
+    networks.meta.fn.crossplane.io/cidr: 192.168.0.0/16
+  labels:
+    networks.meta.fn.crossplane.io/network-id: code
+    networks.meta.fn.crossplane.io/role: primary
+    networks.meta.fn.crossplane.io/vpc-id: vpc-code-0
+  name: vpc-code-0
+spec:
+  forProvider:
+    cidrBlock: 192.168.0.0/16
+    enableDnsHostnames: true
+    enableDnsSupport: true
+    region: eu-central-1
+    tags:
+      Name: vpc-code-0
+  providerConfigRef:
+    name: default
+`,
+			},
+		},
+		"InitialRender": {
+			reason: "A request without observed state should render nothing, without an error, when the input allows a missing XR",
+			path:   "testdata/initial-request.yaml",
+			want:   want{out: ""},
+		},
+		"MissingFile": {
+			reason: "A request file that doesn't exist should return an error",
+			path:   "testdata/missing.yaml",
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			out := &bytes.Buffer{}
+			err := render(context.Background(), f, tc.path, out)
+
+			if diff := cmp.Diff(tc.want.out, out.String()); diff != "" {
+				t.Errorf("%s\nrender(...): -want output, +got output:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != (err != nil) {
+				t.Errorf("%s\nrender(...): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+		})
+	}
+}
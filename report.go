@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// A networkSummary reports on the observed composed resources of an XR.
+type networkSummary struct {
+	// Total number of observed composed resources.
+	Total int `json:"total"`
+
+	// Synced is how many of them are Synced.
+	Synced int `json:"synced"`
+
+	// Ready is how many of them are Ready.
+	Ready int `json:"ready"`
+
+	// Kinds maps each kind to how many of the resources are of it.
+	Kinds map[string]int `json:"kinds"`
+
+	// CIDRBlocks maps the name of each VPC and Subnet to its IPv4 CIDR
+	// block, when known.
+	CIDRBlocks map[string]string `json:"cidrBlocks,omitempty"`
+}
+
+// String returns a one line description of the summary.
+func (s networkSummary) String() string {
+	return fmt.Sprintf("%d composed resources, %d ready, %d synced", s.Total, s.Ready, s.Synced)
+}
+
+// summarizeNetwork summarizes the supplied observed composed resources. Unlike
+// networkHealth it doesn't require them to carry this function's labels, since
+// in report mode something else composes them.
+func summarizeNetwork(observed map[resource.Name]resource.ObservedComposed) networkSummary {
+	s := networkSummary{Kinds: map[string]int{}}
+	for name, oc := range observed {
+		s.Total++
+		s.Kinds[oc.Resource.GetKind()]++
+		if oc.Resource.GetCondition(xpv1.TypeSynced).Status == corev1.ConditionTrue {
+			s.Synced++
+		}
+		if oc.Resource.GetCondition(xpv1.TypeReady).Status == corev1.ConditionTrue {
+			s.Ready++
+		}
+
+		if k := oc.Resource.GetKind(); k != "VPC" && k != "Subnet" {
+			continue
+		}
+		// prefer the block AWS reports, falling back to the one requested
+		for _, path := range []string{"status.atProvider.cidrBlock", "spec.forProvider.cidrBlock"} {
+			if cidr, _ := oc.Resource.GetString(path); cidr != "" {
+				if s.CIDRBlocks == nil {
+					s.CIDRBlocks = map[string]string{}
+				}
+				s.CIDRBlocks[string(name)] = cidr
+				break
+			}
+		}
+	}
+	return s
+}
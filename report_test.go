@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionReportMode(t *testing.T) {
+	xr := func(mode string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "code", "count": 1, "includeGateway": true, "mode": "` + mode + `"}
+		}`
+	}
+	observed := map[string]*fnv1.Resource{
+		"vpc": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "VPC",
+			"metadata": {"name": "vpc"},
+			"spec": {"forProvider": {"cidrBlock": "10.0.0.0/16"}},
+			"status": {
+				"atProvider": {"cidrBlock": "10.0.0.0/16"},
+				"conditions": [
+					{"type": "Synced", "status": "True"},
+					{"type": "Ready", "status": "True"}
+				]
+			}
+		}`)},
+		"subnet": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "Subnet",
+			"metadata": {"name": "subnet"},
+			"spec": {"forProvider": {"cidrBlock": "10.0.1.0/24"}},
+			"status": {"conditions": [{"type": "Synced", "status": "True"}]}
+		}`)},
+		"gateway": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "InternetGateway",
+			"metadata": {"name": "gateway"}
+		}`)},
+	}
+
+	type want struct {
+		desired int
+		summary any
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Report": {
+			reason: "Report mode should summarize the observed resources in the XR's status without composing any",
+			xr:     xr("report"),
+			want: want{
+				summary: map[string]any{
+					"total":  float64(3),
+					"synced": float64(2),
+					"ready":  float64(1),
+					"kinds": map[string]any{
+						"VPC":             float64(1),
+						"Subnet":          float64(1),
+						"InternetGateway": float64(1),
+					},
+					"cidrBlocks": map[string]any{
+						"vpc":    "10.0.0.0/16",
+						"subnet": "10.0.1.0/24",
+					},
+				},
+				results: []string{`Network "code" has 3 composed resources, 1 ready, 2 synced`},
+			},
+		},
+		"Compose": {
+			reason: "Compose mode should compose the network without a summary",
+			xr:     xr("compose"),
+			want:   want{desired: 2},
+		},
+		"UnknownMode": {
+			reason: "An unknown mode should return a fatal result",
+			xr:     xr("observe"),
+			want: want{
+				results: []string{`invalid network config: spec.mode: must be compose or report, got "observe"`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)},
+					Resources: observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var results []string
+			for _, r := range rsp.GetResults() {
+				switch r.GetReason() {
+				case reasonNetworkSummary, "":
+					results = append(results, r.GetMessage())
+				}
+			}
+			if diff := cmp.Diff(tc.want.results, results); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.desired, len(rsp.GetDesired().GetResources())); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want desired resources, +got desired resources:\n%s", tc.reason, diff)
+			}
+			got, _ := fieldpath.Pave(rsp.GetDesired().GetComposite().GetResource().AsMap()).GetValue("status.summary")
+			if diff := cmp.Diff(tc.want.summary, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want status.summary, +got status.summary:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
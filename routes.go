@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/names"
+
+	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+)
+
+// defaultIGWRouteCIDRs are the destinations routed to a VPC's InternetGateway
+// unless spec.igwRouteCidrs says otherwise.
+var defaultIGWRouteCIDRs = []string{"0.0.0.0/0"}
+
+// routesPublicSubnets returns true if the config's public subnets should be
+// routed to their VPC's InternetGateway.
+func (c Config) routesPublicSubnets() bool {
+	return c.IncludeGateway && c.PublicSubnets && len(c.AvailabilityZones) > 0
+}
+
+// routesPrivateSubnetsPerAZ returns true if the config's private subnets should
+// be associated with a route table in their own availability zone. NAT gateways
+// are routed to from these tables, so they imply them.
+func (c Config) routesPrivateSubnetsPerAZ() bool {
+	return (c.PrivateRouteTablePerAZ || c.NATGatewayStrategy != "") && c.PrivateSubnets && len(c.AvailabilityZones) > 0
+}
+
+// routeTablesByAZ returns the name of the route table of the supplied subnet
+// tier in each of the config's availability zones, in the i'th VPC.
+func (c Config) routeTablesByAZ(i int64, tier string) map[string]string {
+	tables := make(map[string]string, len(c.AvailabilityZones))
+	for j, az := range c.AvailabilityZones {
+		tables[az] = names.AZRouteTableName(c.ID, i, tier, c.azSlot(j))
+	}
+	return tables
+}
+
+// azRouteTable returns the route table, of the supplied route tables keyed by
+// availability zone, that's in the same availability zone as the supplied
+// subnet. It returns an error if there's none.
+func azRouteTable(tables map[string]string, s subnet) (string, error) {
+	rt, ok := tables[s.AZ]
+	if !ok {
+		return "", errors.Errorf("subnet %q is in availability zone %q, which has no %s route table", s.Name, s.AZ, s.Tier)
+	}
+	return rt, nil
+}
+
+// validateIGWRouteCIDRs returns a ValidationError if any of the destinations
+// routed to the InternetGateway isn't a CIDR block.
+func (c Config) validateIGWRouteCIDRs() error {
+	if c.IGWRouteCIDRs == nil {
+		return nil
+	}
+	if len(c.IGWRouteCIDRs) == 0 {
+		return &ValidationError{Field: "spec.igwRouteCidrs", Reason: "must not be empty when set"}
+	}
+	for i, cidr := range c.IGWRouteCIDRs {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			return &ValidationError{Field: fmt.Sprintf("spec.igwRouteCidrs[%d]", i), Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// igwRouteCIDRs returns the destinations to route to the InternetGateway.
+func (c Config) igwRouteCIDRs() []string {
+	if c.IGWRouteCIDRs != nil {
+		return c.IGWRouteCIDRs
+	}
+	return defaultIGWRouteCIDRs
+}
+
+// newRouteTable returns a RouteTable with the supplied name, in the named VPC,
+// for subnets of the supplied tier. The VPC is selected by label unless
+// managed labels are disabled, in which case it's referenced by name.
+func newRouteTable(cfg Config, name, vpcName, tier string) *awsv1beta1.RouteTable {
+	rt := &awsv1beta1.RouteTable{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID:  cfg.ID,
+				labelVPCID:      cfg.vpcIDLabel(vpcName),
+				labelSubnetTier: tier,
+			}),
+		},
+		Spec: awsv1beta1.RouteTableSpec{
+			ForProvider: awsv1beta1.RouteTableParameters_2{
+				Region: ptr.To(cfg.Region),
+				Tags:   tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+
+	if cfg.DisableManagedLabels {
+		rt.Spec.ForProvider.VPCIDRef = &v1.Reference{Name: vpcName}
+		return rt
+	}
+	rt.Spec.ForProvider.VPCIDSelector = &v1.Selector{
+		MatchControllerRef: ptr.To(true),
+		MatchLabels: map[string]string{
+			labelVPCID: cfg.vpcIDLabel(vpcName),
+		},
+	}
+	return rt
+}
+
+// newGatewayRoute returns a Route with the supplied name that sends traffic
+// for the supplied destination CIDR block from the named route table to the
+// named InternetGateway. It's composed at v1beta2 when the Function input pins
+// that version.
+func newGatewayRoute(cfg Config, name, routeTableName, gatewayName, destination string) runtime.Object {
+	r := &awsv1beta1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+			}),
+		},
+		Spec: awsv1beta1.RouteSpec{
+			ForProvider: awsv1beta1.RouteParameters_2{
+				Region:          ptr.To(cfg.Region),
+				RouteTableIDRef: &v1.Reference{Name: routeTableName},
+				GatewayIDRef:    &v1.Reference{Name: gatewayName},
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+
+	// validate ensures the destination parses
+	if p, _ := netip.ParsePrefix(destination); p.Addr().Is6() {
+		r.Spec.ForProvider.DestinationIPv6CidrBlock = ptr.To(destination)
+		return routeAtVersion(cfg, r)
+	}
+	r.Spec.ForProvider.DestinationCidrBlock = ptr.To(destination)
+	return routeAtVersion(cfg, r)
+}
+
+// newRouteTableAssociation returns a RouteTableAssociation with the supplied
+// name, associating the named subnet with the named route table.
+func newRouteTableAssociation(cfg Config, name, subnetName, routeTableName string) *awsv1beta1.RouteTableAssociation {
+	return &awsv1beta1.RouteTableAssociation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+			}),
+		},
+		Spec: awsv1beta1.RouteTableAssociationSpec{
+			ForProvider: awsv1beta1.RouteTableAssociationParameters{
+				Region:          ptr.To(cfg.Region),
+				SubnetIDRef:     &v1.Reference{Name: subnetName},
+				RouteTableIDRef: &v1.Reference{Name: routeTableName},
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+}
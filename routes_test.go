@@ -0,0 +1,299 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunFunctionIGWRoutes(t *testing.T) {
+	type want struct {
+		destinations     map[string]string
+		ipv6Destinations map[string]string
+		routeTables      map[string]string
+		subnets          map[string]string
+		results          []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"DefaultRoute": {
+			reason: "Public subnets should get a default route to their VPC's InternetGateway",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"includeGateway": true,
+					"publicSubnets": true,
+					"privateSubnets": true,
+					"availabilityZones": ["eu-central-1a", "eu-central-1b"]
+				}
+			}`,
+			want: want{
+				destinations:     map[string]string{"route-code-0-public-0": "0.0.0.0/0"},
+				ipv6Destinations: map[string]string{},
+				routeTables: map[string]string{
+					"route-code-0-public-0":          "routetable-code-0-public",
+					"rtassoc-subnet-code-0-public-0": "routetable-code-0-public",
+					"rtassoc-subnet-code-0-public-1": "routetable-code-0-public",
+				},
+				subnets: map[string]string{
+					"rtassoc-subnet-code-0-public-0": "subnet-code-0-public-0",
+					"rtassoc-subnet-code-0-public-1": "subnet-code-0-public-1",
+				},
+			},
+		},
+		"CustomRoutes": {
+			reason: "Each of spec.igwRouteCidrs should become a separate route to the InternetGateway",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"includeGateway": true,
+					"publicSubnets": true,
+					"availabilityZones": ["eu-central-1a"],
+					"igwRouteCidrs": ["203.0.113.0/24", "198.51.100.0/24", "2001:db8::/32"]
+				}
+			}`,
+			want: want{
+				destinations: map[string]string{
+					"route-code-0-public-0": "203.0.113.0/24",
+					"route-code-0-public-1": "198.51.100.0/24",
+				},
+				ipv6Destinations: map[string]string{
+					"route-code-0-public-2": "2001:db8::/32",
+				},
+				routeTables: map[string]string{
+					"route-code-0-public-0":          "routetable-code-0-public",
+					"route-code-0-public-1":          "routetable-code-0-public",
+					"route-code-0-public-2":          "routetable-code-0-public",
+					"rtassoc-subnet-code-0-public-0": "routetable-code-0-public",
+				},
+				subnets: map[string]string{
+					"rtassoc-subnet-code-0-public-0": "subnet-code-0-public-0",
+				},
+			},
+		},
+		"NoGateway": {
+			reason: "Public subnets shouldn't be routed anywhere without an InternetGateway",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"publicSubnets": true,
+					"availabilityZones": ["eu-central-1a"]
+				}
+			}`,
+			want: want{
+				destinations:     map[string]string{},
+				ipv6Destinations: map[string]string{},
+				routeTables:      map[string]string{},
+				subnets:          map[string]string{},
+			},
+		},
+		"InvalidCIDR": {
+			reason: "A route destination that isn't a CIDR block should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"includeGateway": true,
+					"publicSubnets": true,
+					"availabilityZones": ["eu-central-1a"],
+					"igwRouteCidrs": ["203.0.113.0/24", "203.0.113.0"]
+				}
+			}`,
+			want: want{
+				destinations:     map[string]string{},
+				ipv6Destinations: map[string]string{},
+				routeTables:      map[string]string{},
+				subnets:          map[string]string{},
+				results:          []string{`invalid network config: spec.igwRouteCidrs[1]: netip.ParsePrefix("203.0.113.0"): no '/'`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.destinations, desiredStrings(t, rsp, "spec.forProvider.destinationCidrBlock")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want destinations, +got destinations:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ipv6Destinations, desiredStrings(t, rsp, "spec.forProvider.destinationIpv6CidrBlock")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want IPv6 destinations, +got IPv6 destinations:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.routeTables, desiredStrings(t, rsp, "spec.forProvider.routeTableIdRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want route tables, +got route tables:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.subnets, desiredStrings(t, rsp, "spec.forProvider.subnetIdRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want subnets, +got subnets:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionPrivateRouteTablePerAZ(t *testing.T) {
+	type want struct {
+		routeTables map[string]string
+		subnets     map[string]string
+		results     []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"AZMatched": {
+			reason: "Each private subnet should be associated with the route table in its own AZ",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"privateSubnets": true,
+					"privateRouteTablePerAz": true,
+					"availabilityZones": ["eu-central-1a", "eu-central-1b", "eu-central-1c"]
+				}
+			}`,
+			want: want{
+				routeTables: map[string]string{
+					"rtassoc-subnet-code-0-private-0": "routetable-code-0-private-0",
+					"rtassoc-subnet-code-0-private-1": "routetable-code-0-private-1",
+					"rtassoc-subnet-code-0-private-2": "routetable-code-0-private-2",
+				},
+				subnets: map[string]string{
+					"rtassoc-subnet-code-0-private-0": "subnet-code-0-private-0",
+					"rtassoc-subnet-code-0-private-1": "subnet-code-0-private-1",
+					"rtassoc-subnet-code-0-private-2": "subnet-code-0-private-2",
+				},
+			},
+		},
+		"WithPublicSubnets": {
+			reason: "Public subnets should keep sharing their route table while private subnets use their AZ's",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"includeGateway": true,
+					"publicSubnets": true,
+					"privateSubnets": true,
+					"privateRouteTablePerAz": true,
+					"availabilityZones": ["eu-central-1a", "eu-central-1b"]
+				}
+			}`,
+			want: want{
+				routeTables: map[string]string{
+					"route-code-0-public-0":           "routetable-code-0-public",
+					"rtassoc-subnet-code-0-public-0":  "routetable-code-0-public",
+					"rtassoc-subnet-code-0-public-1":  "routetable-code-0-public",
+					"rtassoc-subnet-code-0-private-0": "routetable-code-0-private-0",
+					"rtassoc-subnet-code-0-private-1": "routetable-code-0-private-1",
+				},
+				subnets: map[string]string{
+					"rtassoc-subnet-code-0-public-0":  "subnet-code-0-public-0",
+					"rtassoc-subnet-code-0-public-1":  "subnet-code-0-public-1",
+					"rtassoc-subnet-code-0-private-0": "subnet-code-0-private-0",
+					"rtassoc-subnet-code-0-private-1": "subnet-code-0-private-1",
+				},
+			},
+		},
+		"NoPrivateSubnets": {
+			reason: "Per-AZ route tables without private subnets should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"privateRouteTablePerAz": true,
+					"availabilityZones": ["eu-central-1a"]
+				}
+			}`,
+			want: want{
+				routeTables: map[string]string{},
+				subnets:     map[string]string{},
+				results:     []string{"invalid network config: spec.privateRouteTablePerAz: requires spec.privateSubnets and at least one availability zone"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.routeTables, desiredStrings(t, rsp, "spec.forProvider.routeTableIdRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want route tables, +got route tables:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.subnets, desiredStrings(t, rsp, "spec.forProvider.subnetIdRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want subnets, +got subnets:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAZRouteTable(t *testing.T) {
+	tables := map[string]string{"eu-central-1a": "routetable-code-0-private-0"}
+
+	cases := map[string]struct {
+		reason string
+		s      subnet
+		want   string
+		err    string
+	}{
+		"SameAZ": {
+			reason: "A subnet should get the route table in its AZ",
+			s:      subnet{Name: "subnet-code-0-private-0", Tier: tierPrivate, AZ: "eu-central-1a"},
+			want:   "routetable-code-0-private-0",
+		},
+		"NoTableInAZ": {
+			reason: "A subnet in an AZ without a route table should return an error rather than share another AZ's",
+			s:      subnet{Name: "subnet-code-0-private-1", Tier: tierPrivate, AZ: "eu-central-1b"},
+			err:    `subnet "subnet-code-0-private-1" is in availability zone "eu-central-1b", which has no private route table`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := azRouteTable(tables, tc.s)
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(tc.err, gotErr); diff != "" {
+				t.Errorf("%s\nazRouteTable(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nazRouteTable(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+
+	awsv1beta1 "github.com/upbound/provider-aws/apis/ec2/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// newDefaultSecurityGroup returns a DefaultSecurityGroup with the supplied name
+// that adopts the default security group AWS creates in the named VPC. It has
+// no ingress rules, and no egress rules unless spec.defaultEgressCidr allows
+// egress to a CIDR block, so AWS revokes the default group's allow-all rules.
+// The VPC is selected by label unless managed labels are disabled, in which
+// case it's referenced by name.
+func newDefaultSecurityGroup(cfg Config, name, vpcName string) *awsv1beta1.DefaultSecurityGroup {
+	sg := &awsv1beta1.DefaultSecurityGroup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: cfg.managedLabels(map[string]string{
+				labelNetworkID: cfg.ID,
+				labelVPCID:     cfg.vpcIDLabel(vpcName),
+			}),
+		},
+		Spec: awsv1beta1.DefaultSecurityGroupSpec{
+			ForProvider: awsv1beta1.DefaultSecurityGroupParameters{
+				Region: ptr.To(cfg.Region),
+				Tags:   tagsFor(cfg, name),
+			},
+			ResourceSpec: v1.ResourceSpec{
+				ProviderConfigReference: &v1.Reference{Name: cfg.ProviderConfigName},
+			},
+		},
+	}
+
+	if cfg.DefaultEgressCIDR != "" {
+		sg.Spec.ForProvider.Egress = []awsv1beta1.DefaultSecurityGroupEgressParameters{{
+			Description: ptr.To("All traffic to " + cfg.DefaultEgressCIDR),
+			CidrBlocks:  []*string{ptr.To(cfg.DefaultEgressCIDR)},
+			Protocol:    ptr.To("-1"),
+			FromPort:    ptr.To[float64](0),
+			ToPort:      ptr.To[float64](0),
+		}}
+	}
+
+	if cfg.DisableManagedLabels {
+		sg.Spec.ForProvider.VPCIDRef = &v1.Reference{Name: vpcName}
+		return sg
+	}
+	sg.Spec.ForProvider.VPCIDSelector = &v1.Selector{
+		MatchControllerRef: ptr.To(true),
+		MatchLabels: map[string]string{
+			labelVPCID: cfg.vpcIDLabel(vpcName),
+		},
+	}
+	return sg
+}
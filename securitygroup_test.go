@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunFunctionLockdownDefaultSG(t *testing.T) {
+	type want struct {
+		vpcSelectors map[string]string
+		egress       map[string]string
+		egressCIDRs  map[string]string
+		ingress      map[string]string
+		results      []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"PerVPC": {
+			reason: "Each VPC should get a DefaultSecurityGroup without rules, selecting the VPC by label",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 2,
+					"lockdownDefaultSg": true
+				}
+			}`,
+			want: want{
+				vpcSelectors: map[string]string{
+					"defaultsg-code-0": "vpc-code-0",
+					"defaultsg-code-1": "vpc-code-1",
+				},
+				egress:      map[string]string{},
+				egressCIDRs: map[string]string{},
+				ingress:     map[string]string{},
+			},
+		},
+		"RestrictedEgress": {
+			reason: "Each DefaultSecurityGroup should allow all egress to spec.defaultEgressCidr, and nothing else",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 2,
+					"lockdownDefaultSg": true,
+					"defaultEgressCidr": "10.0.0.0/8"
+				}
+			}`,
+			want: want{
+				vpcSelectors: map[string]string{
+					"defaultsg-code-0": "vpc-code-0",
+					"defaultsg-code-1": "vpc-code-1",
+				},
+				egress: map[string]string{
+					"defaultsg-code-0": "-1",
+					"defaultsg-code-1": "-1",
+				},
+				egressCIDRs: map[string]string{
+					"defaultsg-code-0": "10.0.0.0/8",
+					"defaultsg-code-1": "10.0.0.0/8",
+				},
+				ingress: map[string]string{},
+			},
+		},
+		"InvalidEgressCIDR": {
+			reason: "A spec.defaultEgressCidr that doesn't parse should return a fatal result",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 2,
+					"lockdownDefaultSg": true,
+					"defaultEgressCidr": "10.0.0.0"
+				}
+			}`,
+			want: want{
+				vpcSelectors: map[string]string{},
+				egress:       map[string]string{},
+				egressCIDRs:  map[string]string{},
+				ingress:      map[string]string{},
+				results:      []string{`invalid network config: spec.defaultEgressCidr: cannot parse CIDR block "10.0.0.0": netip.ParsePrefix("10.0.0.0"): no '/'`},
+			},
+		},
+		"Disabled": {
+			reason: "No DefaultSecurityGroup should be composed unless spec.lockdownDefaultSg is set",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 2
+				}
+			}`,
+			want: want{
+				vpcSelectors: map[string]string{},
+				egress:       map[string]string{},
+				egressCIDRs:  map[string]string{},
+				ingress:      map[string]string{},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			// the XRs compose no gateways, subnets or route tables, so only
+			// security groups select VPCs
+			if diff := cmp.Diff(tc.want.vpcSelectors, desiredStrings(t, rsp, "spec.forProvider.vpcIdSelector.matchLabels[networks.meta.fn.crossplane.io/vpc-id]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want VPC selectors, +got VPC selectors:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.egress, desiredStrings(t, rsp, "spec.forProvider.egress[0].protocol")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want egress rules, +got egress rules:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.egressCIDRs, desiredStrings(t, rsp, "spec.forProvider.egress[0].cidrBlocks[0]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want egress CIDR blocks, +got egress CIDR blocks:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ingress, desiredStrings(t, rsp, "spec.forProvider.ingress[0].protocol")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want ingress rules, +got ingress rules:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
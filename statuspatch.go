@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gomodules.xyz/jsonpatch/v2"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// statusPatch returns the JSON patch that takes the supplied observed XR's
+// status to the status the supplied response desires of it, sorted by path.
+// Only the status fields the response sets are compared, because Crossplane
+// leaves the others, like the XR's conditions, as they are.
+func statusPatch(oxr *resource.Composite, rsp *fnv1.RunFunctionResponse, rw IO) ([]jsonpatch.Operation, error) {
+	dxr, err := rw.GetDesiredCompositeResource(&fnv1.RunFunctionRequest{Desired: rsp.GetDesired()})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get desired composite resource")
+	}
+	desired, _ := dxr.Resource.Object["status"].(map[string]any)
+	all, _ := oxr.Resource.Object["status"].(map[string]any)
+	observed := make(map[string]any, len(desired))
+	for field := range desired {
+		if v, ok := all[field]; ok {
+			observed[field] = v
+		}
+	}
+
+	o, err := json.Marshal(map[string]any{"status": observed})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal observed status")
+	}
+	d, err := json.Marshal(map[string]any{"status": desired})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal desired status")
+	}
+	patch, err := jsonpatch.CreatePatch(o, d)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot diff observed and desired status")
+	}
+	sort.Sort(jsonpatch.ByPath(patch))
+	return patch, nil
+}
+
+// emitStatusPatch adds a StatusPatch result to the supplied response holding
+// the JSON patch it applies to the supplied observed XR's status, unless it
+// leaves the status as it is.
+func emitStatusPatch(oxr *resource.Composite, rsp *fnv1.RunFunctionResponse, rw IO) error {
+	patch, err := statusPatch(oxr, rsp, rw)
+	if err != nil {
+		return errors.Wrap(err, "cannot compute status patch")
+	}
+	if len(patch) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(patch)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal status patch")
+	}
+	response.Normalf(rsp, "XR status will change: %s", b).WithReason(reasonStatusPatch)
+	return nil
+}
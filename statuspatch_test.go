@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRunFunctionStatusPatch(t *testing.T) {
+	xr := func(emit bool, status string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "code", "count": 1, "mode": "report", "emitStatusPatch": ` + strconv.FormatBool(emit) + `},
+			"status": ` + status + `
+		}`
+	}
+	observed := map[string]*fnv1.Resource{
+		"vpc": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "ec2.aws.upbound.io/v1beta1",
+			"kind": "VPC",
+			"metadata": {"name": "vpc"},
+			"status": {"conditions": [
+				{"type": "Synced", "status": "True"},
+				{"type": "Ready", "status": "True"}
+			]}
+		}`)},
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   []string
+	}{
+		"Disabled": {
+			reason: "No status patch should be emitted unless the XR asks for one",
+			xr:     xr(false, `{}`),
+		},
+		"NewField": {
+			reason: "A status field the XR doesn't have yet should be added as a whole",
+			xr:     xr(true, `{}`),
+			want:   []string{`XR status will change: [{"op":"add","path":"/status/summary","value":{"kinds":{"VPC":1},"ready":1,"synced":1,"total":1}}]`},
+		},
+		"ChangedField": {
+			reason: "A changed status field should be replaced, ignoring status fields the function doesn't set",
+			xr: xr(true, `{
+				"conditions": [{"type": "Ready", "status": "False"}],
+				"summary": {"kinds": {"VPC": 1}, "ready": 0, "synced": 1, "total": 1}
+			}`),
+			want: []string{`XR status will change: [{"op":"replace","path":"/status/summary/ready","value":1}]`},
+		},
+		"Unchanged": {
+			reason: "No status patch should be emitted when the status won't change",
+			xr:     xr(true, `{"summary": {"kinds": {"VPC": 1}, "ready": 1, "synced": 1, "total": 1}}`),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)},
+					Resources: observed,
+				},
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var got []string
+			for _, r := range rsp.GetResults() {
+				if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+					t.Fatalf("%s\nf.RunFunction(...): unexpected fatal result: %s", tc.reason, r.GetMessage())
+				}
+				if r.GetReason() == reasonStatusPatch {
+					got = append(got, r.GetMessage())
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want status patch, +got status patch:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
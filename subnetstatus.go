@@ -0,0 +1,35 @@
+package main
+
+// subnetStatus is a subnet the function composes, as written to the XR's
+// status.subnets.
+type subnetStatus struct {
+	Name             string `json:"name"`
+	VPC              string `json:"vpc"`
+	Tier             string `json:"tier"`
+	AvailabilityZone string `json:"availabilityZone"`
+	CIDRBlock        string `json:"cidrBlock"`
+
+	// AvailableIPs is how many of the subnet's addresses instances can use.
+	AvailableIPs int64 `json:"availableIps"`
+}
+
+// subnetStatuses returns the status of each of the supplied subnets of the
+// named VPC.
+func subnetStatuses(vpcName string, subnets []subnet) ([]subnetStatus, error) {
+	statuses := make([]subnetStatus, 0, len(subnets))
+	for _, s := range subnets {
+		n, err := availableIPs(s.CIDR)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, subnetStatus{
+			Name:             s.Name,
+			VPC:              vpcName,
+			Tier:             s.Tier,
+			AvailabilityZone: s.AZ,
+			CIDRBlock:        s.CIDR,
+			AvailableIPs:     n,
+		})
+	}
+	return statuses, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+)
+
+func TestRunFunctionReportSubnets(t *testing.T) {
+	xr := func(report string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"cidrBlock": "10.0.0.0/16",
+				"publicSubnets": true,
+				"privateSubnets": true,
+				"availabilityZones": ["eu-central-1a"],
+				"reportSubnets": ` + report + `
+			}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   any
+	}{
+		"Disabled": {
+			reason: "The XR's status should be left alone unless the report is enabled",
+			xr:     xr("false"),
+		},
+		"Enabled": {
+			reason: "Each subnet should be reported in the XR's status with its usable addresses",
+			xr:     xr("true"),
+			want: []any{
+				map[string]any{
+					"name":             "subnet-code-0-public-0",
+					"vpc":              "vpc-code-0",
+					"tier":             "public",
+					"availabilityZone": "eu-central-1a",
+					"cidrBlock":        "10.0.0.0/24",
+					"availableIps":     float64(251),
+				},
+				map[string]any{
+					"name":             "subnet-code-0-private-0",
+					"vpc":              "vpc-code-0",
+					"tier":             "private",
+					"availabilityZone": "eu-central-1a",
+					"cidrBlock":        "10.0.1.0/24",
+					"availableIps":     float64(251),
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			got, _ := fieldpath.Pave(rsp.GetDesired().GetComposite().GetResource().AsMap()).GetValue("status.subnets")
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want status.subnets, +got status.subnets:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+
+	"k8s.io/utils/ptr"
+)
+
+// tagsFor returns the AWS tags for the named resource. Every resource gets a
+// Name tag matching its name, which spec.tags can override. Any extra tags,
+// such as those for a subnet tier, are merged over spec.tags in order.
+func tagsFor(cfg Config, name string, extra ...map[string]string) map[string]*string {
+	tags := map[string]*string{"Name": ptr.To(name)}
+	for _, src := range append([]map[string]string{cfg.Tags}, extra...) {
+		for k, v := range src {
+			tags[k] = ptr.To(v)
+		}
+	}
+	return tags
+}
+
+// contextTags returns the tags at the supplied key of the request's pipeline
+// context, or none if the context doesn't have the key. It returns an error if
+// the key isn't a map of strings, or if AWS would reject any of its tags.
+func contextTags(req *fnv1.RunFunctionRequest, rw IO, key string) (map[string]string, error) {
+	v, ok := rw.GetContextKey(req, key)
+	if !ok {
+		return nil, nil
+	}
+	if v.GetStructValue() == nil {
+		return nil, errors.Errorf("context key %q is not an object", key)
+	}
+	tags := make(map[string]string, len(v.GetStructValue().GetFields()))
+	for k, v := range v.GetStructValue().GetFields() {
+		if _, ok := v.GetKind().(*structpb.Value_StringValue); !ok {
+			return nil, errors.Errorf("context key %q: value of tag %q is not a string", key, k)
+		}
+		tags[k] = v.GetStringValue()
+	}
+	if err := validateTags(tags); err != nil {
+		return nil, errors.Wrapf(err, "context key %q", key)
+	}
+	return tags, nil
+}
+
+// withDefaultTags returns the supplied tags merged over the supplied defaults.
+func withDefaultTags(tags, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return tags
+	}
+	out := make(map[string]string, len(defaults)+len(tags))
+	for k, v := range defaults {
+		out[k] = v
+	}
+	for k, v := range tags {
+		out[k] = v
+	}
+	return out
+}
+
+// clusterTagValue marks a subnet as shared by clusters that discover it, rather
+// than owned by one.
+const clusterTagValue = "shared"
+
+// maxClusterNameLength is the longest name EKS allows for a cluster.
+const maxClusterNameLength = 100
+
+// clusterNameChars matches the names EKS allows for a cluster.
+var clusterNameChars = regexp.MustCompile(`^[0-9A-Za-z][A-Za-z0-9\-_]*$`)
+
+// validateClusterName returns an error if the supplied name isn't a valid EKS
+// cluster name.
+func validateClusterName(name string) error {
+	if utf8.RuneCountInString(name) > maxClusterNameLength {
+		return errors.Errorf("cluster name %q is longer than %d characters", name, maxClusterNameLength)
+	}
+	if !clusterNameChars.MatchString(name) {
+		return errors.Errorf("cluster name %q must start with a letter or digit, and contain only letters, digits, hyphens, and underscores", name)
+	}
+	return nil
+}
+
+// clusterTags returns the tags that let Kubernetes clusters, such as those
+// managed by EKS or kOps, discover subnets of the supplied tier: the cluster
+// tag, plus the role tag that selects subnets for public or internal load
+// balancers.
+func (c Config) clusterTags(tier string) map[string]string {
+	if c.ClusterName == "" {
+		return nil
+	}
+	tags := map[string]string{"kubernetes.io/cluster/" + c.ClusterName: clusterTagValue}
+	switch tier {
+	case tierPublic:
+		tags["kubernetes.io/role/elb"] = "1"
+	case tierPrivate:
+		tags["kubernetes.io/role/internal-elb"] = "1"
+	}
+	return tags
+}
+
+// AWS limits on tag keys and values, and on how many tags a resource may have.
+const (
+	maxTagKeyLength    = 128
+	maxTagValueLength  = 256
+	maxTagsPerResource = 50
+)
+
+// tagChars matches the characters AWS allows in tag keys and values.
+var tagChars = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+
+// validateTags returns an error if any of the supplied tags would be rejected
+// by AWS.
+func validateTags(tags map[string]string) error {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	// check in a stable order so the same bad input always reports the same
+	// tag
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if strings.TrimSpace(k) == "" {
+			return errors.New("tag keys must not be empty")
+		}
+		if strings.HasPrefix(strings.ToLower(k), "aws:") {
+			return errors.Errorf("tag key %q uses the reserved aws: prefix", k)
+		}
+		if utf8.RuneCountInString(k) > maxTagKeyLength {
+			return errors.Errorf("tag key %q is longer than %d characters", k, maxTagKeyLength)
+		}
+		if !tagChars.MatchString(k) {
+			return errors.Errorf("tag key %q contains characters AWS doesn't allow", k)
+		}
+		v := tags[k]
+		if utf8.RuneCountInString(v) > maxTagValueLength {
+			return errors.Errorf("value of tag %q is longer than %d characters", k, maxTagValueLength)
+		}
+		if !tagChars.MatchString(v) {
+			return errors.Errorf("value of tag %q contains characters AWS doesn't allow", k)
+		}
+	}
+	return nil
+}
+
+// validateTagCount returns a ValidationError if any resource would get more
+// tags than AWS allows, counting its Name tag and, for subnets, the tags of
+// their tier.
+func (c Config) validateTagCount() error {
+	if n := len(tagsFor(c, "")); n > maxTagsPerResource {
+		return &ValidationError{Field: "spec.tags", Reason: fmt.Sprintf("resources would have %d tags, more than the %d AWS allows", n, maxTagsPerResource)}
+	}
+	for _, tier := range c.subnetTiers() {
+		field := "spec.tags"
+		switch tier {
+		case tierPublic:
+			field = "spec.publicSubnetTags"
+		case tierPrivate:
+			field = "spec.privateSubnetTags"
+		}
+		if n := len(tagsFor(c, "", c.clusterTags(tier), c.subnetTags(tier))); n > maxTagsPerResource {
+			return &ValidationError{Field: field, Reason: fmt.Sprintf("%s subnets would have %d tags, more than the %d AWS allows", tier, n, maxTagsPerResource)}
+		}
+	}
+	return nil
+}
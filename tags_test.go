@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/jbw976/demo-xfn-network/config"
+
+	"k8s.io/utils/ptr"
+)
+
+func TestTagsFor(t *testing.T) {
+	type args struct {
+		cfg   Config
+		name  string
+		extra []map[string]string
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   map[string]*string
+	}{
+		"ComputedName": {
+			reason: "A resource should be tagged with its name when no Name tag is supplied",
+			args: args{
+				cfg:  Config{Config: config.Config{Tags: map[string]string{"team": "network"}}},
+				name: "vpc-code-0",
+			},
+			want: map[string]*string{
+				"Name": ptr.To("vpc-code-0"),
+				"team": ptr.To("network"),
+			},
+		},
+		"NameOverride": {
+			reason: "A Name tag supplied in spec.tags should win over the computed one",
+			args: args{
+				cfg:  Config{Config: config.Config{Tags: map[string]string{"Name": "shared-vpc"}}},
+				name: "vpc-code-0",
+			},
+			want: map[string]*string{
+				"Name": ptr.To("shared-vpc"),
+			},
+		},
+		"ExtraTags": {
+			reason: "Extra tags should be merged over spec.tags",
+			args: args{
+				cfg:   Config{Config: config.Config{Tags: map[string]string{"team": "network", "tier": "any"}}},
+				name:  "subnet-code-0-public-0",
+				extra: []map[string]string{{"tier": "public"}},
+			},
+			want: map[string]*string{
+				"Name": ptr.To("subnet-code-0-public-0"),
+				"team": ptr.To("network"),
+				"tier": ptr.To("public"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := tagsFor(tc.args.cfg, tc.args.name, tc.args.extra...)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\ntagsFor(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		tags   map[string]string
+		want   string
+	}{
+		"Valid": {
+			reason: "Ordinary tags should be valid",
+			tags:   map[string]string{"kubernetes.io/role/elb": "1", "team": ""},
+		},
+		"EmptyKey": {
+			reason: "An empty tag key should be invalid",
+			tags:   map[string]string{" ": "value"},
+			want:   "tag keys must not be empty",
+		},
+		"ReservedPrefix": {
+			reason: "Tag keys with the reserved aws: prefix should be invalid",
+			tags:   map[string]string{"AWS:cloudformation:stack-name": "stack"},
+			want:   `tag key "AWS:cloudformation:stack-name" uses the reserved aws: prefix`,
+		},
+		"LongKey": {
+			reason: "Tag keys longer than AWS allows should be invalid",
+			tags:   map[string]string{strings.Repeat("k", 129): "value"},
+			want:   `tag key "` + strings.Repeat("k", 129) + `" is longer than 128 characters`,
+		},
+		"KeyCharset": {
+			reason: "Tag keys with characters AWS doesn't allow should be invalid",
+			tags:   map[string]string{"team#1": "network"},
+			want:   `tag key "team#1" contains characters AWS doesn't allow`,
+		},
+		"LongValue": {
+			reason: "Tag values longer than AWS allows should be invalid",
+			tags:   map[string]string{"team": strings.Repeat("v", 257)},
+			want:   `value of tag "team" is longer than 256 characters`,
+		},
+		"ValueCharset": {
+			reason: "Tag values with characters AWS doesn't allow should be invalid",
+			tags:   map[string]string{"owner": "net*ops"},
+			want:   `value of tag "owner" contains characters AWS doesn't allow`,
+		},
+		"UnicodeValue": {
+			reason: "Tag values may use letters outside ASCII, counted as characters rather than bytes",
+			tags:   map[string]string{"team": strings.Repeat("ö", 256)},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := ""
+			if err := validateTags(tc.tags); err != nil {
+				got = err.Error()
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nvalidateTags(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionSubnetTags(t *testing.T) {
+	rsp := runXR(t, `{
+		"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+		"kind": "XNetwork",
+		"metadata": {"name": "network-code"},
+		"spec": {
+			"id": "code",
+			"count": 1,
+			"availabilityZones": ["eu-central-1a", "eu-central-1b"],
+			"publicSubnets": true,
+			"privateSubnets": true,
+			"tags": {"team": "network"},
+			"publicSubnetTags": {"kubernetes.io/role/elb": "1"},
+			"privateSubnetTags": {"kubernetes.io/role/internal-elb": "1"}
+		}
+	}`)
+
+	elb := map[string]string{
+		"subnet-code-0-public-0": "1",
+		"subnet-code-0-public-1": "1",
+	}
+	if diff := cmp.Diff(elb, desiredStrings(t, rsp, "spec.forProvider.tags[kubernetes.io/role/elb]")); diff != "" {
+		t.Errorf("f.RunFunction(...): ELB role tag should only be on public subnets: -want, +got:\n%s", diff)
+	}
+
+	internal := map[string]string{
+		"subnet-code-0-private-0": "1",
+		"subnet-code-0-private-1": "1",
+	}
+	if diff := cmp.Diff(internal, desiredStrings(t, rsp, "spec.forProvider.tags[kubernetes.io/role/internal-elb]")); diff != "" {
+		t.Errorf("f.RunFunction(...): internal ELB role tag should only be on private subnets: -want, +got:\n%s", diff)
+	}
+
+	team := map[string]string{
+		"vpc-code-0":              "network",
+		"subnet-code-0-public-0":  "network",
+		"subnet-code-0-public-1":  "network",
+		"subnet-code-0-private-0": "network",
+		"subnet-code-0-private-1": "network",
+	}
+	if diff := cmp.Diff(team, desiredStrings(t, rsp, "spec.forProvider.tags.team")); diff != "" {
+		t.Errorf("f.RunFunction(...): global tags should be on every resource: -want, +got:\n%s", diff)
+	}
+}
+
+func TestRunFunctionClusterTags(t *testing.T) {
+	xr := func(clusterName string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"availabilityZones": ["eu-central-1a"],
+				"publicSubnets": true,
+				"privateSubnets": true,
+				"clusterName": "` + clusterName + `"
+			}
+		}`
+	}
+
+	type want struct {
+		cluster  map[string]string
+		elb      map[string]string
+		internal map[string]string
+		results  []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Tagged": {
+			reason: "Every subnet should be shared with the cluster, with the load balancer role tag of its tier",
+			xr:     xr("prod"),
+			want: want{
+				cluster: map[string]string{
+					"subnet-code-0-public-0":  "shared",
+					"subnet-code-0-private-0": "shared",
+				},
+				elb:      map[string]string{"subnet-code-0-public-0": "1"},
+				internal: map[string]string{"subnet-code-0-private-0": "1"},
+			},
+		},
+		"Unset": {
+			reason: "Subnets shouldn't get discovery tags without a cluster name",
+			xr:     xr(""),
+			want: want{
+				cluster:  map[string]string{},
+				elb:      map[string]string{},
+				internal: map[string]string{},
+			},
+		},
+		"InvalidName": {
+			reason: "A cluster name EKS wouldn't allow should return a fatal result",
+			xr:     xr("-prod"),
+			want: want{
+				cluster:  map[string]string{},
+				elb:      map[string]string{},
+				internal: map[string]string{},
+				results:  []string{`invalid network config: spec.clusterName: cluster name "-prod" must start with a letter or digit, and contain only letters, digits, hyphens, and underscores`},
+			},
+		},
+		"TooLong": {
+			reason: "A cluster name longer than EKS allows should return a fatal result",
+			xr:     xr(strings.Repeat("a", 101)),
+			want: want{
+				cluster:  map[string]string{},
+				elb:      map[string]string{},
+				internal: map[string]string{},
+				results:  []string{`invalid network config: spec.clusterName: cluster name "` + strings.Repeat("a", 101) + `" is longer than 100 characters`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cluster, desiredStrings(t, rsp, "spec.forProvider.tags[kubernetes.io/cluster/prod]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want cluster tags, +got cluster tags:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.elb, desiredStrings(t, rsp, "spec.forProvider.tags[kubernetes.io/role/elb]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want ELB role tags, +got ELB role tags:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.internal, desiredStrings(t, rsp, "spec.forProvider.tags[kubernetes.io/role/internal-elb]")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want internal ELB role tags, +got internal ELB role tags:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionTagLimits(t *testing.T) {
+	// tags returns a JSON object of n tags named tag-0, tag-1, and so on.
+	tags := func(n int) string {
+		kv := make([]string, n)
+		for i := range kv {
+			kv[i] = fmt.Sprintf(`"tag-%d": "v"`, i)
+		}
+		return "{" + strings.Join(kv, ", ") + "}"
+	}
+	xr := func(spec string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1,
+				"availabilityZones": ["eu-central-1a"],
+				"publicSubnets": true` + spec + `
+			}
+		}`
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   []string
+	}{
+		"AtLimit": {
+			reason: "Resources with as many tags as AWS allows, counting the Name tag, should be composed",
+			xr:     xr(`, "tags": ` + tags(49)),
+		},
+		"LongValue": {
+			reason: "A tag value longer than AWS allows should return a fatal result naming the tag",
+			xr:     xr(`, "tags": {"team": "` + strings.Repeat("v", 257) + `"}`),
+			want:   []string{`invalid network config: spec.tags: value of tag "team" is longer than 256 characters`},
+		},
+		"TooManyTags": {
+			reason: "More tags than AWS allows, counting the Name tag, should return a fatal result",
+			xr:     xr(`, "tags": ` + tags(50)),
+			want:   []string{"invalid network config: spec.tags: resources would have 51 tags, more than the 50 AWS allows"},
+		},
+		"TooManySubnetTags": {
+			reason: "More tags than AWS allows on a tier's subnets should return a fatal result naming the tier's tags",
+			xr:     xr(`, "tags": ` + tags(40) + `, "publicSubnetTags": {"a": "1", "b": "1", "c": "1", "d": "1", "e": "1", "f": "1", "g": "1", "h": "1", "i": "1", "j": "1"}`),
+			want:   []string{"invalid network config: spec.publicSubnetTags: public subnets would have 51 tags, more than the 50 AWS allows"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionContextTags(t *testing.T) {
+	const key = "platform.example.org/tags"
+	xr := func(tags string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {"id": "code", "count": 1, "tags": ` + tags + `}
+		}`
+	}
+	input := `{
+		"apiVersion": "networks.fn.crossplane.io/v1beta1",
+		"kind": "Input",
+		"defaultTagsContextKey": "` + key + `"
+	}`
+
+	type want struct {
+		tags    map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason  string
+		input   string
+		xr      string
+		context map[string]any
+		want    want
+	}{
+		"NoKey": {
+			reason:  "Context tags should be ignored unless the input names their key",
+			input:   `{"apiVersion": "networks.fn.crossplane.io/v1beta1", "kind": "Input"}`,
+			xr:      xr(`{}`),
+			context: map[string]any{key: map[string]any{"team": "platform"}},
+			want: want{
+				tags: map[string]string{"Name": "vpc-code-0"},
+			},
+		},
+		"NotInContext": {
+			reason: "A key that's absent from the context should add no tags",
+			input:  input,
+			xr:     xr(`{"team": "network"}`),
+			want: want{
+				tags: map[string]string{"Name": "vpc-code-0", "team": "network"},
+			},
+		},
+		"Merged": {
+			reason:  "Context tags should be merged with the XR's tags",
+			input:   input,
+			xr:      xr(`{"team": "network"}`),
+			context: map[string]any{key: map[string]any{"cost-center": "1234"}},
+			want: want{
+				tags: map[string]string{"Name": "vpc-code-0", "cost-center": "1234", "team": "network"},
+			},
+		},
+		"OverriddenBySpec": {
+			reason:  "The XR's tags should take precedence over context tags",
+			input:   input,
+			xr:      xr(`{"team": "network"}`),
+			context: map[string]any{key: map[string]any{"cost-center": "1234", "team": "platform"}},
+			want: want{
+				tags: map[string]string{"Name": "vpc-code-0", "cost-center": "1234", "team": "network"},
+			},
+		},
+		"NotAnObject": {
+			reason:  "A context key that isn't an object should return a fatal result",
+			input:   input,
+			xr:      xr(`{}`),
+			context: map[string]any{key: "team=platform"},
+			want: want{
+				results: []string{`cannot read default tags: context key "platform.example.org/tags" is not an object`},
+			},
+		},
+		"NotAString": {
+			reason:  "A context tag whose value isn't a string should return a fatal result",
+			input:   input,
+			xr:      xr(`{}`),
+			context: map[string]any{key: map[string]any{"cost-center": 1234}},
+			want: want{
+				results: []string{`cannot read default tags: context key "platform.example.org/tags": value of tag "cost-center" is not a string`},
+			},
+		},
+		"Invalid": {
+			reason:  "A context tag AWS would reject should return a fatal result",
+			input:   input,
+			xr:      xr(`{}`),
+			context: map[string]any{key: map[string]any{"aws:team": "platform"}},
+			want: want{
+				results: []string{`cannot read default tags: context key "platform.example.org/tags": tag key "aws:team" uses the reserved aws: prefix`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger()}
+			req := &fnv1.RunFunctionRequest{
+				Input:    resource.MustStructJSON(tc.input),
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)}},
+			}
+			if tc.context != nil {
+				c, err := structpb.NewStruct(tc.context)
+				if err != nil {
+					t.Fatalf("structpb.NewStruct(...): %v", err)
+				}
+				req.Context = c
+			}
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			var got map[string]string
+			if vpc, ok := rsp.GetDesired().GetResources()["vpc-code-0"]; ok {
+				got, err = fieldpath.Pave(vpc.GetResource().AsMap()).GetStringObject("spec.forProvider.tags")
+				if err != nil {
+					t.Fatalf("%s\nGetStringObject(...): unexpected error: %v", tc.reason, err)
+				}
+			}
+			if diff := cmp.Diff(tc.want.tags, got); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want tags, +got tags:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunFunctionTopology(t *testing.T) {
+	xr := func(spec string) string {
+		return `{
+			"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+			"kind": "XNetwork",
+			"metadata": {"name": "network-code"},
+			"spec": {
+				"id": "code",
+				"count": 1` + spec + `
+			}
+		}`
+	}
+
+	type want struct {
+		kinds   map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Standard": {
+			reason: "The standard topology should route public subnets to an InternetGateway and private subnets to a NAT gateway in two availability zones",
+			xr:     xr(`, "topology": "standard"`),
+			want: want{
+				kinds: map[string]string{
+					"vpc-code-0":                      "VPC",
+					"gateway-code-0":                  "InternetGateway",
+					"eip-code-0-0":                    "EIP",
+					"natgateway-code-0-0":             "NATGateway",
+					"natroute-code-0-0":               "Route",
+					"natroute-code-0-1":               "Route",
+					"route-code-0-public-0":           "Route",
+					"routetable-code-0-public":        "RouteTable",
+					"routetable-code-0-private-0":     "RouteTable",
+					"routetable-code-0-private-1":     "RouteTable",
+					"subnet-code-0-public-0":          "Subnet",
+					"subnet-code-0-public-1":          "Subnet",
+					"subnet-code-0-private-0":         "Subnet",
+					"subnet-code-0-private-1":         "Subnet",
+					"rtassoc-subnet-code-0-public-0":  "RouteTableAssociation",
+					"rtassoc-subnet-code-0-public-1":  "RouteTableAssociation",
+					"rtassoc-subnet-code-0-private-0": "RouteTableAssociation",
+					"rtassoc-subnet-code-0-private-1": "RouteTableAssociation",
+				},
+			},
+		},
+		"Overridden": {
+			reason: "Fields set explicitly should override the pieces of the topology they configure",
+			xr:     xr(`, "topology": "standard", "privateSubnets": false, "availabilityZones": ["eu-central-1c"]`),
+			want: want{
+				kinds: map[string]string{
+					"vpc-code-0":                     "VPC",
+					"gateway-code-0":                 "InternetGateway",
+					"route-code-0-public-0":          "Route",
+					"routetable-code-0-public":       "RouteTable",
+					"subnet-code-0-public-0":         "Subnet",
+					"rtassoc-subnet-code-0-public-0": "RouteTableAssociation",
+				},
+			},
+		},
+		"Isolated": {
+			reason: "The isolated topology should have private subnets and nothing internet facing",
+			xr:     xr(`, "topology": "isolated"`),
+			want: want{
+				kinds: map[string]string{
+					"vpc-code-0":              "VPC",
+					"subnet-code-0-private-0": "Subnet",
+					"subnet-code-0-private-1": "Subnet",
+				},
+			},
+		},
+		"IsolatedConflicts": {
+			reason: "The isolated topology should ignore, and warn about, fields that would add internet access",
+			xr:     xr(`, "topology": "isolated", "includeGateway": true, "publicSubnets": true, "natGatewayStrategy": "per-az", "availabilityZones": ["eu-central-1a"]`),
+			want: want{
+				kinds: map[string]string{
+					"vpc-code-0":              "VPC",
+					"subnet-code-0-private-0": "Subnet",
+				},
+				results: []string{
+					"spec.includeGateway is ignored because spec.topology is isolated, which has no internet access",
+					"spec.publicSubnets is ignored because spec.topology is isolated, which has no internet access",
+					"spec.natGatewayStrategy is ignored because spec.topology is isolated, which has no internet access",
+				},
+			},
+		},
+		"UnknownRegion": {
+			reason: "The standard topology should return a fatal result if it can't pick availability zones",
+			xr:     xr(`, "topology": "standard", "region": "me-central-1"`),
+			want: want{
+				kinds:   map[string]string{},
+				results: []string{"invalid network config: spec.availabilityZones: must be set for the standard topology in region me-central-1, whose availability zones the Function doesn't know"},
+			},
+		},
+		"UnknownTopology": {
+			reason: "A topology the Function doesn't know should return a fatal result",
+			xr:     xr(`, "topology": "fancy"`),
+			want: want{
+				kinds:   map[string]string{},
+				results: []string{`invalid network config: spec.topology: must be standard or isolated, got "fancy"`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			for _, r := range rsp.GetResults() {
+				if strings.Contains(r.GetMessage(), "is ignored because spec.topology") && r.GetReason() != reasonTopologyConflict {
+					t.Errorf("%s\nf.RunFunction(...): result %q has reason %q, want %q", tc.reason, r.GetMessage(), r.GetReason(), reasonTopologyConflict)
+				}
+			}
+			if diff := cmp.Diff(tc.want.kinds, desiredStrings(t, rsp, "kind")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want kinds, +got kinds:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
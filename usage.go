@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/pkg/errors"
+
+	"github.com/jbw976/demo-xfn-network/graph"
+	"github.com/jbw976/demo-xfn-network/names"
+)
+
+// The API version and kind of Crossplane's Usage. Crossplane 1.16 only serves it
+// when started with --enable-usages.
+const (
+	usageAPIVersion = "apiextensions.crossplane.io/v1alpha1"
+	usageKind       = "Usage"
+)
+
+// dependencyUsages returns a Usage for each edge between the supplied desired
+// composed resources, marking the dependent as a user of the resource it
+// depends on. Only edges between the named resources are considered, so
+// resources composed by other functions in the pipeline are left alone.
+//
+// Crossplane deletes all of a deleted XR's composed resources at once. While a
+// Usage exists, Crossplane's admission webhook rejects deleting the resource
+// it's of. The Usage is deleted along with the resource it's by, so each
+// resource is only deleted once everything that depends on it is gone, for
+// example the VPC after its subnets, route tables, and gateway.
+func dependencyUsages(cfg Config, desired map[resource.Name]*resource.DesiredComposed, composedNames map[resource.Name]bool) (map[resource.Name]*composed.Unstructured, error) {
+	usages := map[resource.Name]*composed.Unstructured{}
+	for _, e := range graph.Edges(desired) {
+		if !composedNames[resource.Name(e.From)] || !composedNames[resource.Name(e.To)] {
+			continue
+		}
+		name := names.UsageName(e.From, e.To)
+		u, err := newUsage(cfg, name, desired[resource.Name(e.From)].Resource, desired[resource.Name(e.To)].Resource)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot build %s", name)
+		}
+		usages[resource.Name(name)] = u
+	}
+	return usages, nil
+}
+
+// newUsage returns a Usage with the supplied name, of the supplied resource by
+// the supplied dependent resource. Both are referenced by name.
+func newUsage(cfg Config, name string, of, by *composed.Unstructured) (*composed.Unstructured, error) {
+	u := composed.New()
+	u.SetAPIVersion(usageAPIVersion)
+	u.SetKind(usageKind)
+	u.SetName(name)
+	u.SetLabels(cfg.managedLabels(map[string]string{labelNetworkID: cfg.ID}))
+
+	for path, v := range map[string]any{
+		"spec.of.apiVersion":       of.GetAPIVersion(),
+		"spec.of.kind":             of.GetKind(),
+		"spec.of.resourceRef.name": of.GetName(),
+		"spec.by.apiVersion":       by.GetAPIVersion(),
+		"spec.by.kind":             by.GetKind(),
+		"spec.by.resourceRef.name": by.GetName(),
+	} {
+		if err := u.SetValue(path, v); err != nil {
+			return nil, errors.Wrapf(err, "cannot set %s", path)
+		}
+	}
+	return u, nil
+}
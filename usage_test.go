@@ -0,0 +1,155 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/resource/composed"
+
+	"github.com/jbw976/demo-xfn-network/config"
+)
+
+func TestRunFunctionDeletionOrdering(t *testing.T) {
+	type want struct {
+		of      map[string]string
+		by      map[string]string
+		results []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"Disabled": {
+			reason: "No Usages should be composed by default",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"includeGateway": true,
+					"publicSubnets": true,
+					"availabilityZones": ["eu-central-1a"]
+				}
+			}`,
+			want: want{
+				of: map[string]string{},
+				by: map[string]string{},
+			},
+		},
+		"Enabled": {
+			reason: "Each dependent should be a user of every resource it depends on, so that it's deleted first",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"includeGateway": true,
+					"publicSubnets": true,
+					"availabilityZones": ["eu-central-1a"],
+					"deletionOrdering": true
+				}
+			}`,
+			want: want{
+				of: map[string]string{
+					"usage-gateway-code-0-by-route-code-0-public-0":                    "gateway-code-0",
+					"usage-routetable-code-0-public-by-route-code-0-public-0":          "routetable-code-0-public",
+					"usage-routetable-code-0-public-by-rtassoc-subnet-code-0-public-0": "routetable-code-0-public",
+					"usage-subnet-code-0-public-0-by-rtassoc-subnet-code-0-public-0":   "subnet-code-0-public-0",
+					"usage-vpc-code-0-by-gateway-code-0":                               "vpc-code-0",
+					"usage-vpc-code-0-by-routetable-code-0-public":                     "vpc-code-0",
+					"usage-vpc-code-0-by-subnet-code-0-public-0":                       "vpc-code-0",
+				},
+				by: map[string]string{
+					"usage-gateway-code-0-by-route-code-0-public-0":                    "route-code-0-public-0",
+					"usage-routetable-code-0-public-by-route-code-0-public-0":          "route-code-0-public-0",
+					"usage-routetable-code-0-public-by-rtassoc-subnet-code-0-public-0": "rtassoc-subnet-code-0-public-0",
+					"usage-subnet-code-0-public-0-by-rtassoc-subnet-code-0-public-0":   "rtassoc-subnet-code-0-public-0",
+					"usage-vpc-code-0-by-gateway-code-0":                               "gateway-code-0",
+					"usage-vpc-code-0-by-routetable-code-0-public":                     "routetable-code-0-public",
+					"usage-vpc-code-0-by-subnet-code-0-public-0":                       "subnet-code-0-public-0",
+				},
+			},
+		},
+		"GenerateName": {
+			reason: "Usages reference resources by name, so they can't be combined with generated names",
+			xr: `{
+				"apiVersion": "xp-layers.crossplane.io/v1alpha1",
+				"kind": "XNetwork",
+				"metadata": {"name": "network-code"},
+				"spec": {
+					"id": "code",
+					"count": 1,
+					"useGenerateName": true,
+					"deletionOrdering": true
+				}
+			}`,
+			want: want{
+				of:      map[string]string{},
+				by:      map[string]string{},
+				results: []string{"invalid network config: spec.useGenerateName: cannot be combined with spec.deletionOrdering, since Usages reference resources by name"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := runXR(t, tc.xr)
+
+			if diff := cmp.Diff(tc.want.of, desiredStrings(t, rsp, "spec.of.resourceRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want used resources, +got used resources:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.by, desiredStrings(t, rsp, "spec.by.resourceRef.name")); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want dependents, +got dependents:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, resultMessages(rsp)); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestNewUsage(t *testing.T) {
+	vpc := composed.New()
+	vpc.SetAPIVersion("ec2.aws.upbound.io/v1beta1")
+	vpc.SetKind("VPC")
+	vpc.SetName("vpc-code-0")
+	subnet := composed.New()
+	subnet.SetAPIVersion("ec2.aws.upbound.io/v1beta1")
+	subnet.SetKind("Subnet")
+	subnet.SetName("subnet-code-0-public-0")
+
+	got, err := newUsage(Config{Config: config.Config{ID: "code"}}, "usage-vpc-code-0-by-subnet-code-0-public-0", vpc, subnet)
+	if err != nil {
+		t.Fatalf("newUsage(...): unexpected error: %v", err)
+	}
+	want := map[string]any{
+		"apiVersion": "apiextensions.crossplane.io/v1alpha1",
+		"kind":       "Usage",
+		"metadata": map[string]any{
+			"name":   "usage-vpc-code-0-by-subnet-code-0-public-0",
+			"labels": map[string]any{labelNetworkID: "code"},
+		},
+		"spec": map[string]any{
+			"of": map[string]any{
+				"apiVersion":  "ec2.aws.upbound.io/v1beta1",
+				"kind":        "VPC",
+				"resourceRef": map[string]any{"name": "vpc-code-0"},
+			},
+			"by": map[string]any{
+				"apiVersion":  "ec2.aws.upbound.io/v1beta1",
+				"kind":        "Subnet",
+				"resourceRef": map[string]any{"name": "subnet-code-0-public-0"},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got.Object); diff != "" {
+		t.Errorf("newUsage(...): -want, +got:\n%s", diff)
+	}
+}